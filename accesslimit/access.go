@@ -0,0 +1,54 @@
+package accesslimit
+
+import (
+	"net/netip"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/accesslimit"
+)
+
+// AccessLimiter 在调用被包装的限流器之前按名单放行或限流, 名单可以在运行时替换.
+// 没有实现 limiter.Admin, 需要管理时直接使用被包装的限流器.
+type AccessLimiter = accesslimit.AccessLimiter
+
+// List 匹配限流对象的名单.
+type List = accesslimit.List
+
+// NewAccessLimiter 创建一个按允许名单与拒绝名单过滤的限流器.
+// 拒绝名单优先: 匹配拒绝名单时直接限流, 匹配允许名单时直接放行, 都不会调用 l, 不会访问 redis.
+// 名单的条目可以是完整的 key、以 * 结尾的前缀、IP 或 IPv4/IPv6 的 CIDR
+// 示例: 内网与监控探针不限流, 拒绝已知的恶意网段
+// NewAccessLimiter(l, WithAllowList("10.0.0.0/8", "fd00::/8", "probe:*"), WithDenyList("203.0.113.0/24"))
+func NewAccessLimiter(l limiter.Limiter, opts ...accesslimit.Option) *AccessLimiter {
+	return accesslimit.NewAccessLimiter(l, opts...)
+}
+
+// ParseList 解析名单的条目, "/" 之前是 IP 但不是有效的 CIDR 时返回 limiter.ErrInvalidConfig.
+func ParseList(entries ...string) (*List, error) {
+	return accesslimit.ParseList(entries...)
+}
+
+// KeyIP 将整个 key 解析为 IP 或 IP:端口, 失败时返回零值.
+func KeyIP(key string) netip.Addr {
+	return accesslimit.KeyIP(key)
+}
+
+// WithAllowList 总是放行的限流对象.
+func WithAllowList(entries ...string) accesslimit.Option {
+	return accesslimit.WithAllowList(entries...)
+}
+
+// WithDenyList 总是限流的限流对象.
+func WithDenyList(entries ...string) accesslimit.Option {
+	return accesslimit.WithDenyList(entries...)
+}
+
+// WithIPFunc 从限流对象中提取与 CIDR 比较的 IP, 默认为 KeyIP.
+func WithIPFunc(fn func(key string) netip.Addr) accesslimit.Option {
+	return accesslimit.WithIPFunc(fn)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) accesslimit.Option {
+	return accesslimit.WithObserver(o)
+}
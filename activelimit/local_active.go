@@ -1,9 +1,17 @@
 package activelimit
 
-import "github.com/udugong/limiter/internal/activelimit"
+import (
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/activelimit"
+)
 
 // NewLocalActiveLimiter 创建一个本地活跃请求数限流器.
 // maxActive 最大请求数
-func NewLocalActiveLimiter(maxActive int64) *activelimit.LocalActiveLimiter {
-	return activelimit.NewLocalActiveLimiter(maxActive)
+func NewLocalActiveLimiter(maxActive int64, opts ...activelimit.LocalOption) *activelimit.LocalActiveLimiter {
+	return activelimit.NewLocalActiveLimiter(maxActive, opts...)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer, 同时适用于本地与 redis 限流器.
+func WithObserver(o limiter.Observer) activelimit.CommonOption {
+	return activelimit.WithObserver(o)
 }
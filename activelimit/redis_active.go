@@ -7,6 +7,26 @@ import (
 )
 
 // NewRedisActiveLimiter 创建一个基于 redis 的活跃请求数限流器.
-func NewRedisActiveLimiter(cli redis.Cmdable, maxActive int64) *activelimit.RedisActiveLimiter {
-	return activelimit.NewRedisActiveLimiter(maxActive, cli)
+// redis 上的 key 默认为 [prefix:]key, 与之前的版本相同. 使用 WithKeySuffix 后为 [prefix:]key:active,
+// 多个算法的限流器共用 redis 时避免 key 冲突
+func NewRedisActiveLimiter(cli redis.Cmdable, maxActive int64,
+	opts ...activelimit.RedisOption) *activelimit.RedisActiveLimiter {
+	return activelimit.NewRedisActiveLimiter(maxActive, cli, opts...)
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀.
+func WithKeyPrefix(prefix string) activelimit.RedisOption {
+	return activelimit.WithKeyPrefix(prefix)
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster.
+func WithHashTag() activelimit.RedisOption {
+	return activelimit.WithHashTag()
+}
+
+// WithKeySuffix 在 redis 上的 key 后加上 ":active", 多个算法的限流器共用 redis 时避免 key 冲突.
+// 开启后之前 key 上的计数不再生效, 滚动发布期间新旧实例分别计数, 限流最多放宽为两倍.
+// 迁移时可在低峰期一次性切换, 或先为新实例设置新的 WithKeyPrefix 再逐步切换流量.
+func WithKeySuffix() activelimit.RedisOption {
+	return activelimit.WithKeySuffix()
 }
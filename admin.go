@@ -0,0 +1,41 @@
+package limiter
+
+import "context"
+
+// State 限流对象当前的状态
+type State struct {
+	// Limit 阈值, 例如窗口内允许的请求数、最大活跃请求数或桶的容量
+	Limit int64 `json:"limit"`
+	// Used 已使用的额度
+	Used int64 `json:"used"`
+	// Remaining 剩余的额度
+	Remaining int64 `json:"remaining"`
+}
+
+// NewState 根据阈值与已使用的额度生成 State, 剩余的额度不小于 0
+func NewState(limit, used int64) State {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return State{Limit: limit, Used: used, Remaining: remaining}
+}
+
+// Admin 管理限流对象的状态, 用于运维时查询或解除某个限流对象的限流.
+// 包装其他限流器的限流器(shadowlimit、resilientlimit、metriclimit、otellimit、accesslimit、
+// hierarchylimit、keyedlimit)不实现 Admin, 也不会转发给被包装的限流器, 需要管理时直接使用被包装的限流器.
+// penaltylimit.PenaltyLimiter 是例外, 它的 Admin 管理的是自身的违规次数与封禁, 而不是被包装的限流器的状态
+type Admin interface {
+	// Inspect 查询 key 当前的状态, 不消耗额度
+	Inspect(ctx context.Context, key string) (State, error)
+	// Reset 清空 key 已使用的额度
+	Reset(ctx context.Context, key string) error
+	// Adjust 调整 key 的额度. delta 为正时授予额度(已使用的额度减少), 为负时扣除额度
+	Adjust(ctx context.Context, key string, delta int64) error
+}
+
+// LimitSetter 可以在运行时修改阈值的限流器. 基于 redis 的限流器只修改当前实例的阈值
+type LimitSetter interface {
+	// SetLimit 修改阈值, 小于 0 时返回 ErrInvalidConfig
+	SetLimit(limit int64) error
+}
@@ -0,0 +1,35 @@
+package limiter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewState(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int64
+		used  int64
+		want  State
+	}{
+		{
+			name:  "normal",
+			limit: 10,
+			used:  3,
+			want:  State{Limit: 10, Used: 3, Remaining: 7},
+		},
+		{
+			// 扣除额度后已使用的额度可能超过阈值
+			name:  "over_limit",
+			limit: 10,
+			used:  12,
+			want:  State{Limit: 10, Used: 12, Remaining: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewState(tt.limit, tt.used))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package adminlimit
+
+import (
+	"github.com/udugong/limiter/internal/adminlimit"
+)
+
+// Action 管理接口的操作, 用于鉴权.
+type Action = adminlimit.Action
+
+// 管理接口的操作.
+const (
+	ActionList     = adminlimit.ActionList
+	ActionInspect  = adminlimit.ActionInspect
+	ActionReset    = adminlimit.ActionReset
+	ActionAdjust   = adminlimit.ActionAdjust
+	ActionSetLimit = adminlimit.ActionSetLimit
+)
+
+// Authorizer 对管理接口的请求鉴权, 返回 error 时拒绝请求.
+type Authorizer = adminlimit.Authorizer
+
+// AuthorizerFunc 函数形式的 Authorizer.
+type AuthorizerFunc = adminlimit.AuthorizerFunc
+
+// ErrUnauthorized Authorizer 返回该错误时响应 401, 返回其他错误时响应 403.
+var ErrUnauthorized = adminlimit.ErrUnauthorized
+
+// NewHandler 创建一个管理限流器的 http.Handler, 通过 Register 注册实现了 limiter.Admin 的限流器.
+// 提供列出限流器、查询与清空限流对象的状态、调整额度以及修改阈值的 JSON 接口, 见 adminlimit.Handler
+// auth 为 nil 时拒绝所有请求
+// 示例: 挂载在 /admin 下
+// mux.Handle("/admin/", http.StripPrefix("/admin", h))
+func NewHandler(auth Authorizer) *adminlimit.Handler {
+	return adminlimit.NewHandler(auth)
+}
+
+// TokenAuthorizer 要求请求头 Authorization 为 "Bearer <token>".
+func TokenAuthorizer(token string) Authorizer {
+	return adminlimit.TokenAuthorizer(token)
+}
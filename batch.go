@@ -0,0 +1,28 @@
+package limiter
+
+import "context"
+
+// BatchLimiter 批量限流
+type BatchLimiter interface {
+	// LimitMany 一次判断多个限流对象, 每个限流对象独立计数.
+	// []bool 与 keys 一一对应, true 就是要限流
+	// error 限流器本身有没有错误
+	LimitMany(ctx context.Context, keys []string) ([]bool, error)
+}
+
+// LimitMany 一次判断多个限流对象.
+// l 实现了 BatchLimiter 时使用 LimitMany, 否则依次调用 Limit
+func LimitMany(ctx context.Context, l Limiter, keys []string) ([]bool, error) {
+	if bl, ok := l.(BatchLimiter); ok {
+		return bl.LimitMany(ctx, keys)
+	}
+	res := make([]bool, len(keys))
+	for i, key := range keys {
+		limited, err := l.Limit(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = limited
+	}
+	return res, nil
+}
@@ -0,0 +1,69 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+func TestLimitMany(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) Limiter
+		want    []bool
+		wantErr error
+	}{
+		{
+			name: "normal",
+			mock: func(ctrl *gomock.Controller) Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "ip").Return(false, nil)
+				l.EXPECT().Limit(gomock.Any(), "user").Return(true, nil)
+				return l
+			},
+			want: []bool{false, true},
+		},
+		{
+			name: "error",
+			mock: func(ctrl *gomock.Controller) Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "ip").Return(false, errors.New("mock error"))
+				return l
+			},
+			wantErr: errors.New("mock error"),
+		},
+		{
+			name: "batch_limiter",
+			mock: func(ctrl *gomock.Controller) Limiter {
+				return batchLimiter{res: []bool{true, true}}
+			},
+			want: []bool{true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			got, err := LimitMany(context.Background(), tt.mock(ctrl), []string{"ip", "user"})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type batchLimiter struct {
+	res []bool
+}
+
+func (b batchLimiter) Limit(_ context.Context, _ string) (bool, error) {
+	panic("不应该调用 Limit")
+}
+
+func (b batchLimiter) LimitMany(_ context.Context, _ []string) ([]bool, error) {
+	return b.res, nil
+}
@@ -1,6 +1,7 @@
 package bucketlimit
 
 import (
+	"context"
 	"time"
 
 	"github.com/udugong/limiter/internal/bucketlimit"
@@ -8,6 +9,19 @@ import (
 
 // NewLeakyBucketLimiter 创建一个漏桶限流器.
 // interval 每个请求之间的间隔
-func NewLeakyBucketLimiter(interval time.Duration) *bucketlimit.Bucket {
-	return bucketlimit.NewLeakyBucket(interval)
+func NewLeakyBucketLimiter(interval time.Duration, opts ...bucketlimit.Option) *bucketlimit.Bucket {
+	return bucketlimit.NewLeakyBucket(interval, opts...)
+}
+
+// NewQueueLeakyBucketLimiter 创建一个按先进先出顺序放行的漏桶限流器.
+// interval 每个请求之间的间隔
+// maxQueue 最多排队等待的请求数, 队列已满或预计等待时间超过 Context 的 deadline 时 BlockLimit 立即限流
+func NewQueueLeakyBucketLimiter(interval time.Duration, maxQueue int,
+	opts ...bucketlimit.QueueOption) *bucketlimit.QueueBucket {
+	return bucketlimit.NewQueueBucket(interval, maxQueue, opts...)
+}
+
+// WithOnQueue 请求开始排队时报告排队的位置与预计的等待时间.
+func WithOnQueue(fn func(ctx context.Context, key string, info bucketlimit.QueueInfo)) bucketlimit.QueueOption {
+	return bucketlimit.WithOnQueue(fn)
 }
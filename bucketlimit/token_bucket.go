@@ -1,14 +1,68 @@
 package bucketlimit
 
 import (
+	"context"
 	"time"
 
+	"github.com/udugong/limiter"
 	"github.com/udugong/limiter/internal/bucketlimit"
 )
 
 // NewTokenBucketLimiter 创建一个令牌桶算法限流器.
 // interval 每 interval 的时间放置一个令牌
 // capacity 存放的令牌数
-func NewTokenBucketLimiter(interval time.Duration, capacity int) *bucketlimit.Bucket {
-	return bucketlimit.NewTokenBucket(interval, capacity)
+func NewTokenBucketLimiter(interval time.Duration, capacity int, opts ...bucketlimit.Option) *bucketlimit.Bucket {
+	return bucketlimit.NewTokenBucket(interval, capacity, opts...)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) bucketlimit.CommonOption {
+	return bucketlimit.WithObserver(o)
+}
+
+// WithClock 控制时间与定时器, 同时适用于所有桶限流器. 测试时可以使用 fakeclock.
+func WithClock(c limiter.Clock) bucketlimit.CommonOption {
+	return bucketlimit.WithClock(c)
+}
+
+// NewPriorityTokenBucketLimiter 创建一个按优先级分配令牌的令牌桶限流器.
+// interval 每 interval 的时间放置一个令牌
+// capacity 存放的令牌数
+// 桶中没有令牌时 BlockLimit 按优先级从高到低获得令牌, 优先级通过 WithPriority 设置在 Context 中,
+// 或者使用 BlockLimitPriority 显式传入. 低优先级的请求每等待一段时间优先级提高 1, 见 WithAging
+func NewPriorityTokenBucketLimiter(interval time.Duration, capacity int,
+	opts ...bucketlimit.PriorityOption) *bucketlimit.PriorityBucket {
+	return bucketlimit.NewPriorityBucket(interval, capacity, opts...)
+}
+
+// WithAging 等待的请求每等待 d 优先级提高 1.
+func WithAging(d time.Duration) bucketlimit.PriorityOption {
+	return bucketlimit.WithAging(d)
+}
+
+// WithPriority 在 ctx 中设置请求的优先级.
+func WithPriority(ctx context.Context, p bucketlimit.Priority) context.Context {
+	return bucketlimit.WithPriority(ctx, p)
+}
+
+// 优先级, 数值越大越优先.
+const (
+	PriorityLow      = bucketlimit.PriorityLow
+	PriorityNormal   = bucketlimit.PriorityNormal
+	PriorityHigh     = bucketlimit.PriorityHigh
+	PriorityCritical = bucketlimit.PriorityCritical
+)
+
+// NewWarmUpTokenBucketLimiter 创建一个带预热的令牌桶限流器, 算法与 Guava 的 SmoothWarmingUp 相同.
+// interval 稳定时每 interval 放行一个请求
+// warmup 冷启动或空闲之后, 放行的速率经过 warmup 的时间从 1/(interval*coldFactor) 线性提高到 1/interval
+// 令牌按时间惰性计算, 不需要运行 Put
+func NewWarmUpTokenBucketLimiter(interval, warmup time.Duration,
+	opts ...bucketlimit.WarmUpOption) *bucketlimit.WarmUpBucket {
+	return bucketlimit.NewWarmUpBucket(interval, warmup, opts...)
+}
+
+// WithColdFactor 最冷时放行请求的间隔为 interval * factor. 默认 3.
+func WithColdFactor(factor float64) bucketlimit.WarmUpOption {
+	return bucketlimit.WithColdFactor(factor)
 }
@@ -0,0 +1,75 @@
+package limiter
+
+import "time"
+
+// Clock 限流器获取当前时间与创建定时器的方式. 默认使用 SystemClock,
+// 测试时可以替换为手动推进的 fakeclock.Clock, 不再依赖真实的等待
+type Clock interface {
+	// Now 当前时间
+	Now() time.Time
+	// NewTimer 类似 time.NewTimer
+	NewTimer(d time.Duration) Timer
+	// NewTicker 类似 time.NewTicker
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc 类似 time.AfterFunc
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer 类似 time.Timer
+type Timer interface {
+	// C 到期时发送当前时间, AfterFunc 创建的 Timer 返回 nil
+	C() <-chan time.Time
+	// Stop 类似 time.Timer.Stop
+	Stop() bool
+	// Reset 类似 time.Timer.Reset
+	Reset(d time.Duration) bool
+}
+
+// Ticker 类似 time.Ticker
+type Ticker interface {
+	// C 每次到期时发送当前时间
+	C() <-chan time.Time
+	// Stop 类似 time.Ticker.Stop
+	Stop()
+	// Reset 类似 time.Ticker.Reset
+	Reset(d time.Duration)
+}
+
+// SystemClock 使用 time 包的 Clock
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{Timer: time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{Ticker: time.NewTicker(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{Timer: time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,28 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemClock(t *testing.T) {
+	c := SystemClock()
+	start := c.Now()
+
+	timer := c.NewTimer(time.Millisecond)
+	assert.False(t, (<-timer.C()).Before(start))
+	assert.False(t, timer.Stop())
+
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	<-ticker.C()
+	ticker.Stop()
+
+	done := make(chan struct{})
+	f := c.AfterFunc(time.Millisecond, func() { close(done) })
+	<-done
+	assert.False(t, f.Stop())
+	assert.Nil(t, f.C())
+}
@@ -0,0 +1,16 @@
+package limiter
+
+import "errors"
+
+// 限流器返回的错误. 具体的错误可能包装了这些错误, 需要使用 errors.Is 判断
+var (
+	// ErrClosed 限流器被关闭了
+	ErrClosed = errors.New("限流器被关闭了")
+	// ErrOverRelease Decr 的次数多于 Limit 的次数
+	ErrOverRelease = errors.New("活跃请求数小于0")
+	// ErrBackendUnavailable 后端(如 redis)出错, 被包装的原始错误同样可以使用 errors.Is 判断.
+	// 调用方自身的 Context 出错时直接返回 Context.Err(), 不视为后端出错
+	ErrBackendUnavailable = errors.New("后端不可用")
+	// ErrInvalidConfig 限流器的配置不合法
+	ErrInvalidConfig = errors.New("限流器配置不合法")
+)
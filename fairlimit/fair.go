@@ -0,0 +1,51 @@
+package fairlimit
+
+import (
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/fairlimit"
+)
+
+// NewFairActiveLimiter 创建一个按权重在限流对象之间分配最大活跃请求数的本地限流器.
+// maxActive 所有限流对象一共允许的最大请求数
+// 每个活跃的限流对象预留 1 个请求, 其余的按权重分配,
+// 即最多使用 1 + (maxActive - 活跃的限流对象数) * 权重 / 活跃的限流对象的权重之和 个请求,
+// 不活跃的限流对象的份额由其他限流对象分享. 见 WithWeight 与 WithIdleTimeout
+func NewFairActiveLimiter(maxActive int64, opts ...fairlimit.ActiveOption) *fairlimit.FairActiveLimiter {
+	return fairlimit.NewFairActiveLimiter(maxActive, opts...)
+}
+
+// NewFairBucketLimiter 创建一个按权重在限流对象之间公平分配令牌的令牌桶限流器.
+// interval 每 interval 的时间放置一个令牌
+// capacity 存放的令牌数
+// 桶中没有令牌时, BlockLimit 按限流对象排队, 令牌按权重轮流分配给有请求在等待的限流对象
+func NewFairBucketLimiter(interval time.Duration, capacity int,
+	opts ...fairlimit.BucketOption) *fairlimit.FairBucket {
+	return fairlimit.NewFairBucket(interval, capacity, opts...)
+}
+
+// WithWeight 设置限流对象的权重.
+func WithWeight(fn func(key string) int) fairlimit.CommonOption {
+	return fairlimit.WithWeight(fn)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) fairlimit.CommonOption {
+	return fairlimit.WithObserver(o)
+}
+
+// WithIdleTimeout 限流对象超过 d 没有请求时不再占用份额.
+func WithIdleTimeout(d time.Duration) fairlimit.ActiveOption {
+	return fairlimit.WithIdleTimeout(d)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) fairlimit.ActiveOption {
+	return fairlimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间与定时器, 同时适用于 FairActiveLimiter 与 FairBucket.
+func WithClock(c limiter.Clock) fairlimit.CommonOption {
+	return fairlimit.WithClock(c)
+}
@@ -0,0 +1,23 @@
+package fakeclock
+
+import (
+	"time"
+
+	"github.com/udugong/limiter/internal/fakeclock"
+)
+
+// Clock 手动推进的 limiter.Clock, 用于测试. 只有调用 Advance 或 Set 时时间才会前进,
+// 可以通过各个限流器的 WithClock 使用.
+type Clock = fakeclock.Clock
+
+// New 创建一个当前时间为 now 的 Clock.
+// 示例: 令牌桶在推进 interval 之后放置令牌
+// clk := New(time.Now())
+// b := bucketlimit.NewTokenBucketLimiter(time.Second, 10, bucketlimit.WithClock(clk))
+// go b.Put()
+// clk.BlockUntil(1) // 等待 Put 创建 ticker
+// clk.Advance(time.Second)
+// clk.BlockUntilRead() // 等待 Put 读取到期的 ticker, 不保证已经放置了令牌
+func New(now time.Time) *Clock {
+	return fakeclock.New(now)
+}
@@ -0,0 +1,66 @@
+package hierarchylimit
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/hierarchylimit"
+)
+
+// Level 分层限流中的一层.
+type Level = hierarchylimit.Level
+
+// RedisLevel 基于 redis 的分层限流中的一层.
+type RedisLevel = hierarchylimit.RedisLevel
+
+// Result 分层限流的结果, 包括限流的层.
+type Result = hierarchylimit.Result
+
+// NewHierarchicalLimiter 创建一个本地的分层限流器.
+// levels 按从叶子到根的顺序排列, 例如 user、tenant、cluster
+// 所有层的判断与撤销在同一把锁内完成, 任意一层限流时撤销已经通过的层.
+// 除根以外的层的限流器需要实现 limiter.Reserver 或 limiter.Reverter, 否则返回 limiter.ErrInvalidConfig
+// 示例: 每个用户 50/s, 每个租户 1000/s, 集群 20000/s 时, 依次传入 user、tenant、cluster 三层,
+// tenant 层的 Key 将用户映射为所属的租户, cluster 层的 Key 将所有用户映射为同一个限流对象.
+// 每层的限流器可以使用 keyedlimit.NewKeyedLimiter 为每个限流对象创建独立的本地滑动窗口
+func NewHierarchicalLimiter(levels []Level,
+	opts ...hierarchylimit.LocalOption) (*hierarchylimit.HierarchicalLimiter, error) {
+	return hierarchylimit.NewHierarchicalLimiter(levels, opts...)
+}
+
+// NewRedisHierarchicalLimiter 创建一个基于 redis 的分层滑动窗口限流器.
+// levels 按从叶子到根的顺序排列, 每一层的窗口大小、阈值与 redis 上的 key 由该层的滑动窗口限流器提供
+// 在一个脚本中检查所有层, 所有层都通过时才计入
+// 在 redis cluster 中, 每一层的 key 不在同一个 slot 时每层执行一次脚本, 不再是原子的.
+// 所有层的 Prefix 使用同一个 hash tag 可以保持原子
+func NewRedisHierarchicalLimiter(cmd redis.Cmdable, levels []RedisLevel,
+	opts ...hierarchylimit.Option) *hierarchylimit.RedisHierarchicalLimiter {
+	return hierarchylimit.NewRedisHierarchicalLimiter(cmd, levels, opts...)
+}
+
+// WithServerTime 使用 redis 服务器的时间.
+func WithServerTime() hierarchylimit.Option {
+	return hierarchylimit.WithServerTime()
+}
+
+// WithCluster cmd 连接的是 redis cluster, cmd 为 *redis.ClusterClient 时不需要设置.
+func WithCluster() hierarchylimit.Option {
+	return hierarchylimit.WithCluster()
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) hierarchylimit.CommonOption {
+	return hierarchylimit.WithObserver(o)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) hierarchylimit.Option {
+	return hierarchylimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) hierarchylimit.Option {
+	return hierarchylimit.WithClock(c)
+}
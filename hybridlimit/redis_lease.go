@@ -0,0 +1,71 @@
+package hybridlimit
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/hybridlimit"
+)
+
+// NewRedisLeaseLimiter 创建一个从 redis 批量租用额度、在本地消耗的限流器.
+// cmd: 可传入 redis 的客户端
+// interval: 窗口大小
+// rate: 阈值
+// 表示: 在 interval 内所有实例一共允许 rate 个请求
+// redis 上的 key 默认为 [prefix:]key, 与之前的版本相同. 使用 WithKeySuffix 后为 [prefix:]key:lease,
+// 多个算法的限流器共用 redis 时避免 key 冲突
+// 示例: 每次租用 50 个额度, 租约 100ms 后过期
+// NewRedisLeaseLimiter(redis.Client, time.Second, 3000, WithBatchSize(50), WithSyncInterval(100*time.Millisecond))
+func NewRedisLeaseLimiter(cmd redis.Cmdable, interval time.Duration, rate int64,
+	opts ...hybridlimit.Option) *hybridlimit.RedisLeaseLimiter {
+	return hybridlimit.NewRedisLeaseLimiter(cmd, interval, rate, opts...)
+}
+
+// WithBatchSize 每次从 redis 租用的额度.
+func WithBatchSize(batch int64) hybridlimit.Option {
+	return hybridlimit.WithBatchSize(batch)
+}
+
+// WithSyncInterval 租约的有效期.
+func WithSyncInterval(interval time.Duration) hybridlimit.Option {
+	return hybridlimit.WithSyncInterval(interval)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) hybridlimit.Option {
+	return hybridlimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) hybridlimit.Option {
+	return hybridlimit.WithClock(c)
+}
+
+// WithServerTime 使用 redis 服务器的时间判断窗口.
+func WithServerTime() hybridlimit.Option {
+	return hybridlimit.WithServerTime()
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀.
+func WithKeyPrefix(prefix string) hybridlimit.Option {
+	return hybridlimit.WithKeyPrefix(prefix)
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster.
+func WithHashTag() hybridlimit.Option {
+	return hybridlimit.WithHashTag()
+}
+
+// WithKeySuffix 在 redis 上的 key 后加上 ":lease", 多个算法的限流器共用 redis 时避免 key 冲突.
+// 开启后之前 key 上的计数不再生效, 滚动发布期间新旧实例分别计数, 限流最多放宽为两倍.
+// 迁移时可在低峰期一次性切换, 或先为新实例设置新的 WithKeyPrefix 再逐步切换流量.
+func WithKeySuffix() hybridlimit.Option {
+	return hybridlimit.WithKeySuffix()
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) hybridlimit.Option {
+	return hybridlimit.WithObserver(o)
+}
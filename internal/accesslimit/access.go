@@ -0,0 +1,146 @@
+package accesslimit
+
+import (
+	"context"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// AccessLimiter 在调用 l 之前按名单放行或限流.
+// 拒绝名单优先于允许名单: 匹配拒绝名单时直接限流, 匹配允许名单时直接放行, 都不会调用 l.
+// 名单可以通过 Reload 在运行时替换.
+// 没有实现 limiter.Admin, 名单中的限流对象不经过 l, 管理 l 的状态对它们没有影响
+type AccessLimiter struct {
+	l        limiter.Limiter
+	lists    atomic.Pointer[lists]
+	ipFunc   func(key string) netip.Addr
+	observer limiter.Observer
+}
+
+type lists struct {
+	allow *List
+	deny  *List
+	// err 创建时名单无效, Limit 时返回
+	err error
+}
+
+// NewAccessLimiter 默认允许名单与拒绝名单都为空, 将整个 key 解析为 IP 或 IP:端口.
+// 名单中有无效的 CIDR 时 Limit 返回 limiter.ErrInvalidConfig
+func NewAccessLimiter(l limiter.Limiter, opts ...Option) *AccessLimiter {
+	o := &options{
+		ipFunc: KeyIP,
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	a := &AccessLimiter{
+		l:        l,
+		ipFunc:   o.ipFunc,
+		observer: o.observer,
+	}
+	if err := a.Reload(o.allow, o.deny); err != nil {
+		a.lists.Store(&lists{err: err})
+	}
+	return a
+}
+
+type options struct {
+	allow    []string
+	deny     []string
+	ipFunc   func(key string) netip.Addr
+	observer limiter.Observer
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithAllowList 总是放行的限流对象, 条目的格式见 List
+func WithAllowList(entries ...string) Option {
+	return optionFunc(func(o *options) {
+		o.allow = append(o.allow, entries...)
+	})
+}
+
+// WithDenyList 总是限流的限流对象, 条目的格式见 List
+func WithDenyList(entries ...string) Option {
+	return optionFunc(func(o *options) {
+		o.deny = append(o.deny, entries...)
+	})
+}
+
+// WithIPFunc 从限流对象中提取与 CIDR 比较的 IP, 无法提取时返回零值
+func WithIPFunc(fn func(key string) netip.Addr) Option {
+	return optionFunc(func(o *options) {
+		o.ipFunc = fn
+	})
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) Option {
+	return optionFunc(func(opts *options) {
+		opts.observer = o
+	})
+}
+
+// KeyIP 将整个 key 解析为 IP 或 IP:端口, 失败时返回零值
+func KeyIP(key string) netip.Addr {
+	if addr, err := netip.ParseAddr(key); err == nil {
+		return addr
+	}
+	if ap, err := netip.ParseAddrPort(key); err == nil {
+		return ap.Addr()
+	}
+	return netip.Addr{}
+}
+
+func (a *AccessLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := a.limit(ctx, key)
+	observer.Notify(ctx, a.observer, key, limited, err)
+	return limited, err
+}
+
+func (a *AccessLimiter) limit(ctx context.Context, key string) (bool, error) {
+	ls := a.lists.Load()
+	if ls.err != nil {
+		return false, ls.err
+	}
+	addr := a.ipFunc(key)
+	if ls.deny.Match(key, addr) {
+		return true, nil
+	}
+	if ls.allow.Match(key, addr) {
+		return false, nil
+	}
+	return a.l.Limit(ctx, key)
+}
+
+// Reload 替换允许名单与拒绝名单, 正在进行的 Limit 使用旧的名单.
+// 有无效的条目时返回 limiter.ErrInvalidConfig 并保留原来的名单
+func (a *AccessLimiter) Reload(allow, deny []string) error {
+	allowList, err := ParseList(allow...)
+	if err != nil {
+		return err
+	}
+	denyList, err := ParseList(deny...)
+	if err != nil {
+		return err
+	}
+	a.lists.Store(&lists{allow: allowList, deny: denyList})
+	return nil
+}
+
+// Lists 返回当前的允许名单与拒绝名单
+func (a *AccessLimiter) Lists() (allow, deny []string) {
+	ls := a.lists.Load()
+	return ls.allow.Entries(), ls.deny.Entries()
+}
@@ -0,0 +1,142 @@
+package accesslimit
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+func TestAccessLimiter_Limit(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) limiter.Limiter
+		opts    []Option
+		key     string
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "allow",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				return limitermocks.NewMockLimiter(ctrl)
+			},
+			opts: []Option{WithAllowList("10.0.0.0/8")},
+			key:  "10.0.0.1",
+		},
+		{
+			name: "deny",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				return limitermocks.NewMockLimiter(ctrl)
+			},
+			opts: []Option{WithDenyList("203.0.113.0/24")},
+			key:  "203.0.113.7",
+			want: true,
+		},
+		{
+			// 拒绝名单优先
+			name: "deny_over_allow",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				return limitermocks.NewMockLimiter(ctrl)
+			},
+			opts: []Option{WithAllowList("10.0.0.0/8"), WithDenyList("10.0.0.13")},
+			key:  "10.0.0.13",
+			want: true,
+		},
+		{
+			name: "not_listed",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "10.0.0.1").Return(true, nil)
+				return l
+			},
+			opts: []Option{WithAllowList("192.168.0.0/16")},
+			key:  "10.0.0.1",
+			want: true,
+		},
+		{
+			name: "limiter_error",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, limiter.ErrBackendUnavailable)
+				return l
+			},
+			key:     "foo",
+			wantErr: limiter.ErrBackendUnavailable,
+		},
+		{
+			name: "ip_func",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				return limitermocks.NewMockLimiter(ctrl)
+			},
+			opts: []Option{
+				WithAllowList("10.0.0.0/8"),
+				WithIPFunc(func(key string) netip.Addr {
+					return KeyIP(strings.TrimPrefix(key, "login:"))
+				}),
+			},
+			key: "login:10.0.0.1",
+		},
+		{
+			name: "invalid_config",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				return limitermocks.NewMockLimiter(ctrl)
+			},
+			opts:    []Option{WithAllowList("10.0.0.0/8"), WithDenyList("10.0.0.0/40")},
+			key:     "10.0.0.1",
+			wantErr: limiter.ErrInvalidConfig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			a := NewAccessLimiter(tt.mock(ctrl), tt.opts...)
+			got, err := a.Limit(context.Background(), tt.key)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAccessLimiter_Reload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	l := limitermocks.NewMockLimiter(ctrl)
+	a := NewAccessLimiter(l, WithDenyList("10.0.0.0/8"))
+
+	got, err := a.Limit(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	require.NoError(t, a.Reload([]string{"10.0.0.0/8"}, nil))
+	got, err = a.Limit(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	// 无效的名单不会替换原来的名单
+	assert.ErrorIs(t, a.Reload(nil, []string{"10.0.0.0/8", "10.0.0.0/33"}), limiter.ErrInvalidConfig)
+	allow, deny := a.Lists()
+	assert.Equal(t, []string{"10.0.0.0/8"}, allow)
+	assert.Nil(t, deny)
+	got, err = a.Limit(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	// 修正创建时无效的名单
+	a = NewAccessLimiter(l, WithDenyList("10.0.0.0/33"))
+	_, err = a.Limit(ctx, "10.0.0.1")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	require.NoError(t, a.Reload(nil, []string{"10.0.0.0/8"}))
+	got, err = a.Limit(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, got)
+}
@@ -0,0 +1,105 @@
+package accesslimit
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/udugong/limiter/internal/errs"
+)
+
+// List 匹配限流对象的名单, 由 ParseList 生成. 支持 3 种条目:
+//   - 以 * 结尾的前缀, 例如 "probe:*" 匹配所有以 "probe:" 开头的限流对象
+//   - IPv4/IPv6 的 CIDR 或 IP 地址, 例如 "10.0.0.0/8", "2001:db8::/32", "192.168.1.1",
+//     只与从限流对象中提取的 IP 比较
+//   - 其他的条目与限流对象完全相等时匹配, 包括 "/api/login"、"tenant/a" 这样 "/" 之前不是 IP 的条目
+type List struct {
+	entries  []string
+	exact    map[string]struct{}
+	prefixes []string
+	cidrs    []netip.Prefix
+}
+
+// ParseList 解析名单的条目, 忽略空白的条目.
+// 条目 "/" 之前是 IP 但不是有效的 CIDR 时返回 limiter.ErrInvalidConfig, 例如 "10.0.0.0/33"
+func ParseList(entries ...string) (*List, error) {
+	l := &List{
+		exact: make(map[string]struct{}),
+	}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		l.entries = append(l.entries, e)
+		switch {
+		case strings.HasSuffix(e, "*"):
+			l.prefixes = append(l.prefixes, strings.TrimSuffix(e, "*"))
+		case looksLikePrefix(e):
+			p, err := netip.ParsePrefix(e)
+			if err != nil {
+				return nil, errs.InvalidConfig("无效的 CIDR %q: %v", e, err)
+			}
+			l.cidrs = append(l.cidrs, unmapPrefix(p).Masked())
+		default:
+			if addr, err := netip.ParseAddr(e); err == nil {
+				addr = addr.Unmap()
+				l.cidrs = append(l.cidrs, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			l.exact[e] = struct{}{}
+		}
+	}
+	return l, nil
+}
+
+// looksLikePrefix e 的 "/" 之前是否是 IP, 是则按 CIDR 解析, 否则按完整的限流对象匹配
+func looksLikePrefix(e string) bool {
+	i := strings.IndexByte(e, '/')
+	if i < 0 {
+		return false
+	}
+	_, err := netip.ParseAddr(e[:i])
+	return err == nil
+}
+
+// unmapPrefix 将 ::ffff:0:0/96 之内的前缀转换为 IPv4 的前缀, 与 Unmap 之后的 IP 比较
+func unmapPrefix(p netip.Prefix) netip.Prefix {
+	addr := p.Addr()
+	if !addr.Is4In6() || p.Bits() < 96 {
+		return p
+	}
+	return netip.PrefixFrom(addr.Unmap(), p.Bits()-96)
+}
+
+// Match key 或 addr 匹配名单中的任意一个条目时返回 true. addr 无效时只比较 key
+func (l *List) Match(key string, addr netip.Addr) bool {
+	if l == nil {
+		return false
+	}
+	if _, ok := l.exact[key]; ok {
+		return true
+	}
+	for _, p := range l.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range l.cidrs {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries 返回名单的条目
+func (l *List) Entries() []string {
+	if l == nil {
+		return nil
+	}
+	return append([]string(nil), l.entries...)
+}
@@ -0,0 +1,79 @@
+package accesslimit
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+)
+
+func TestList_Match(t *testing.T) {
+	l, err := ParseList("probe", "health:*", "10.0.0.0/8", " 192.168.1.1 ", "2001:db8::/32", "::ffff:172.16.0.0/108", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"probe", "health:*", "10.0.0.0/8", "192.168.1.1", "2001:db8::/32", "::ffff:172.16.0.0/108"},
+		l.Entries())
+
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "exact", key: "probe", want: true},
+		{name: "exact_mismatch", key: "probe2"},
+		{name: "prefix", key: "health:lb1", want: true},
+		{name: "prefix_mismatch", key: "healthz"},
+		{name: "ipv4_cidr", key: "10.1.2.3", want: true},
+		{name: "ipv4_cidr_mismatch", key: "11.1.2.3"},
+		{name: "ipv4", key: "192.168.1.1", want: true},
+		{name: "ipv4_mismatch", key: "192.168.1.2"},
+		{name: "ipv4_mapped", key: "::ffff:10.0.0.1", want: true},
+		{name: "ipv6_cidr", key: "2001:db8:1::1", want: true},
+		{name: "ipv6_cidr_mismatch", key: "2001:db9::1"},
+		{name: "mapped_cidr", key: "172.16.1.1", want: true},
+		{name: "ip_port", key: "10.0.0.1:8080", want: true},
+		{name: "ipv6_port", key: "[2001:db8::1]:8080", want: true},
+		// 不是 IP 的 key 不与 CIDR 比较
+		{name: "not_ip", key: "10.0.0.1-user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, l.Match(tt.key, KeyIP(tt.key)))
+		})
+	}
+}
+
+// "/" 之前不是 IP 的条目按完整的限流对象匹配
+func TestList_MatchPath(t *testing.T) {
+	l, err := ParseList("/api/login", "tenant/a", "/static/*")
+	require.NoError(t, err)
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "path", key: "/api/login", want: true},
+		{name: "path_mismatch", key: "/api/logout"},
+		{name: "tenant", key: "tenant/a", want: true},
+		{name: "tenant_mismatch", key: "tenant/b"},
+		{name: "path_prefix", key: "/static/app.js", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, l.Match(tt.key, KeyIP(tt.key)))
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	_, err := ParseList("10.0.0.0/33")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	_, err = ParseList("10.0.0.1/abc")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+
+	var l *List
+	assert.False(t, l.Match("foo", netip.MustParseAddr("10.0.0.1")))
+	assert.Nil(t, l.Entries())
+}
@@ -0,0 +1,11 @@
+-- 活跃请求数
+local key = KEYS[1]
+-- 为正时减少活跃请求数, 为负时增加
+local delta = tonumber(ARGV[1])
+
+local count = tonumber(redis.call('GET', key) or '0') - delta
+if count < 0 then
+    count = 0
+end
+redis.call('SET', key, count)
+return count
@@ -2,30 +2,122 @@ package activelimit
 
 import (
 	"context"
-	"errors"
 	"sync/atomic"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
 )
 
 type LocalActiveLimiter struct {
-	maxActive int64
+	maxActive atomic.Int64
 	count     atomic.Int64
+	observer  limiter.Observer
 }
 
-func NewLocalActiveLimiter(maxActive int64) *LocalActiveLimiter {
-	return &LocalActiveLimiter{
-		maxActive: maxActive,
+func NewLocalActiveLimiter(maxActive int64, opts ...LocalOption) *LocalActiveLimiter {
+	l := &LocalActiveLimiter{}
+	l.maxActive.Store(maxActive)
+	for _, opt := range opts {
+		opt.applyLocal(l)
 	}
+	return l
+}
+
+type LocalOption interface {
+	applyLocal(*LocalActiveLimiter)
+}
+
+// CommonOption 同时适用于 LocalActiveLimiter 与 RedisActiveLimiter
+type CommonOption interface {
+	LocalOption
+	RedisOption
+}
+
+type observerOption struct {
+	observer limiter.Observer
 }
 
-func (l *LocalActiveLimiter) Limit(_ context.Context, _ string) (bool, error) {
+func (o observerOption) applyLocal(l *LocalActiveLimiter) {
+	l.observer = o.observer
+}
+
+func (o observerOption) apply(r *RedisActiveLimiter) {
+	r.observer = o.observer
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) CommonOption {
+	return observerOption{observer: o}
+}
+
+func (l *LocalActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
 	count := l.count.Add(1)
-	return count > l.maxActive, nil
+	limited := count > l.maxActive.Load()
+	observer.Notify(ctx, l.observer, key, limited, nil)
+	return limited, nil
+}
+
+// LimitMany 依次判断多个限流对象. 本地限流器不区分限流对象
+func (l *LocalActiveLimiter) LimitMany(ctx context.Context, keys []string) ([]bool, error) {
+	res := make([]bool, len(keys))
+	for i, key := range keys {
+		res[i], _ = l.Limit(ctx, key)
+	}
+	return res, nil
+}
+
+// DecrMany 依次减少多个限流对象的活跃请求数
+func (l *LocalActiveLimiter) DecrMany(ctx context.Context, keys []string) error {
+	var err error
+	for _, key := range keys {
+		if e := l.Decr(ctx, key); e != nil {
+			err = e
+		}
+	}
+	return err
 }
 
-func (l *LocalActiveLimiter) Decr(_ context.Context, _ string) error {
+func (l *LocalActiveLimiter) Decr(ctx context.Context, key string) error {
 	v := l.count.Add(-1)
+	var err error
 	if v < 0 {
-		return errors.New("错误使用 LocalActiveLimiter.Decr")
+		err = errs.OverRelease("LocalActiveLimiter")
+	}
+	observer.NotifyRelease(ctx, l.observer, key, err)
+	return err
+}
+
+// Inspect 查询活跃请求数. 本地限流器不区分限流对象
+func (l *LocalActiveLimiter) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	return limiter.NewState(l.maxActive.Load(), l.count.Load()), nil
+}
+
+// Reset 活跃请求数清零. 之后正在处理的请求调用 Decr 会返回 limiter.ErrOverRelease
+func (l *LocalActiveLimiter) Reset(_ context.Context, _ string) error {
+	l.count.Store(0)
+	return nil
+}
+
+// Adjust 活跃请求数减少 delta, 最少为 0
+func (l *LocalActiveLimiter) Adjust(_ context.Context, _ string, delta int64) error {
+	for {
+		old := l.count.Load()
+		v := old - delta
+		if v < 0 {
+			v = 0
+		}
+		if l.count.CompareAndSwap(old, v) {
+			return nil
+		}
+	}
+}
+
+// SetLimit 修改最大活跃请求数, 已经超过的活跃请求不受影响
+func (l *LocalActiveLimiter) SetLimit(maxActive int64) error {
+	if maxActive < 0 {
+		return errs.InvalidConfig("maxActive 不能小于0, 实际为 %d", maxActive)
 	}
+	l.maxActive.Store(maxActive)
 	return nil
 }
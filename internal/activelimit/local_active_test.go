@@ -2,10 +2,11 @@ package activelimit
 
 import (
 	"context"
-	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/udugong/limiter"
 )
 
 func TestLocalActiveLimiter_Limit(t *testing.T) {
@@ -45,7 +46,7 @@ func TestLocalActiveLimiter_Limit(t *testing.T) {
 			tt.before(t)
 			defer tt.after(t)
 			got, err := l.Limit(context.Background(), "")
-			assert.Equal(t, tt.wantErr, err)
+			assert.ErrorIs(t, err, tt.wantErr)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -78,7 +79,7 @@ func TestLocalActiveLimiter_Decr(t *testing.T) {
 			after: func(t *testing.T) {
 				l.count.Store(0)
 			},
-			wantErr: errors.New("错误使用 LocalActiveLimiter.Decr"),
+			wantErr: limiter.ErrOverRelease,
 		},
 	}
 	for _, tt := range tests {
@@ -86,11 +87,20 @@ func TestLocalActiveLimiter_Decr(t *testing.T) {
 			tt.before(t)
 			defer tt.after(t)
 			err := l.Decr(context.Background(), "")
-			assert.Equal(t, tt.wantErr, err)
+			assert.ErrorIs(t, err, tt.wantErr)
 		})
 	}
 }
 
+func TestLocalActiveLimiter_LimitMany(t *testing.T) {
+	l := NewLocalActiveLimiter(2)
+	got, err := l.LimitMany(context.Background(), []string{"ip", "user", "tenant"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+	assert.NoError(t, l.DecrMany(context.Background(), []string{"ip", "user", "tenant"}))
+	assert.ErrorIs(t, l.DecrMany(context.Background(), []string{"ip"}), limiter.ErrOverRelease)
+}
+
 func TestLocalActiveLimiter_Lifecycle(t *testing.T) {
 	l := NewLocalActiveLimiter(1)
 	tests := []struct {
@@ -135,12 +145,107 @@ func TestLocalActiveLimiter_Lifecycle(t *testing.T) {
 				return false, l.Decr(context.Background(), "")
 			},
 			want:    false,
-			wantErr: errors.New("错误使用 LocalActiveLimiter.Decr"),
+			wantErr: limiter.ErrOverRelease,
 		},
 	}
 	for _, tt := range tests {
 		got, err := tt.op()
-		assert.Equalf(t, tt.wantErr, err, "%s: failed", tt.name)
+		assert.ErrorIsf(t, err, tt.wantErr, "%s: failed", tt.name)
 		assert.Equalf(t, tt.want, got, "%s: failed", tt.name)
 	}
 }
+
+// countObserver 统计各类事件的次数
+type countObserver struct {
+	limiter.NopObserver
+	allow, limit, errs, release int
+}
+
+func (c *countObserver) OnAllow(context.Context, string) { c.allow++ }
+
+func (c *countObserver) OnLimit(context.Context, string) { c.limit++ }
+
+func (c *countObserver) OnError(context.Context, string, error) { c.errs++ }
+
+func (c *countObserver) OnRelease(context.Context, string) { c.release++ }
+
+func TestLocalActiveLimiter_Observer(t *testing.T) {
+	o := &countObserver{}
+	l := NewLocalActiveLimiter(1, WithObserver(o))
+	ctx := context.Background()
+	_, _ = l.Limit(ctx, "")
+	_, _ = l.Limit(ctx, "")
+	_ = l.Decr(ctx, "")
+	_ = l.Decr(ctx, "")
+	_ = l.Decr(ctx, "")
+	assert.Equal(t, &countObserver{allow: 1, limit: 1, errs: 1, release: 2}, o)
+}
+
+func TestLocalActiveLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocalActiveLimiter(2)
+	for i := 0; i < 3; i++ {
+		_, _ = l.Limit(ctx, "")
+	}
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+	}{
+		{
+			name: "inspect",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 2, Used: 3, Remaining: 0},
+		},
+		{
+			name: "grant",
+			op:   func() error { return l.Adjust(ctx, "", 2) },
+			want: limiter.State{Limit: 2, Used: 1, Remaining: 1},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return l.Adjust(ctx, "", -1) },
+			want: limiter.State{Limit: 2, Used: 2, Remaining: 0},
+		},
+		{
+			// 活跃请求数最少为 0
+			name: "grant_beyond_used",
+			op:   func() error { return l.Adjust(ctx, "", 5) },
+			want: limiter.State{Limit: 2, Used: 0, Remaining: 2},
+		},
+		{
+			name: "deduct_from_zero",
+			op:   func() error { return l.Adjust(ctx, "", -1) },
+			want: limiter.State{Limit: 2, Used: 1, Remaining: 1},
+		},
+		{
+			name: "reset",
+			op:   func() error { return l.Reset(ctx, "") },
+			want: limiter.State{Limit: 2, Used: 0, Remaining: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.op())
+			got, err := l.Inspect(ctx, "")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	// 清零之后正在处理的请求释放时返回错误
+	assert.ErrorIs(t, l.Decr(ctx, ""), limiter.ErrOverRelease)
+}
+
+func TestLocalActiveLimiter_SetLimit(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocalActiveLimiter(1)
+	got, _ := l.Limit(ctx, "")
+	assert.False(t, got)
+	got, _ = l.Limit(ctx, "")
+	assert.True(t, got)
+
+	assert.NoError(t, l.SetLimit(3))
+	got, _ = l.Limit(ctx, "")
+	assert.False(t, got)
+	assert.ErrorIs(t, l.SetLimit(-1), limiter.ErrInvalidConfig)
+}
@@ -2,38 +2,200 @@ package activelimit
 
 import (
 	"context"
+	_ "embed"
 	"errors"
+	"sync/atomic"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/ctxutil"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+	"github.com/udugong/limiter/internal/rediskey"
 )
 
+//go:embed active_adjust.lua
+var luaActiveAdjust string
+
+var activeAdjustScript = redis.NewScript(luaActiveAdjust)
+
 type RedisActiveLimiter struct {
-	maxActive int64
+	maxActive atomic.Int64
 	cli       redis.Cmdable
+	keys      rediskey.Builder
+	observer  limiter.Observer
 }
 
-func NewRedisActiveLimiter(maxActive int64, cli redis.Cmdable) *RedisActiveLimiter {
-	return &RedisActiveLimiter{
-		maxActive: maxActive,
-		cli:       cli,
+func NewRedisActiveLimiter(maxActive int64, cli redis.Cmdable, opts ...RedisOption) *RedisActiveLimiter {
+	r := &RedisActiveLimiter{
+		cli: cli,
 	}
+	r.maxActive.Store(maxActive)
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	return r
+}
+
+type RedisOption interface {
+	apply(*RedisActiveLimiter)
+}
+
+type redisOptionFunc func(*RedisActiveLimiter)
+
+func (f redisOptionFunc) apply(limiter *RedisActiveLimiter) {
+	f(limiter)
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀
+func WithKeyPrefix(prefix string) RedisOption {
+	return redisOptionFunc(func(limiter *RedisActiveLimiter) {
+		limiter.keys.Prefix = prefix
+	})
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster
+func WithHashTag() RedisOption {
+	return redisOptionFunc(func(limiter *RedisActiveLimiter) {
+		limiter.keys.HashTag = true
+	})
+}
+
+// WithKeySuffix 在 redis 上的 key 后加上算法的后缀 "active", 多个算法共用 redis 时避免 key 冲突.
+// 不设置时与之前的版本使用同一个 key, 开启后之前的计数不再生效
+func WithKeySuffix() RedisOption {
+	return redisOptionFunc(func(limiter *RedisActiveLimiter) {
+		limiter.keys.Suffix = true
+	})
 }
 
 func (r *RedisActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
-	count, err := r.cli.Incr(ctx, key).Result()
+	count, err := r.cli.Incr(ctx, r.keys.AlgoKey(key, rediskey.SuffixActive)).Result()
+	err = errs.Backend(err)
+	limited := err == nil && count > r.maxActive.Load()
+	observer.Notify(ctx, r.observer, key, limited, err)
+	return limited, err
+}
+
+// LimitMany 在一次往返中判断多个限流对象, 每个限流对象的活跃请求数都会增加1.
+// 返回错误时, 已经增加的活跃请求数会被撤销, 调用方不需要调用 DecrMany
+func (r *RedisActiveLimiter) LimitMany(ctx context.Context, keys []string) ([]bool, error) {
+	redisKeys := make([]string, len(keys))
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			redisKeys[i] = r.keys.AlgoKey(key, rediskey.SuffixActive)
+			cmds[i] = pipe.Incr(ctx, redisKeys[i])
+		}
+		return nil
+	})
+	err = errs.Backend(err)
 	if err != nil {
-		return false, err
+		if rerr := r.rollback(ctx, redisKeys, cmds); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+		for _, key := range keys {
+			observer.Notify(ctx, r.observer, key, false, err)
+		}
+		return nil, err
+	}
+	res := make([]bool, len(keys))
+	maxActive := r.maxActive.Load()
+	for i, cmd := range cmds {
+		res[i] = cmd.Val() > maxActive
+		observer.Notify(ctx, r.observer, keys[i], res[i], nil)
 	}
-	return count > r.maxActive, nil
+	return res, nil
 }
 
-func (r *RedisActiveLimiter) Decr(ctx context.Context, key string) error {
-	count, err := r.cli.Decr(ctx, key).Result()
+// rollback 撤销 pipeline 中已经成功的 INCR, redisKeys 与 cmds 一一对应.
+// 调用方的 ctx 可能已经结束, 使用不会结束的 ctx
+func (r *RedisActiveLimiter) rollback(ctx context.Context, redisKeys []string, cmds []*redis.IntCmd) error {
+	var keys []string
+	for i, cmd := range cmds {
+		if cmd != nil && cmd.Err() == nil {
+			keys = append(keys, redisKeys[i])
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	ctx = ctxutil.WithoutCancel(ctx)
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Decr(ctx, key)
+		}
+		return nil
+	})
+	return errs.Backend(err)
+}
+
+// DecrMany 在一次往返中减少多个限流对象的活跃请求数
+func (r *RedisActiveLimiter) DecrMany(ctx context.Context, keys []string) error {
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Decr(ctx, r.keys.AlgoKey(key, rediskey.SuffixActive))
+		}
+		return nil
+	})
+	err = errs.Backend(err)
 	if err != nil {
+		for _, key := range keys {
+			observer.NotifyRelease(ctx, r.observer, key, err)
+		}
 		return err
 	}
-	if count < 0 {
-		return errors.New("错误使用 RedisActiveLimiter.Decr")
+	for i, cmd := range cmds {
+		var keyErr error
+		if cmd.Val() < 0 {
+			keyErr = errs.OverRelease("RedisActiveLimiter")
+			err = keyErr
+		}
+		observer.NotifyRelease(ctx, r.observer, keys[i], keyErr)
+	}
+	return err
+}
+
+func (r *RedisActiveLimiter) Decr(ctx context.Context, key string) error {
+	count, err := r.cli.Decr(ctx, r.keys.AlgoKey(key, rediskey.SuffixActive)).Result()
+	err = errs.Backend(err)
+	if err == nil && count < 0 {
+		err = errs.OverRelease("RedisActiveLimiter")
+	}
+	observer.NotifyRelease(ctx, r.observer, key, err)
+	return err
+}
+
+// Inspect 查询活跃请求数
+func (r *RedisActiveLimiter) Inspect(ctx context.Context, key string) (limiter.State, error) {
+	count, err := r.cli.Get(ctx, r.keys.AlgoKey(key, rediskey.SuffixActive)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return limiter.NewState(r.maxActive.Load(), 0), nil
+	}
+	if err != nil {
+		return limiter.State{}, errs.Backend(err)
+	}
+	return limiter.NewState(r.maxActive.Load(), count), nil
+}
+
+// Reset 活跃请求数清零. 之后正在处理的请求调用 Decr 会返回 limiter.ErrOverRelease
+func (r *RedisActiveLimiter) Reset(ctx context.Context, key string) error {
+	return errs.Backend(r.cli.Del(ctx, r.keys.AlgoKey(key, rediskey.SuffixActive)).Err())
+}
+
+// Adjust 活跃请求数减少 delta, 最少为 0
+func (r *RedisActiveLimiter) Adjust(ctx context.Context, key string, delta int64) error {
+	err := activeAdjustScript.Run(ctx, r.cli, []string{r.keys.AlgoKey(key, rediskey.SuffixActive)}, delta).Err()
+	return errs.Backend(err)
+}
+
+// SetLimit 修改最大活跃请求数, 只对当前实例生效
+func (r *RedisActiveLimiter) SetLimit(maxActive int64) error {
+	if maxActive < 0 {
+		return errs.InvalidConfig("maxActive 不能小于0, 实际为 %d", maxActive)
 	}
+	r.maxActive.Store(maxActive)
 	return nil
 }
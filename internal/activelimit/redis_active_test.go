@@ -4,16 +4,25 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
+	"github.com/udugong/limiter"
 	"github.com/udugong/limiter/internal/mocks/redismocks"
+	"github.com/udugong/limiter/internal/rediskey"
+	"github.com/udugong/limiter/internal/redistest"
+	"github.com/udugong/limiter/internal/slidewindowlimit"
 )
 
-const testKey = "active_limiter_test"
+const (
+	testKey = "active_limiter_test"
+	// testRedisKey testKey 在 redis 上的 key, 默认不加后缀
+	testRedisKey = testKey
+)
 
 func TestRedisActiveLimiter_Limit(t *testing.T) {
 	tests := []struct {
@@ -28,7 +37,7 @@ func TestRedisActiveLimiter_Limit(t *testing.T) {
 				cmd := redismocks.NewMockCmdable(ctrl)
 				res := redis.NewIntCmd(context.Background())
 				res.SetVal(1)
-				cmd.EXPECT().Incr(gomock.Any(), testKey).Return(res)
+				cmd.EXPECT().Incr(gomock.Any(), testRedisKey).Return(res)
 				return cmd
 			},
 			want:    false,
@@ -40,7 +49,7 @@ func TestRedisActiveLimiter_Limit(t *testing.T) {
 				cmd := redismocks.NewMockCmdable(ctrl)
 				res := redis.NewIntCmd(context.Background())
 				res.SetVal(2)
-				cmd.EXPECT().Incr(gomock.Any(), testKey).Return(res)
+				cmd.EXPECT().Incr(gomock.Any(), testRedisKey).Return(res)
 				return cmd
 			},
 			want:    true,
@@ -52,11 +61,11 @@ func TestRedisActiveLimiter_Limit(t *testing.T) {
 				cmd := redismocks.NewMockCmdable(ctrl)
 				res := redis.NewIntCmd(context.Background())
 				res.SetErr(errors.New("mock redis error"))
-				cmd.EXPECT().Incr(gomock.Any(), testKey).Return(res)
+				cmd.EXPECT().Incr(gomock.Any(), testRedisKey).Return(res)
 				return cmd
 			},
 			want:    false,
-			wantErr: errors.New("mock redis error"),
+			wantErr: limiter.ErrBackendUnavailable,
 		},
 	}
 	for _, tt := range tests {
@@ -65,7 +74,7 @@ func TestRedisActiveLimiter_Limit(t *testing.T) {
 			defer ctrl.Finish()
 			l := NewRedisActiveLimiter(1, tt.mock(ctrl))
 			got, err := l.Limit(context.Background(), testKey)
-			assert.Equal(t, tt.wantErr, err)
+			assert.ErrorIs(t, err, tt.wantErr)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -83,7 +92,7 @@ func TestRedisActiveLimiter_Decr(t *testing.T) {
 				cmd := redismocks.NewMockCmdable(ctrl)
 				res := redis.NewIntCmd(context.Background())
 				res.SetVal(0)
-				cmd.EXPECT().Decr(gomock.Any(), testKey).Return(res)
+				cmd.EXPECT().Decr(gomock.Any(), testRedisKey).Return(res)
 				return cmd
 			},
 			wantErr: nil,
@@ -94,10 +103,10 @@ func TestRedisActiveLimiter_Decr(t *testing.T) {
 				cmd := redismocks.NewMockCmdable(ctrl)
 				res := redis.NewIntCmd(context.Background())
 				res.SetVal(-1)
-				cmd.EXPECT().Decr(gomock.Any(), testKey).Return(res)
+				cmd.EXPECT().Decr(gomock.Any(), testRedisKey).Return(res)
 				return cmd
 			},
-			wantErr: errors.New("错误使用 RedisActiveLimiter.Decr"),
+			wantErr: limiter.ErrOverRelease,
 		},
 		{
 			name: "redis_error",
@@ -105,10 +114,10 @@ func TestRedisActiveLimiter_Decr(t *testing.T) {
 				cmd := redismocks.NewMockCmdable(ctrl)
 				res := redis.NewIntCmd(context.Background())
 				res.SetErr(errors.New("mock redis error"))
-				cmd.EXPECT().Decr(gomock.Any(), testKey).Return(res)
+				cmd.EXPECT().Decr(gomock.Any(), testRedisKey).Return(res)
 				return cmd
 			},
-			wantErr: errors.New("mock redis error"),
+			wantErr: limiter.ErrBackendUnavailable,
 		},
 	}
 	for _, tt := range tests {
@@ -117,7 +126,59 @@ func TestRedisActiveLimiter_Decr(t *testing.T) {
 			defer ctrl.Finish()
 			l := NewRedisActiveLimiter(1, tt.mock(ctrl))
 			err := l.Decr(context.Background(), testKey)
-			assert.Equal(t, tt.wantErr, err)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRedisActiveLimiter_Key(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []RedisOption
+		wantKey string
+	}{
+		{
+			name:    "raw",
+			wantKey: testRedisKey,
+		},
+		{
+			name:    "prefix",
+			opts:    []RedisOption{WithKeyPrefix("limiter")},
+			wantKey: "limiter:" + testRedisKey,
+		},
+		{
+			// redis cluster
+			name:    "hash_tag",
+			opts:    []RedisOption{WithKeyPrefix("limiter"), WithHashTag()},
+			wantKey: "limiter:{" + testKey + "}",
+		},
+		{
+			name:    "suffix",
+			opts:    []RedisOption{WithKeySuffix()},
+			wantKey: testKey + ":active",
+		},
+		{
+			name:    "prefix_hash_tag_suffix",
+			opts:    []RedisOption{WithKeyPrefix("limiter"), WithHashTag(), WithKeySuffix()},
+			wantKey: "limiter:{" + testKey + "}:active",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			incr := redis.NewIntCmd(context.Background())
+			incr.SetVal(1)
+			cmd.EXPECT().Incr(gomock.Any(), tt.wantKey).Return(incr)
+			decr := redis.NewIntCmd(context.Background())
+			decr.SetVal(0)
+			cmd.EXPECT().Decr(gomock.Any(), tt.wantKey).Return(decr)
+			l := NewRedisActiveLimiter(1, cmd, tt.opts...)
+			got, err := l.Limit(context.Background(), testKey)
+			assert.NoError(t, err)
+			assert.False(t, got)
+			assert.NoError(t, l.Decr(context.Background(), testKey))
 		})
 	}
 }
@@ -167,22 +228,243 @@ func TestRedisActiveLimiter_Lifecycle(t *testing.T) {
 				return false, l.Decr(context.Background(), testKey)
 			},
 			want:    false,
-			wantErr: errors.New("错误使用 RedisActiveLimiter.Decr"),
+			wantErr: limiter.ErrOverRelease,
 		},
 	}
-	err := cli.Del(context.Background(), testKey).Err()
+	err := cli.Del(context.Background(), testRedisKey).Err()
 	require.NoError(t, err)
-	defer cli.Del(context.Background(), testKey)
+	defer cli.Del(context.Background(), testRedisKey)
 	for _, tt := range tests {
 		got, err := tt.op()
-		assert.Equalf(t, tt.wantErr, err, "%s: failed", tt.name)
+		assert.ErrorIsf(t, err, tt.wantErr, "%s: failed", tt.name)
 		assert.Equalf(t, tt.want, got, "%s: failed", tt.name)
 	}
 }
 
+func TestRedisActiveLimiter_LimitMany(t *testing.T) {
+	cli := initRedis()
+	l := NewRedisActiveLimiter(1, cli)
+	keys := []string{"many_ip", "many_user", "many_ip"}
+	err := cli.Del(context.Background(), "many_ip", "many_user").Err()
+	require.NoError(t, err)
+	defer cli.Del(context.Background(), "many_ip", "many_user")
+
+	got, err := l.LimitMany(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+	assert.NoError(t, l.DecrMany(context.Background(), keys))
+	assert.ErrorIs(t, l.DecrMany(context.Background(), keys[:1]), limiter.ErrOverRelease)
+}
+
+// 只有过度释放的限流对象通知错误
+func TestRedisActiveLimiter_DecrManyObserver(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	o := &countObserver{}
+	l := NewRedisActiveLimiter(1, cli, WithObserver(o))
+	require.NoError(t, cli.Del(ctx, "decr_a", "decr_b", "decr_c").Err())
+	defer cli.Del(ctx, "decr_a", "decr_b", "decr_c")
+	require.NoError(t, cli.Set(ctx, "decr_b", 1, 0).Err())
+	require.NoError(t, cli.Set(ctx, "decr_c", 1, 0).Err())
+
+	err := l.DecrMany(ctx, []string{"decr_a", "decr_b", "decr_c"})
+	assert.ErrorIs(t, err, limiter.ErrOverRelease)
+	assert.Equal(t, &countObserver{errs: 1, release: 2}, o)
+}
+
+// fakePipeliner 按 key 返回预设结果的 pipeline, 记录 DECR 的 key
+type fakePipeliner struct {
+	redis.Pipeliner
+	incr  map[string]error
+	decrs []string
+}
+
+func (p *fakePipeliner) Incr(ctx context.Context, key string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "incr", key)
+	if err := p.incr[key]; err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(1)
+	}
+	return cmd
+}
+
+func (p *fakePipeliner) Decr(ctx context.Context, key string) *redis.IntCmd {
+	p.decrs = append(p.decrs, key)
+	return redis.NewIntCmd(ctx, "decr", key)
+}
+
+// pipeline 部分失败时撤销已经成功的 INCR
+func TestRedisActiveLimiter_LimitManyPartialFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	mockErr := errors.New("mock redis error")
+	pipe := &fakePipeliner{incr: map[string]error{"b": mockErr}}
+	run := func(_ context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+		require.NoError(t, fn(pipe))
+		return nil, nil
+	}
+	gomock.InOrder(
+		cmd.EXPECT().Pipelined(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+				_, _ = run(ctx, fn)
+				return nil, mockErr
+			}),
+		cmd.EXPECT().Pipelined(gomock.Any(), gomock.Any()).DoAndReturn(run),
+	)
+	l := NewRedisActiveLimiter(1, cmd)
+	got, err := l.LimitMany(context.Background(), []string{"a", "b", "c"})
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.Nil(t, got)
+	assert.Equal(t, []string{"a", "c"}, pipe.decrs)
+}
+
+// redis cluster 上不同的限流对象不在同一个 slot, pipeline 中每个命令只能有一个 key
+func TestRedisActiveLimiter_LimitManyCluster(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	active := map[string]int64{}
+	pipe := &redistest.Pipeliner{Reply: func(c redis.Cmder) {
+		key := redistest.Keys(c)[0]
+		if c.Name() == "incr" {
+			active[key]++
+		} else {
+			active[key]--
+		}
+		c.(*redis.IntCmd).SetVal(active[key])
+	}}
+	cmd.EXPECT().Pipelined(gomock.Any(), gomock.Any()).DoAndReturn(pipe.Pipelined).Times(2)
+	l := NewRedisActiveLimiter(1, cmd)
+	keys := []string{"many_ip", "many_user", "many_ip"}
+	require.False(t, rediskey.SameSlot("many_ip", "many_user"))
+
+	got, err := l.LimitMany(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+	assert.NoError(t, l.DecrMany(context.Background(), keys))
+	assert.Equal(t, map[string]int64{"many_ip": 0, "many_user": 0}, active)
+	for _, c := range pipe.Cmds {
+		assert.Len(t, redistest.Keys(c), 1)
+		assert.NoError(t, redistest.CheckSlot(c))
+	}
+}
+
+// 可选的集成测试, localhost:16379 不可用时跳过
+func TestRedisActiveLimiter_LimitManyLiveCluster(t *testing.T) {
+	ctx := context.Background()
+	cli := redistest.LiveClusterClient(t, "localhost:16379")
+	l := NewRedisActiveLimiter(1, cli)
+	keys := []string{"many_ip", "many_user", "many_ip"}
+	for _, k := range []string{"many_ip", "many_user"} {
+		require.NoError(t, cli.Del(ctx, k).Err())
+		defer cli.Del(ctx, k)
+	}
+
+	got, err := l.LimitMany(ctx, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+	assert.NoError(t, l.DecrMany(ctx, keys))
+}
+
+// 同一个限流对象同时用于滑动窗口与活跃请求数限流, 加上后缀后 key 不会冲突
+func TestRedisActiveLimiter_SharedRedis(t *testing.T) {
+	cli := initRedis()
+	const key = "shared_key_test"
+	active := NewRedisActiveLimiter(1, cli, WithKeyPrefix("limiter"), WithKeySuffix())
+	window := slidewindowlimit.NewRedisSlidingWindowLimiter(cli, time.Second, 1,
+		slidewindowlimit.WithKeyPrefix("limiter"), slidewindowlimit.WithKeySuffix())
+	err := cli.Del(context.Background(), "limiter:"+key+":active", "limiter:"+key+":sw").Err()
+	require.NoError(t, err)
+	defer cli.Del(context.Background(), "limiter:"+key+":active", "limiter:"+key+":sw")
+
+	got, err := window.Limit(context.Background(), key)
+	assert.NoError(t, err)
+	assert.False(t, got)
+	got, err = active.Limit(context.Background(), key)
+	assert.NoError(t, err)
+	assert.False(t, got)
+	assert.NoError(t, active.Decr(context.Background(), key))
+}
+
 func initRedis() redis.Cmdable {
 	redisClient := redis.NewClient(&redis.Options{
 		Addr: "localhost:16379",
 	})
 	return redisClient
 }
+
+func TestRedisActiveLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	r := NewRedisActiveLimiter(2, cli)
+	require.NoError(t, cli.Del(ctx, testRedisKey).Err())
+	defer cli.Del(ctx, testRedisKey)
+
+	got, err := r.Inspect(ctx, testKey)
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 0, Remaining: 2}, got)
+
+	for i := 0; i < 3; i++ {
+		_, err = r.Limit(ctx, testKey)
+		require.NoError(t, err)
+	}
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+	}{
+		{
+			name: "inspect",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 2, Used: 3, Remaining: 0},
+		},
+		{
+			name: "grant",
+			op:   func() error { return r.Adjust(ctx, testKey, 2) },
+			want: limiter.State{Limit: 2, Used: 1, Remaining: 1},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return r.Adjust(ctx, testKey, -1) },
+			want: limiter.State{Limit: 2, Used: 2, Remaining: 0},
+		},
+		{
+			// 活跃请求数最少为 0
+			name: "grant_beyond_used",
+			op:   func() error { return r.Adjust(ctx, testKey, 5) },
+			want: limiter.State{Limit: 2, Used: 0, Remaining: 2},
+		},
+		{
+			name: "deduct_from_zero",
+			op:   func() error { return r.Adjust(ctx, testKey, -1) },
+			want: limiter.State{Limit: 2, Used: 1, Remaining: 1},
+		},
+		{
+			name: "reset",
+			op:   func() error { return r.Reset(ctx, testKey) },
+			want: limiter.State{Limit: 2, Used: 0, Remaining: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.op())
+			got, err := r.Inspect(ctx, testKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRedisActiveLimiter_AdminError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	getErr := redis.NewStringCmd(context.Background())
+	getErr.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().Get(gomock.Any(), testRedisKey).Return(getErr)
+	r := NewRedisActiveLimiter(2, cmd)
+	_, err := r.Inspect(context.Background(), testKey)
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+}
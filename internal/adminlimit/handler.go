@@ -0,0 +1,295 @@
+package adminlimit
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+)
+
+// maxBodySize 请求体的最大长度
+const maxBodySize = 1 << 16
+
+// Action 管理接口的操作, 用于鉴权
+type Action string
+
+const (
+	// ActionList 列出注册的限流器
+	ActionList Action = "list"
+	// ActionInspect 查询限流对象的状态
+	ActionInspect Action = "inspect"
+	// ActionReset 清空限流对象已使用的额度
+	ActionReset Action = "reset"
+	// ActionAdjust 调整限流对象的额度
+	ActionAdjust Action = "adjust"
+	// ActionSetLimit 修改限流器的阈值
+	ActionSetLimit Action = "set_limit"
+)
+
+// ErrUnauthorized Authorizer 返回该错误时响应 401, 返回其他错误时响应 403
+var ErrUnauthorized = errors.New("adminlimit: 未认证")
+
+// Authorizer 对管理接口的请求鉴权, 返回 error 时拒绝请求.
+// name 为操作的限流器的名称, ActionList 时为 ""
+type Authorizer interface {
+	Authorize(r *http.Request, action Action, name string) error
+}
+
+// AuthorizerFunc 函数形式的 Authorizer
+type AuthorizerFunc func(r *http.Request, action Action, name string) error
+
+func (f AuthorizerFunc) Authorize(r *http.Request, action Action, name string) error {
+	return f(r, action, name)
+}
+
+// TokenAuthorizer 要求请求头 Authorization 为 "Bearer <token>"
+func TokenAuthorizer(token string) Authorizer {
+	want := []byte("Bearer " + token)
+	return AuthorizerFunc(func(r *http.Request, _ Action, _ string) error {
+		got := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(got, want) != 1 {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+}
+
+// Handler 管理限流器的 http.Handler, 接口如下, key 为查询参数, 响应均为 JSON:
+//
+//	GET  /limiters                    列出注册的限流器
+//	GET  /limiters/{name}?key=        查询限流对象的状态
+//	POST /limiters/{name}/reset?key=  清空限流对象已使用的额度
+//	POST /limiters/{name}/adjust?key= 调整限流对象的额度, 请求体为 {"delta": n}, n 的绝对值不能超过阈值
+//	PUT  /limiters/{name}/limit       修改阈值, 请求体为 {"limit": n}, 限流器需要实现 limiter.LimitSetter
+//
+// 除列出限流器以外的接口都返回操作之后限流对象的 limiter.State
+//
+// 挂载在其他路径下时使用 http.StripPrefix 去掉前缀
+type Handler struct {
+	auth Authorizer
+
+	lock     sync.RWMutex
+	limiters map[string]limiter.Admin
+}
+
+// NewHandler auth 为 nil 时拒绝所有请求
+func NewHandler(auth Authorizer) *Handler {
+	return &Handler{
+		auth:     auth,
+		limiters: make(map[string]limiter.Admin),
+	}
+}
+
+// Register 以 name 注册限流器. name 不能为空或包含 "/", 不能重复
+func (h *Handler) Register(name string, a limiter.Admin) error {
+	if name == "" || strings.Contains(name, "/") {
+		return errs.InvalidConfig("限流器的名称 %q 不合法", name)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, ok := h.limiters[name]; ok {
+		return errs.InvalidConfig("限流器 %q 已经注册", name)
+	}
+	h.limiters[name] = a
+	return nil
+}
+
+// Info 注册的限流器
+type Info struct {
+	Name string `json:"name"`
+	// SetLimit 是否可以修改阈值
+	SetLimit bool `json:"set_limit"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "limiters" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, errors.New("adminlimit: 路径不存在"))
+		return
+	}
+	if len(parts) == 1 {
+		h.serveList(w, r)
+		return
+	}
+	name, op := parts[1], ""
+	if len(parts) == 3 {
+		op = parts[2]
+	}
+	switch op {
+	case "":
+		h.serveLimiter(w, r, http.MethodGet, ActionInspect, name, h.inspect)
+	case "reset":
+		h.serveLimiter(w, r, http.MethodPost, ActionReset, name, h.reset)
+	case "adjust":
+		h.serveLimiter(w, r, http.MethodPost, ActionAdjust, name, h.adjust)
+	case "limit":
+		h.serveLimiter(w, r, http.MethodPut, ActionSetLimit, name, h.setLimit)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("adminlimit: 路径不存在"))
+	}
+}
+
+func (h *Handler) serveList(w http.ResponseWriter, r *http.Request) {
+	if !h.allow(w, r, http.MethodGet, ActionList, "") {
+		return
+	}
+	h.lock.RLock()
+	infos := make([]Info, 0, len(h.limiters))
+	for name, a := range h.limiters {
+		_, ok := a.(limiter.LimitSetter)
+		infos = append(infos, Info{Name: name, SetLimit: ok})
+	}
+	h.lock.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	writeJSON(w, http.StatusOK, infos)
+}
+
+type opFunc func(w http.ResponseWriter, r *http.Request, a limiter.Admin)
+
+func (h *Handler) serveLimiter(w http.ResponseWriter, r *http.Request, method string, action Action, name string,
+	op opFunc) {
+	if !h.allow(w, r, method, action, name) {
+		return
+	}
+	h.lock.RLock()
+	a, ok := h.limiters[name]
+	h.lock.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("adminlimit: 限流器 "+name+" 不存在"))
+		return
+	}
+	op(w, r, a)
+}
+
+// allow 先校验方法再鉴权, 以免未授权的请求探测到注册的限流器
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, method string, action Action, name string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("adminlimit: 不支持的方法 "+r.Method))
+		return false
+	}
+	if h.auth == nil {
+		writeError(w, http.StatusForbidden, errors.New("adminlimit: 没有设置 Authorizer"))
+		return false
+	}
+	if err := h.auth.Authorize(r, action, name); err != nil {
+		code := http.StatusForbidden
+		if errors.Is(err, ErrUnauthorized) {
+			code = http.StatusUnauthorized
+		}
+		writeError(w, code, err)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) inspect(w http.ResponseWriter, r *http.Request, a limiter.Admin) {
+	writeState(w, r, a, nil)
+}
+
+func (h *Handler) reset(w http.ResponseWriter, r *http.Request, a limiter.Admin) {
+	writeState(w, r, a, a.Reset(r.Context(), r.URL.Query().Get("key")))
+}
+
+type adjustRequest struct {
+	Delta int64 `json:"delta"`
+}
+
+func (h *Handler) adjust(w http.ResponseWriter, r *http.Request, a limiter.Admin) {
+	var req adjustRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	// 超过阈值的调整没有意义, 而且部分限流器按令牌逐个调整, 过大的 delta 会长时间占用限流器
+	state, err := a.Inspect(r.Context(), key)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	if req.Delta > state.Limit || req.Delta < -state.Limit {
+		writeError(w, http.StatusBadRequest,
+			fmt.Errorf("adminlimit: delta 的绝对值不能超过阈值 %d, 实际为 %d", state.Limit, req.Delta))
+		return
+	}
+	writeState(w, r, a, a.Adjust(r.Context(), key, req.Delta))
+}
+
+type limitRequest struct {
+	Limit *int64 `json:"limit"`
+}
+
+func (h *Handler) setLimit(w http.ResponseWriter, r *http.Request, a limiter.Admin) {
+	s, ok := a.(limiter.LimitSetter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("adminlimit: 限流器不支持修改阈值"))
+		return
+	}
+	var req limitRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Limit == nil {
+		writeError(w, http.StatusBadRequest, errors.New("adminlimit: 缺少 limit"))
+		return
+	}
+	writeState(w, r, a, s.SetLimit(*req.Limit))
+}
+
+// writeState err 为 nil 时查询并返回操作之后的状态
+func writeState(w http.ResponseWriter, r *http.Request, a limiter.Admin, err error) {
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	state, err := a.Inspect(r.Context(), r.URL.Query().Get("key"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, limiter.ErrInvalidConfig):
+		return http.StatusBadRequest
+	case errors.Is(err, limiter.ErrBackendUnavailable),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,264 @@
+package adminlimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/activelimit"
+	"github.com/udugong/limiter/internal/errs"
+)
+
+// stateAdmin 不支持修改阈值的限流器, 按 key 记录已使用的额度
+type stateAdmin struct {
+	used map[string]int64
+	err  error
+}
+
+func (s *stateAdmin) Inspect(_ context.Context, key string) (limiter.State, error) {
+	if s.err != nil {
+		return limiter.State{}, s.err
+	}
+	return limiter.NewState(10, s.used[key]), nil
+}
+
+func (s *stateAdmin) Reset(_ context.Context, key string) error {
+	delete(s.used, key)
+	return s.err
+}
+
+func (s *stateAdmin) Adjust(_ context.Context, key string, delta int64) error {
+	s.used[key] -= delta
+	return s.err
+}
+
+func newTestHandler(t *testing.T) (*Handler, *activelimit.LocalActiveLimiter) {
+	active := activelimit.NewLocalActiveLimiter(2)
+	for i := 0; i < 3; i++ {
+		_, _ = active.Limit(context.Background(), "")
+	}
+	h := NewHandler(TokenAuthorizer("secret"))
+	require.NoError(t, h.Register("active", active))
+	require.NoError(t, h.Register("quota", &stateAdmin{used: map[string]int64{"foo": 4}}))
+	require.NoError(t, h.Register("broken", &stateAdmin{err: errs.Backend(errors.New("mock redis error"))}))
+	return h, active
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "list",
+			method:   http.MethodGet,
+			target:   "/limiters",
+			wantCode: http.StatusOK,
+			wantBody: `[{"name":"active","set_limit":true},{"name":"broken","set_limit":false},` +
+				`{"name":"quota","set_limit":false}]`,
+		},
+		{
+			name:     "inspect",
+			method:   http.MethodGet,
+			target:   "/limiters/quota?key=foo",
+			wantCode: http.StatusOK,
+			wantBody: `{"limit":10,"used":4,"remaining":6}`,
+		},
+		{
+			name:     "reset",
+			method:   http.MethodPost,
+			target:   "/limiters/quota/reset?key=foo",
+			wantCode: http.StatusOK,
+			wantBody: `{"limit":10,"used":0,"remaining":10}`,
+		},
+		{
+			name:     "adjust",
+			method:   http.MethodPost,
+			target:   "/limiters/quota/adjust?key=foo",
+			body:     `{"delta":-3}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"limit":10,"used":3,"remaining":7}`,
+		},
+		{
+			name:     "adjust_beyond_limit",
+			method:   http.MethodPost,
+			target:   "/limiters/quota/adjust?key=foo",
+			body:     `{"delta":11}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"adminlimit: delta 的绝对值不能超过阈值 10, 实际为 11"}`,
+		},
+		{
+			name:     "deduct_beyond_limit",
+			method:   http.MethodPost,
+			target:   "/limiters/quota/adjust?key=foo",
+			body:     `{"delta":-9223372036854775808}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"adminlimit: delta 的绝对值不能超过阈值 10, 实际为 -9223372036854775808"}`,
+		},
+		{
+			name:     "adjust_backend_unavailable",
+			method:   http.MethodPost,
+			target:   "/limiters/broken/adjust?key=foo",
+			body:     `{"delta":1}`,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"error":"后端不可用: mock redis error"}`,
+		},
+		{
+			name:     "set_limit",
+			method:   http.MethodPut,
+			target:   "/limiters/active/limit",
+			body:     `{"limit":5}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"limit":5,"used":3,"remaining":2}`,
+		},
+		{
+			name:     "unauthorized",
+			method:   http.MethodGet,
+			target:   "/limiters",
+			token:    "wrong",
+			wantCode: http.StatusUnauthorized,
+			wantBody: `{"error":"adminlimit: 未认证"}`,
+		},
+		{
+			name:     "not_found",
+			method:   http.MethodGet,
+			target:   "/limiters/none",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"adminlimit: 限流器 none 不存在"}`,
+		},
+		{
+			name:     "unknown_path",
+			method:   http.MethodGet,
+			target:   "/limiters/quota/unknown",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"adminlimit: 路径不存在"}`,
+		},
+		{
+			name:     "method_not_allowed",
+			method:   http.MethodGet,
+			target:   "/limiters/quota/reset",
+			wantCode: http.StatusMethodNotAllowed,
+			wantBody: `{"error":"adminlimit: 不支持的方法 GET"}`,
+		},
+		{
+			name:     "set_limit_not_supported",
+			method:   http.MethodPut,
+			target:   "/limiters/quota/limit",
+			body:     `{"limit":5}`,
+			wantCode: http.StatusNotImplemented,
+			wantBody: `{"error":"adminlimit: 限流器不支持修改阈值"}`,
+		},
+		{
+			name:     "missing_limit",
+			method:   http.MethodPut,
+			target:   "/limiters/active/limit",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"adminlimit: 缺少 limit"}`,
+		},
+		{
+			name:     "invalid_limit",
+			method:   http.MethodPut,
+			target:   "/limiters/active/limit",
+			body:     `{"limit":-1}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"限流器配置不合法: maxActive 不能小于0, 实际为 -1"}`,
+		},
+		{
+			name:     "unknown_field",
+			method:   http.MethodPost,
+			target:   "/limiters/quota/adjust?key=foo",
+			body:     `{"delt":3}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"json: unknown field \"delt\""}`,
+		},
+		{
+			name:     "backend_unavailable",
+			method:   http.MethodGet,
+			target:   "/limiters/broken?key=foo",
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"error":"后端不可用: mock redis error"}`,
+		},
+	}
+	h, _ := newTestHandler(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			token := tt.token
+			if token == "" {
+				token = "secret"
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
+
+func TestHandler_Authorizer(t *testing.T) {
+	var gotAction Action
+	var gotName string
+	h := NewHandler(AuthorizerFunc(func(r *http.Request, action Action, name string) error {
+		gotAction, gotName = action, name
+		// 只读
+		if action != ActionList && action != ActionInspect {
+			return errors.New("只读")
+		}
+		return nil
+	}))
+	require.NoError(t, h.Register("quota", &stateAdmin{used: map[string]int64{}}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/limiters/quota?key=foo", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ActionInspect, gotAction)
+	assert.Equal(t, "quota", gotName)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/limiters/quota/reset?key=foo", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, ActionReset, gotAction)
+
+	// 没有设置 Authorizer 时拒绝所有请求
+	rec = httptest.NewRecorder()
+	NewHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/limiters", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestHandler_Register(t *testing.T) {
+	h := NewHandler(nil)
+	a := &stateAdmin{}
+	assert.NoError(t, h.Register("foo", a))
+	assert.ErrorIs(t, h.Register("foo", a), limiter.ErrInvalidConfig)
+	assert.ErrorIs(t, h.Register("", a), limiter.ErrInvalidConfig)
+	assert.ErrorIs(t, h.Register("foo/bar", a), limiter.ErrInvalidConfig)
+}
+
+func TestHandler_StripPrefix(t *testing.T) {
+	h, active := newTestHandler(t)
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", h))
+	req := httptest.NewRequest(http.MethodPost, "/admin/limiters/active/adjust", strings.NewReader(`{"delta":2}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	state, err := active.Inspect(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 1, Remaining: 1}, state)
+}
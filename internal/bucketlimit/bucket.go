@@ -2,9 +2,11 @@ package bucketlimit
 
 import (
 	"context"
-	"errors"
 	"sync"
 	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/observer"
 )
 
 type Bucket struct {
@@ -13,68 +15,233 @@ type Bucket struct {
 	buckets  chan struct{}
 	closeCh  chan struct{}
 	once     sync.Once
+	clock    limiter.Clock
+	observer limiter.Observer
+
+	// lock 保护 closed, 保证 Close 之后不会再有 Put 开始运行
+	lock   sync.Mutex
+	closed bool
+	// running 正在运行的 Put
+	running sync.WaitGroup
 }
 
 // NewTokenBucket 令牌桶算法
-func NewTokenBucket(interval time.Duration, capacity int) *Bucket {
-	return &Bucket{
+func NewTokenBucket(interval time.Duration, capacity int, opts ...Option) *Bucket {
+	b := &Bucket{
 		interval: interval,
 		buckets:  make(chan struct{}, capacity),
 		closeCh:  make(chan struct{}),
 		once:     sync.Once{},
+		clock:    limiter.SystemClock(),
 	}
+	for _, opt := range opts {
+		opt.apply(b)
+	}
+	return b
 }
 
 // NewLeakyBucket 漏桶算法
-func NewLeakyBucket(interval time.Duration) *Bucket {
-	return &Bucket{
+func NewLeakyBucket(interval time.Duration, opts ...Option) *Bucket {
+	b := &Bucket{
 		interval: interval,
 		buckets:  make(chan struct{}),
 		closeCh:  make(chan struct{}),
 		once:     sync.Once{},
+		clock:    limiter.SystemClock(),
+	}
+	for _, opt := range opts {
+		opt.apply(b)
 	}
+	return b
+}
+
+type Option interface {
+	apply(*Bucket)
+}
+
+type optionFunc func(*Bucket)
+
+func (f optionFunc) apply(b *Bucket) {
+	f(b)
+}
+
+// CommonOption 同时适用于 Bucket、QueueBucket、PriorityBucket 与 WarmUpBucket
+type CommonOption interface {
+	Option
+	QueueOption
+	PriorityOption
+	WarmUpOption
+}
+
+type observerOption struct {
+	observer limiter.Observer
+}
+
+func (o observerOption) apply(b *Bucket) {
+	b.observer = o.observer
+}
+
+func (o observerOption) applyQueue(b *QueueBucket) {
+	b.observer = o.observer
+}
+
+func (o observerOption) applyPriority(b *PriorityBucket) {
+	b.observer = o.observer
+}
+
+func (o observerOption) applyWarmUp(b *WarmUpBucket) {
+	b.observer = o.observer
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+// BlockLimit 在判断结果之外还会通知等待的时间
+func WithObserver(o limiter.Observer) CommonOption {
+	return observerOption{observer: o}
+}
+
+type clockOption struct {
+	clock limiter.Clock
+}
+
+func (o clockOption) apply(b *Bucket) {
+	b.clock = o.clock
+}
+
+func (o clockOption) applyQueue(b *QueueBucket) {
+	b.clock = o.clock
+}
+
+func (o clockOption) applyPriority(b *PriorityBucket) {
+	b.clock = o.clock
+}
+
+func (o clockOption) applyWarmUp(b *WarmUpBucket) {
+	b.clock = o.clock
+}
+
+// WithClock 使用 c 获取当前时间与创建定时器, 默认为 limiter.SystemClock.
+// 测试时可以使用手动推进的 Clock
+func WithClock(c limiter.Clock) CommonOption {
+	return clockOption{clock: c}
 }
 
+// Put 按 interval 往桶里放置, 直到调用 Close.
+// Close 之后调用 Put 会直接返回
 func (b *Bucket) Put() {
-	b.buckets <- struct{}{}
-	ticker := time.NewTicker(b.interval)
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.running.Add(1)
+	b.lock.Unlock()
+	defer b.running.Done()
+
+	if !b.put() {
+		return
+	}
+	ticker := b.clock.NewTicker(b.interval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-b.closeCh:
 			return
-		case <-ticker.C:
-			b.buckets <- struct{}{}
+		case <-ticker.C():
+			if !b.put() {
+				return
+			}
 		}
 	}
 }
 
+// put 桶满时(漏桶总是满的)阻塞直到被取走或被关闭. 被关闭时返回 false
+func (b *Bucket) put() bool {
+	select {
+	case b.buckets <- struct{}{}:
+		return true
+	case <-b.closeCh:
+		return false
+	}
+}
+
+// Close 关闭限流器, 并等待正在运行的 Put 退出
 func (b *Bucket) Close() {
 	b.once.Do(func() {
+		b.lock.Lock()
+		b.closed = true
 		close(b.closeCh)
+		b.lock.Unlock()
 	})
+	b.running.Wait()
+}
+
+func (b *Bucket) BlockLimit(ctx context.Context, key string) (bool, error) {
+	if b.observer == nil {
+		return b.blockLimit(ctx)
+	}
+	start := b.clock.Now()
+	limited, err := b.blockLimit(ctx)
+	observer.NotifyWait(ctx, b.observer, key, b.clock.Now().Sub(start))
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
 }
 
-func (b *Bucket) BlockLimit(ctx context.Context, _ string) (bool, error) {
+func (b *Bucket) blockLimit(ctx context.Context) (bool, error) {
 	select {
 	case <-b.buckets:
 		return false, nil
 	case <-ctx.Done():
 		return true, ctx.Err()
 	case <-b.closeCh:
-		return false, errors.New("限流器被关闭了")
+		return false, limiter.ErrClosed
 	}
 }
 
-func (b *Bucket) Limit(ctx context.Context, _ string) (bool, error) {
+func (b *Bucket) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := b.limit(ctx)
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *Bucket) limit(ctx context.Context) (bool, error) {
 	select {
 	case <-b.buckets:
 		return false, nil
 	case <-ctx.Done():
 		return true, ctx.Err()
 	case <-b.closeCh:
-		return false, errors.New("限流器被关闭了")
+		return false, limiter.ErrClosed
 	default:
 		return true, nil
 	}
 }
+
+// Inspect 查询桶中的令牌数. Used 为已被取走的令牌数, 漏桶的容量为 0
+func (b *Bucket) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	c := int64(cap(b.buckets))
+	return limiter.NewState(c, c-int64(len(b.buckets))), nil
+}
+
+// Reset 放满令牌
+func (b *Bucket) Reset(ctx context.Context, key string) error {
+	return b.Adjust(ctx, key, int64(cap(b.buckets)))
+}
+
+// Adjust delta 为正时放入 delta 个令牌, 最多放满; 为负时取走 -delta 个令牌
+func (b *Bucket) Adjust(_ context.Context, _ string, delta int64) error {
+	for ; delta > 0; delta-- {
+		select {
+		case b.buckets <- struct{}{}:
+		default:
+			return nil
+		}
+	}
+	for ; delta < 0; delta++ {
+		select {
+		case <-b.buckets:
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -2,252 +2,351 @@ package bucketlimit
 
 import (
 	"context"
-	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/fakeclock"
 )
 
+// bucketStep 在上一步之后推进 advance 的时间再判断是否限流
+type bucketStep struct {
+	name    string
+	ctx     context.Context
+	advance time.Duration
+	want    bool
+	wantErr error
+}
+
+// runBucketSteps 依次执行 steps. 推进时间之前等待 Put 创建 ticker, 推进之后等待 Put 读取到期的 ticker,
+// 期望限流时不会被迟到的放置影响. 期望放行时 Put 可能还没有放置, 重试直到放行
+func runBucketSteps(t *testing.T, b *Bucket, clk *fakeclock.Clock,
+	limit func(ctx context.Context, key string) (bool, error), steps []bucketStep) {
+	for _, tt := range steps {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.advance > 0 {
+				clk.BlockUntil(1)
+				clk.Advance(tt.advance)
+				clk.BlockUntilRead()
+			}
+			var got bool
+			var err error
+			if tt.want || tt.wantErr != nil {
+				got, err = limit(tt.ctx, "")
+			} else {
+				require.Eventually(t, func() bool {
+					got, err = limit(tt.ctx, "")
+					return !got
+				}, time.Second, time.Millisecond)
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	t.Run("after_close", func(t *testing.T) {
+		b.Close()
+		got, err := limit(context.Background(), "")
+		assert.Equal(t, false, got)
+		assert.ErrorIs(t, err, limiter.ErrClosed)
+	})
+}
+
 func TestTokenBucket_BlockLimit(t *testing.T) {
-	b := NewTokenBucket(10*time.Millisecond, 2)
+	clk := fakeclock.New(time.Now())
+	b := NewTokenBucket(10*time.Millisecond, 2, WithClock(clk))
 	defer b.Close()
 	go b.Put()
+	// 没有推进时间时不会有新的令牌, 一定超时
 	ctx1, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
 	defer cancel()
-	tests := []struct {
-		name     string
-		ctx      context.Context
-		interval time.Duration
-		want     bool
-		wantErr  error
-	}{
+	runBucketSteps(t, b, clk, b.BlockLimit, []bucketStep{
 		{
-			name:     "normal",
-			ctx:      context.Background(),
-			interval: 2,
-			want:     false,
-			wantErr:  nil,
+			name: "normal",
+			ctx:  context.Background(),
 		},
 		{
-			name:     "another_normal",
-			ctx:      context.Background(),
-			interval: 5,
-			want:     false,
-			wantErr:  nil,
+			name:    "another_normal",
+			ctx:     context.Background(),
+			advance: 10 * time.Millisecond,
 		},
 		{
-			name:     "timeout",
-			ctx:      ctx1,
-			interval: 10,
-			want:     true,
-			wantErr:  context.DeadlineExceeded,
+			name:    "timeout",
+			ctx:     ctx1,
+			want:    true,
+			wantErr: context.DeadlineExceeded,
 		},
 		{
-			name:     "wait_for_token",
-			ctx:      context.Background(),
-			interval: 15,
-			want:     false,
-			wantErr:  nil,
+			name:    "wait_for_token",
+			ctx:     context.Background(),
+			advance: 10 * time.Millisecond,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			<-time.After(tt.interval)
-			got, err := b.BlockLimit(tt.ctx, "")
-			assert.Equal(t, tt.wantErr, err)
-			assert.Equal(t, tt.want, got)
-		})
-	}
-	t.Run("after_close", func(t *testing.T) {
-		b.Close()
-		<-time.After(10)
-		got, err := b.BlockLimit(context.Background(), "")
-		assert.Equal(t, false, got)
-		assert.Equal(t, errors.New("限流器被关闭了"), err)
 	})
 }
 
 func TestLeakyBucket_BlockLimit(t *testing.T) {
-	b := NewLeakyBucket(20 * time.Millisecond)
+	clk := fakeclock.New(time.Now())
+	b := NewLeakyBucket(20*time.Millisecond, WithClock(clk))
 	defer b.Close()
 	go b.Put()
 	ctx1, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
 	defer cancel()
-	tests := []struct {
-		name     string
-		ctx      context.Context
-		interval time.Duration
-		want     bool
-		wantErr  error
-	}{
+	runBucketSteps(t, b, clk, b.BlockLimit, []bucketStep{
 		{
-			name:     "normal",
-			ctx:      context.Background(),
-			interval: 2,
-			want:     false,
-			wantErr:  nil,
+			name: "normal",
+			ctx:  context.Background(),
 		},
 		{
-			name:     "timeout",
-			ctx:      ctx1,
-			interval: 5,
-			want:     true,
-			wantErr:  context.DeadlineExceeded,
+			name:    "timeout",
+			ctx:     ctx1,
+			want:    true,
+			wantErr: context.DeadlineExceeded,
 		},
 		{
-			name:     "wait_for_token",
-			ctx:      context.Background(),
-			interval: 10,
-			want:     false,
-			wantErr:  nil,
+			name:    "wait_for_token",
+			ctx:     context.Background(),
+			advance: 20 * time.Millisecond,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			<-time.After(tt.interval)
-			got, err := b.BlockLimit(tt.ctx, "")
-			assert.Equal(t, tt.wantErr, err)
-			assert.Equal(t, tt.want, got)
-		})
-	}
-	t.Run("after_close", func(t *testing.T) {
-		b.Close()
-		<-time.After(10)
-		got, err := b.BlockLimit(context.Background(), "")
-		assert.Equal(t, false, got)
-		assert.Equal(t, errors.New("限流器被关闭了"), err)
 	})
 }
 
-func TestTokenBucket_Limit(t *testing.T) {
-	b := NewTokenBucket(10*time.Millisecond, 2)
-	defer b.Close()
+// limitSteps 令牌桶与漏桶在 Limit 上的表现相同
+func limitSteps() []bucketStep {
 	ctx1, cancel := context.WithTimeout(context.Background(), 0)
 	defer cancel()
-	go b.Put()
-	tests := []struct {
-		name     string
-		ctx      context.Context
-		interval time.Duration
-		want     bool
-		wantErr  error
-	}{
+	return []bucketStep{
 		{
-			name:     "normal",
-			ctx:      context.Background(),
-			interval: 2,
-			want:     false,
-			wantErr:  nil,
+			name: "normal",
+			ctx:  context.Background(),
 		},
 		{
-			name:     "limited",
-			ctx:      context.Background(),
-			interval: 5,
-			want:     true,
-			wantErr:  nil,
+			name: "limited",
+			ctx:  context.Background(),
+			want: true,
 		},
 		{
-			name:     "timeout",
-			ctx:      ctx1,
-			interval: 10,
-			want:     true,
-			wantErr:  context.DeadlineExceeded,
+			name:    "timeout",
+			ctx:     ctx1,
+			want:    true,
+			wantErr: context.DeadlineExceeded,
 		},
 		{
-			name:     "wait_5_mill_limited",
-			ctx:      context.Background(),
-			interval: 5 * time.Millisecond,
-			want:     true,
-			wantErr:  nil,
+			name:    "wait_5_mill_limited",
+			ctx:     context.Background(),
+			advance: 5 * time.Millisecond,
+			want:    true,
 		},
 		{
-			name:     "wait_for_token",
-			ctx:      context.Background(),
-			interval: 5 * time.Millisecond,
-			want:     false,
-			wantErr:  nil,
+			name:    "wait_for_token",
+			ctx:     context.Background(),
+			advance: 5 * time.Millisecond,
+		},
+	}
+}
+
+func TestTokenBucket_Limit(t *testing.T) {
+	clk := fakeclock.New(time.Now())
+	b := NewTokenBucket(10*time.Millisecond, 2, WithClock(clk))
+	defer b.Close()
+	go b.Put()
+	runBucketSteps(t, b, clk, b.Limit, limitSteps())
+}
+
+func TestLeakyBucket_Limit(t *testing.T) {
+	clk := fakeclock.New(time.Now())
+	b := NewLeakyBucket(10*time.Millisecond, WithClock(clk))
+	defer b.Close()
+	go b.Put()
+	runBucketSteps(t, b, clk, b.Limit, limitSteps())
+}
+
+// eventObserver 记录收到的事件
+type eventObserver struct {
+	limiter.NopObserver
+	events []string
+	waits  int
+}
+
+func (e *eventObserver) OnAllow(context.Context, string) { e.events = append(e.events, "allow") }
+
+func (e *eventObserver) OnLimit(context.Context, string) { e.events = append(e.events, "limit") }
+
+func (e *eventObserver) OnError(context.Context, string, error) { e.events = append(e.events, "error") }
+
+func (e *eventObserver) OnWait(context.Context, string, time.Duration) { e.waits++ }
+
+func TestBucket_Observer(t *testing.T) {
+	o := &eventObserver{}
+	b := NewTokenBucket(time.Hour, 1, WithObserver(o))
+	ctx := context.Background()
+	b.buckets <- struct{}{}
+	_, _ = b.Limit(ctx, "")
+	_, _ = b.Limit(ctx, "")
+	b.buckets <- struct{}{}
+	_, _ = b.BlockLimit(ctx, "")
+	b.Close()
+	_, _ = b.BlockLimit(ctx, "")
+	assert.Equal(t, []string{"allow", "limit", "allow", "error"}, o.events)
+	assert.Equal(t, 2, o.waits)
+}
+
+func TestBucket_Close(t *testing.T) {
+	tests := []struct {
+		name string
+		// bucket 返回的 Bucket 已经在运行 Put, 并且 Put 阻塞在 name 描述的位置
+		bucket func(t *testing.T, clk *fakeclock.Clock) *Bucket
+	}{
+		{
+			// 漏桶没有消费者时 Put 总是阻塞在放置上
+			name: "leaky_bucket_without_consumer",
+			bucket: func(t *testing.T, clk *fakeclock.Clock) *Bucket {
+				b := NewLeakyBucket(time.Millisecond, WithClock(clk))
+				go b.Put()
+				_, err := b.BlockLimit(context.Background(), "")
+				require.NoError(t, err)
+				clk.BlockUntil(1)
+				clk.Advance(time.Millisecond)
+				clk.BlockUntilRead()
+				return b
+			},
+		},
+		{
+			// 令牌桶已满时 Put 阻塞在放置上
+			name: "full_token_bucket",
+			bucket: func(t *testing.T, clk *fakeclock.Clock) *Bucket {
+				b := NewTokenBucket(time.Millisecond, 1, WithClock(clk))
+				go b.Put()
+				clk.BlockUntil(1)
+				clk.Advance(time.Millisecond)
+				clk.BlockUntilRead()
+				return b
+			},
+		},
+		{
+			name: "waiting_for_ticker",
+			bucket: func(t *testing.T, clk *fakeclock.Clock) *Bucket {
+				b := NewTokenBucket(time.Hour, 10, WithClock(clk))
+				go b.Put()
+				clk.BlockUntil(1)
+				return b
+			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			<-time.After(tt.interval)
-			got, err := b.Limit(tt.ctx, "")
-			assert.Equal(t, tt.wantErr, err)
-			assert.Equal(t, tt.want, got)
+			clk := fakeclock.New(time.Now())
+			b := tt.bucket(t, clk)
+			closed := make(chan struct{})
+			go func() {
+				b.Close()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatal("Close 没有返回, Put 泄漏")
+			}
+			// Put 退出时停止 ticker
+			assert.Equal(t, 0, clk.Waiters())
 		})
 	}
-	t.Run("after_close", func(t *testing.T) {
+}
+
+func TestBucket_PutAfterClose(t *testing.T) {
+	b := NewLeakyBucket(time.Millisecond)
+	// 没有运行 Put 时 Close 不会阻塞
+	b.Close()
+	b.Close()
+	done := make(chan struct{})
+	go func() {
+		b.Put()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close 之后 Put 没有返回")
+	}
+}
+
+func TestBucket_NoGoroutineLeak(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		clk := fakeclock.New(time.Now())
+		b := NewLeakyBucket(time.Millisecond, WithClock(clk))
+		tb := NewTokenBucket(time.Millisecond, 1, WithClock(clk))
+		exited := make([]chan struct{}, 0, 2)
+		for _, bucket := range []*Bucket{b, tb} {
+			done := make(chan struct{})
+			exited = append(exited, done)
+			go func(bucket *Bucket) {
+				bucket.Put()
+				close(done)
+			}(bucket)
+		}
+		// 令牌桶放满之后阻塞在放置上
+		clk.BlockUntil(1)
+		clk.Advance(time.Millisecond)
+		clk.BlockUntilRead()
 		b.Close()
-		<-time.After(10)
-		got, err := b.Limit(context.Background(), "")
-		assert.Equal(t, false, got)
-		assert.Equal(t, errors.New("限流器被关闭了"), err)
-	})
+		tb.Close()
+		for _, done := range exited {
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Close 之后 Put 没有退出")
+			}
+		}
+	}
 }
 
-func TestLeakyBucket_Limit(t *testing.T) {
-	b := NewLeakyBucket(10 * time.Millisecond)
+func TestBucket_Admin(t *testing.T) {
+	ctx := context.Background()
+	b := NewTokenBucket(time.Hour, 3)
 	defer b.Close()
-	go b.Put()
-	ctx1, cancel := context.WithTimeout(context.Background(), 0)
-	defer cancel()
 	tests := []struct {
-		name     string
-		ctx      context.Context
-		interval time.Duration
-		want     bool
-		wantErr  error
+		name string
+		op   func() error
+		want limiter.State
 	}{
 		{
-			name:     "normal",
-			ctx:      context.Background(),
-			interval: 2,
-			want:     false,
-			wantErr:  nil,
+			name: "empty",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 3, Used: 3, Remaining: 0},
 		},
 		{
-			name:     "limited",
-			ctx:      context.Background(),
-			interval: 5,
-			want:     true,
-			wantErr:  nil,
+			name: "grant",
+			op:   func() error { return b.Adjust(ctx, "", 2) },
+			want: limiter.State{Limit: 3, Used: 1, Remaining: 2},
 		},
 		{
-			name:     "timeout",
-			ctx:      ctx1,
-			interval: 10,
-			want:     true,
-			wantErr:  context.DeadlineExceeded,
+			name: "grant_beyond_capacity",
+			op:   func() error { return b.Adjust(ctx, "", 5) },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
 		},
 		{
-			name:     "wait_5_mill_limited",
-			ctx:      context.Background(),
-			interval: 5 * time.Millisecond,
-			want:     true,
-			wantErr:  nil,
+			name: "deduct",
+			op:   func() error { return b.Adjust(ctx, "", -2) },
+			want: limiter.State{Limit: 3, Used: 2, Remaining: 1},
 		},
 		{
-			name:     "wait_for_token",
-			ctx:      context.Background(),
-			interval: 5 * time.Millisecond,
-			want:     false,
-			wantErr:  nil,
+			name: "deduct_beyond_tokens",
+			op:   func() error { return b.Adjust(ctx, "", -5) },
+			want: limiter.State{Limit: 3, Used: 3, Remaining: 0},
+		},
+		{
+			name: "reset",
+			op:   func() error { return b.Reset(ctx, "") },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			<-time.After(tt.interval)
-			got, err := b.Limit(tt.ctx, "")
-			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, tt.op())
+			got, err := b.Inspect(ctx, "")
+			assert.NoError(t, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
-	t.Run("after_close", func(t *testing.T) {
-		b.Close()
-		<-time.After(10)
-		got, err := b.Limit(context.Background(), "")
-		assert.Equal(t, false, got)
-		assert.Equal(t, errors.New("限流器被关闭了"), err)
-	})
 }
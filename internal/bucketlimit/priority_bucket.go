@@ -0,0 +1,331 @@
+package bucketlimit
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// Priority 请求的优先级, 数值越大越优先
+type Priority int
+
+const (
+	PriorityLow      Priority = -1
+	PriorityNormal   Priority = 0
+	PriorityHigh     Priority = 1
+	PriorityCritical Priority = 2
+)
+
+type priorityKey struct{}
+
+// WithPriority 在 ctx 中设置请求的优先级
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext 返回 ctx 中的优先级, 没有设置时为 PriorityNormal
+func PriorityFromContext(ctx context.Context) Priority {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok {
+		return PriorityNormal
+	}
+	return p
+}
+
+// PriorityBucket 按优先级分配令牌的令牌桶.
+// 桶中没有令牌时, 等待的请求按优先级从高到低获得令牌, 相同优先级先到先得.
+// 为避免低优先级的请求一直等待, 每等待 aging 的时间优先级提高 1
+type PriorityBucket struct {
+	interval time.Duration
+	capacity int
+	aging    time.Duration
+	clock    limiter.Clock
+	observer limiter.Observer
+
+	lock    sync.Mutex
+	tokens  int
+	waiters waiterHeap
+	seq     uint64
+	closed  bool
+	closeCh chan struct{}
+	running sync.WaitGroup
+}
+
+// NewPriorityBucket 创建按优先级分配令牌的令牌桶. 每 interval 放置一个令牌, 最多存放 capacity 个令牌
+func NewPriorityBucket(interval time.Duration, capacity int, opts ...PriorityOption) *PriorityBucket {
+	b := &PriorityBucket{
+		interval: interval,
+		capacity: capacity,
+		aging:    time.Second,
+		clock:    limiter.SystemClock(),
+		closeCh:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.applyPriority(b)
+	}
+	return b
+}
+
+type PriorityOption interface {
+	applyPriority(*PriorityBucket)
+}
+
+type priorityOptionFunc func(*PriorityBucket)
+
+func (f priorityOptionFunc) applyPriority(b *PriorityBucket) {
+	f(b)
+}
+
+// WithAging 等待的请求每等待 d 优先级提高 1. 默认 1s, d <= 0 时不提高优先级
+func WithAging(d time.Duration) PriorityOption {
+	return priorityOptionFunc(func(b *PriorityBucket) {
+		b.aging = d
+	})
+}
+
+// Put 每隔 interval 放置一个令牌, 直到调用 Close.
+// Close 之后调用 Put 会直接返回
+func (b *PriorityBucket) Put() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.running.Add(1)
+	b.put()
+	b.lock.Unlock()
+	defer b.running.Done()
+
+	ticker := b.clock.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closeCh:
+			return
+		case <-ticker.C():
+			b.lock.Lock()
+			b.put()
+			b.lock.Unlock()
+		}
+	}
+}
+
+// put 令牌优先交给等待的请求, 没有等待的请求时放入桶中. 调用方需要持有锁
+func (b *PriorityBucket) put() {
+	if b.waiters.Len() > 0 {
+		w := heap.Pop(&b.waiters).(*waiter)
+		close(w.ch)
+		return
+	}
+	if b.tokens < b.capacity {
+		b.tokens++
+	}
+}
+
+// Close 关闭限流器, 正在等待的请求返回 limiter.ErrClosed. 会等待正在运行的 Put 退出
+func (b *PriorityBucket) Close() {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.closeCh)
+	}
+	b.lock.Unlock()
+	b.running.Wait()
+}
+
+// Limit 不等待. 有请求在等待时不会插队, 无论优先级
+func (b *PriorityBucket) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := b.limit(ctx)
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *PriorityBucket) limit(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return false, limiter.ErrClosed
+	}
+	if b.tokens > 0 && b.waiters.Len() == 0 {
+		b.tokens--
+		return false, nil
+	}
+	return true, nil
+}
+
+// BlockLimit 使用 ctx 中的优先级等待令牌, 见 WithPriority
+func (b *PriorityBucket) BlockLimit(ctx context.Context, key string) (bool, error) {
+	return b.BlockLimitPriority(ctx, key, PriorityFromContext(ctx))
+}
+
+// BlockLimitPriority 使用优先级 p 等待令牌
+func (b *PriorityBucket) BlockLimitPriority(ctx context.Context, key string, p Priority) (bool, error) {
+	start := b.clock.Now()
+	limited, err := b.blockLimit(ctx, p, start)
+	observer.NotifyWait(ctx, b.observer, key, b.clock.Now().Sub(start))
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *PriorityBucket) blockLimit(ctx context.Context, p Priority, now time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return false, limiter.ErrClosed
+	}
+	if b.tokens > 0 && b.waiters.Len() == 0 {
+		b.tokens--
+		b.lock.Unlock()
+		return false, nil
+	}
+	b.seq++
+	w := &waiter{
+		ch:    make(chan struct{}),
+		score: b.score(p, now),
+		seq:   b.seq,
+	}
+	heap.Push(&b.waiters, w)
+	b.lock.Unlock()
+
+	select {
+	case <-w.ch:
+		return false, nil
+	case <-ctx.Done():
+		if b.remove(w) {
+			return true, ctx.Err()
+		}
+		// 在 Context 结束的同时已获得令牌
+		return false, nil
+	case <-b.closeCh:
+		if b.remove(w) {
+			return false, limiter.ErrClosed
+		}
+		return false, nil
+	}
+}
+
+// score 等待的请求的有效优先级为 p + 已等待的时间/aging.
+// 所有请求随时间提高的速度相同, 因此只需要比较 p*aging - 开始等待的时间, 且结果不随时间变化
+func (b *PriorityBucket) score(p Priority, now time.Time) int64 {
+	if b.aging <= 0 {
+		return int64(p)
+	}
+	return int64(p)*int64(b.aging) - now.UnixNano()
+}
+
+// remove 从等待队列中移除未获得令牌的请求. 已获得令牌时返回 false
+func (b *PriorityBucket) remove(w *waiter) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if w.index < 0 {
+		return false
+	}
+	heap.Remove(&b.waiters, w.index)
+	return true
+}
+
+type waiter struct {
+	ch    chan struct{}
+	score int64
+	seq   uint64
+	// index 在堆中的位置, 出堆后为 -1
+	index int
+}
+
+// waiterHeap score 越大越优先, 相同时 seq 越小越优先
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int {
+	return len(h)
+}
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*h = old[:n-1]
+	return w
+}
+
+// Inspect 查询桶中的令牌数. Used 为已被取走的令牌数
+func (b *PriorityBucket) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return limiter.NewState(int64(b.capacity), int64(b.capacity-b.tokens)), nil
+}
+
+// Reset 放满令牌, 令牌优先交给等待的请求
+func (b *PriorityBucket) Reset(_ context.Context, _ string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.adjust(int64(b.capacity))
+	return nil
+}
+
+// Adjust delta 为正时放入 delta 个令牌, 令牌优先交给等待的请求; 为负时取走 -delta 个令牌
+func (b *PriorityBucket) Adjust(_ context.Context, _ string, delta int64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.adjust(delta)
+	return nil
+}
+
+// adjust 放入的令牌最多交给所有等待的请求并放满, 多余的部分被丢弃. 调用方需要持有锁
+func (b *PriorityBucket) adjust(delta int64) {
+	if room := int64(b.capacity - b.tokens + b.waiters.Len()); delta > room {
+		delta = room
+	}
+	for ; delta > 0; delta-- {
+		b.put()
+	}
+	b.tokens += int(delta)
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+}
+
+// SetLimit 修改桶的容量, 超出容量的令牌被丢弃
+func (b *PriorityBucket) SetLimit(capacity int64) error {
+	if capacity < 0 {
+		return errs.InvalidConfig("capacity 不能小于0, 实际为 %d", capacity)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.capacity = int(capacity)
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package bucketlimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+)
+
+// putOnce 代替 Put 放置一个令牌
+func putOnce(b *PriorityBucket) {
+	b.lock.Lock()
+	b.put()
+	b.lock.Unlock()
+}
+
+func waitWaiters(t *testing.T, b *PriorityBucket, n int) {
+	require.Eventually(t, func() bool {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		return b.waiters.Len() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, PriorityNormal, PriorityFromContext(ctx))
+	assert.Equal(t, PriorityHigh, PriorityFromContext(WithPriority(ctx, PriorityHigh)))
+}
+
+func TestPriorityBucket_Order(t *testing.T) {
+	base := time.UnixMilli(1695571200000)
+	type request struct {
+		name     string
+		priority Priority
+		// waited 开始等待的时间相对 base 的偏移
+		waited time.Duration
+	}
+	tests := []struct {
+		name      string
+		aging     time.Duration
+		requests  []request
+		wantOrder []string
+	}{
+		{
+			name:  "by_priority",
+			aging: time.Second,
+			requests: []request{
+				{name: "bulk", priority: PriorityLow},
+				{name: "normal", priority: PriorityNormal},
+				{name: "health", priority: PriorityCritical},
+				{name: "paid", priority: PriorityHigh},
+			},
+			wantOrder: []string{"health", "paid", "normal", "bulk"},
+		},
+		{
+			name:  "same_priority_fifo",
+			aging: time.Second,
+			requests: []request{
+				{name: "a", priority: PriorityNormal},
+				{name: "b", priority: PriorityNormal},
+				{name: "c", priority: PriorityNormal},
+			},
+			wantOrder: []string{"a", "b", "c"},
+		},
+		{
+			// 低优先级的请求已经等待了 3s, 有效优先级为 2, 高于刚到达的高优先级请求
+			name:  "aging",
+			aging: time.Second,
+			requests: []request{
+				{name: "bulk", priority: PriorityLow, waited: 0},
+				{name: "paid", priority: PriorityHigh, waited: 3*time.Second + time.Millisecond},
+			},
+			wantOrder: []string{"bulk", "paid"},
+		},
+		{
+			name:  "no_aging",
+			aging: 0,
+			requests: []request{
+				{name: "bulk", priority: PriorityLow, waited: 0},
+				{name: "paid", priority: PriorityHigh, waited: time.Hour},
+			},
+			wantOrder: []string{"paid", "bulk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewPriorityBucket(time.Hour, 1, WithAging(tt.aging))
+			defer b.Close()
+			var lock sync.Mutex
+			var order []string
+			var wg sync.WaitGroup
+			for i, req := range tt.requests {
+				wg.Add(1)
+				req := req
+				go func() {
+					defer wg.Done()
+					limited, err := b.blockLimit(context.Background(), req.priority, base.Add(req.waited))
+					assert.NoError(t, err)
+					assert.False(t, limited)
+					lock.Lock()
+					order = append(order, req.name)
+					lock.Unlock()
+				}()
+				waitWaiters(t, b, i+1)
+			}
+			for i := range tt.requests {
+				putOnce(b)
+				require.Eventually(t, func() bool {
+					lock.Lock()
+					defer lock.Unlock()
+					return len(order) == i+1
+				}, time.Second, time.Millisecond)
+			}
+			wg.Wait()
+			assert.Equal(t, tt.wantOrder, order)
+		})
+	}
+}
+
+func TestPriorityBucket_Limit(t *testing.T) {
+	b := NewPriorityBucket(time.Hour, 2)
+	ctx := context.Background()
+	putOnce(b)
+	putOnce(b)
+	putOnce(b)
+
+	// 最多存放 2 个令牌
+	for _, want := range []bool{false, false, true} {
+		got, err := b.Limit(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// 有请求在等待时不会插队
+	go func() {
+		_, _ = b.BlockLimit(ctx, "")
+	}()
+	waitWaiters(t, b, 1)
+	b.lock.Lock()
+	b.tokens = 1
+	b.lock.Unlock()
+	got, err := b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	b.Close()
+	got, err = b.Limit(ctx, "")
+	assert.ErrorIs(t, err, limiter.ErrClosed)
+	assert.False(t, got)
+}
+
+func TestPriorityBucket_BlockLimit(t *testing.T) {
+	b := NewPriorityBucket(time.Hour, 1)
+	go b.Put()
+
+	// Put 开始时放置一个令牌
+	got, err := b.BlockLimitPriority(context.Background(), "", PriorityLow)
+	require.NoError(t, err)
+	require.False(t, got)
+
+	// 超时的请求离开等待队列
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	got, err = b.BlockLimit(WithPriority(ctx, PriorityHigh), "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, got)
+	waitWaiters(t, b, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := b.BlockLimit(context.Background(), "")
+		assert.ErrorIs(t, err, limiter.ErrClosed)
+		assert.False(t, got)
+	}()
+	waitWaiters(t, b, 1)
+	b.Close()
+	<-done
+	waitWaiters(t, b, 0)
+}
+
+func TestPriorityBucket_Admin(t *testing.T) {
+	b := NewPriorityBucket(time.Hour, 2)
+	defer b.Close()
+	ctx := context.Background()
+
+	// 令牌优先交给等待的请求
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.BlockLimit(ctx, "")
+		done <- err
+	}()
+	waitWaiters(t, b, 1)
+	require.NoError(t, b.Reset(ctx, ""))
+	assert.NoError(t, <-done)
+	got, err := b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 1, Remaining: 1}, got)
+
+	require.NoError(t, b.Adjust(ctx, "", -5))
+	got, err = b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 2, Remaining: 0}, got)
+}
+
+// 很大的 delta 在放满之后立即返回, 不会长时间持有锁
+func TestPriorityBucket_AdjustHugeDelta(t *testing.T) {
+	b := NewPriorityBucket(time.Hour, 2)
+	defer b.Close()
+	ctx := context.Background()
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.BlockLimit(ctx, "")
+		done <- err
+	}()
+	waitWaiters(t, b, 1)
+
+	adjusted := make(chan error, 1)
+	go func() {
+		adjusted <- b.Adjust(ctx, "", math.MaxInt64)
+	}()
+	select {
+	case err := <-adjusted:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Adjust 没有返回")
+	}
+	assert.NoError(t, <-done)
+	got, err := b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 0, Remaining: 2}, got)
+}
+
+func TestPriorityBucket_SetLimit(t *testing.T) {
+	b := NewPriorityBucket(time.Hour, 3)
+	defer b.Close()
+	ctx := context.Background()
+	require.NoError(t, b.Reset(ctx, ""))
+
+	// 超出容量的令牌被丢弃
+	require.NoError(t, b.SetLimit(1))
+	got, err := b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 1, Used: 0, Remaining: 1}, got)
+	assert.ErrorIs(t, b.SetLimit(-1), limiter.ErrInvalidConfig)
+}
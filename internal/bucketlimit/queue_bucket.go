@@ -0,0 +1,270 @@
+package bucketlimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// QueueInfo 排队的情况
+type QueueInfo struct {
+	// Position 在队列中的位置, 从 1 开始. 0 表示不需要排队
+	Position int
+	// Delay 预计的等待时间
+	Delay time.Duration
+}
+
+// QueueBucket 按先进先出顺序放行的漏桶.
+// 每隔 interval 放行队首的一个请求, 队列为空时保留一次放行的机会给下一个到达的请求.
+// 队列最多容纳 maxQueue 个等待的请求, 队列已满或预计等待时间超过 Context 的 deadline 时立即限流
+type QueueBucket struct {
+	interval time.Duration
+	maxQueue int
+	clock    limiter.Clock
+	observer limiter.Observer
+	onQueue  func(ctx context.Context, key string, info QueueInfo)
+
+	lock sync.Mutex
+	// waiters 等待放行的请求, 元素为 chan struct{}, 放行时关闭
+	waiters *list.List
+	// ready 队列为空时是否有一次放行的机会
+	ready bool
+	// lastLeak 上一次放行的时间, 用于估算等待时间
+	lastLeak time.Time
+	closed   bool
+	closeCh  chan struct{}
+	running  sync.WaitGroup
+}
+
+// NewQueueBucket 创建先进先出的漏桶. interval 每个请求之间的间隔, maxQueue 最多等待的请求数
+func NewQueueBucket(interval time.Duration, maxQueue int, opts ...QueueOption) *QueueBucket {
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	b := &QueueBucket{
+		interval: interval,
+		maxQueue: maxQueue,
+		waiters:  list.New(),
+		clock:    limiter.SystemClock(),
+		closeCh:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.applyQueue(b)
+	}
+	b.lastLeak = b.clock.Now()
+	return b
+}
+
+type QueueOption interface {
+	applyQueue(*QueueBucket)
+}
+
+type queueOptionFunc func(*QueueBucket)
+
+func (f queueOptionFunc) applyQueue(b *QueueBucket) {
+	f(b)
+}
+
+// WithOnQueue 请求开始排队时调用 fn, 可用于向调用方报告排队的位置与预计的等待时间
+func WithOnQueue(fn func(ctx context.Context, key string, info QueueInfo)) QueueOption {
+	return queueOptionFunc(func(b *QueueBucket) {
+		b.onQueue = fn
+	})
+}
+
+// Put 每隔 interval 放行一个请求, 直到调用 Close.
+// Close 之后调用 Put 会直接返回
+func (b *QueueBucket) Put() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.running.Add(1)
+	b.leak(b.clock.Now())
+	b.lock.Unlock()
+	defer b.running.Done()
+
+	ticker := b.clock.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closeCh:
+			return
+		case now := <-ticker.C():
+			b.lock.Lock()
+			b.leak(now)
+			b.lock.Unlock()
+		}
+	}
+}
+
+// leak 放行队首的请求, 队列为空时保留放行的机会. 调用方需要持有锁
+func (b *QueueBucket) leak(now time.Time) {
+	b.lastLeak = now
+	front := b.waiters.Front()
+	if front == nil {
+		b.ready = true
+		return
+	}
+	b.waiters.Remove(front)
+	close(front.Value.(chan struct{}))
+}
+
+// Close 关闭限流器, 正在排队的请求返回 limiter.ErrClosed. 会等待正在运行的 Put 退出
+func (b *QueueBucket) Close() {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.closeCh)
+	}
+	b.lock.Unlock()
+	b.running.Wait()
+}
+
+// Stat 返回新到达的请求需要排队的情况
+func (b *QueueBucket) Stat() QueueInfo {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.ready && b.waiters.Len() == 0 {
+		return QueueInfo{}
+	}
+	return b.infoAt(b.waiters.Len()+1, b.clock.Now())
+}
+
+// infoAt 排在第 position 位的请求的等待时间. 调用方需要持有锁
+func (b *QueueBucket) infoAt(position int, now time.Time) QueueInfo {
+	delay := b.lastLeak.Add(time.Duration(position) * b.interval).Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return QueueInfo{Position: position, Delay: delay}
+}
+
+func (b *QueueBucket) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := b.limit(ctx)
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *QueueBucket) limit(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return false, limiter.ErrClosed
+	}
+	// 已经有请求在排队时不能插队
+	if b.ready && b.waiters.Len() == 0 {
+		b.ready = false
+		return false, nil
+	}
+	return true, nil
+}
+
+func (b *QueueBucket) BlockLimit(ctx context.Context, key string) (bool, error) {
+	start := b.clock.Now()
+	limited, err := b.blockLimit(ctx, key)
+	observer.NotifyWait(ctx, b.observer, key, b.clock.Now().Sub(start))
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *QueueBucket) blockLimit(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return false, limiter.ErrClosed
+	}
+	if b.ready && b.waiters.Len() == 0 {
+		b.ready = false
+		b.lock.Unlock()
+		return false, nil
+	}
+	if b.waiters.Len() >= b.maxQueue {
+		b.lock.Unlock()
+		return true, nil
+	}
+	now := b.clock.Now()
+	info := b.infoAt(b.waiters.Len()+1, now)
+	// 预计等待时间超过 deadline 时不必排队
+	if deadline, ok := ctx.Deadline(); ok && now.Add(info.Delay).After(deadline) {
+		b.lock.Unlock()
+		return true, context.DeadlineExceeded
+	}
+	ch := make(chan struct{})
+	elem := b.waiters.PushBack(ch)
+	b.lock.Unlock()
+
+	if b.onQueue != nil {
+		b.onQueue(ctx, key, info)
+	}
+
+	select {
+	case <-ch:
+		return false, nil
+	case <-ctx.Done():
+		if b.dequeue(elem, ch) {
+			return true, ctx.Err()
+		}
+		// 在 Context 结束的同时已被放行
+		return false, nil
+	case <-b.closeCh:
+		if b.dequeue(elem, ch) {
+			return false, limiter.ErrClosed
+		}
+		return false, nil
+	}
+}
+
+// dequeue 从队列中移除未被放行的请求. 已被放行时返回 false
+func (b *QueueBucket) dequeue(elem *list.Element, ch chan struct{}) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	select {
+	case <-ch:
+		return false
+	default:
+		b.waiters.Remove(elem)
+		return true
+	}
+}
+
+// Inspect Limit 为最多等待的请求数, Used 为正在等待的请求数
+func (b *QueueBucket) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return limiter.NewState(int64(b.maxQueue), int64(b.waiters.Len())), nil
+}
+
+// Reset 立即放行队首的请求, 队列为空时保留放行的机会
+func (b *QueueBucket) Reset(ctx context.Context, key string) error {
+	return b.Adjust(ctx, key, 1)
+}
+
+// Adjust delta 为正时立即放行 delta 次; 为负时取消保留的放行机会
+func (b *QueueBucket) Adjust(_ context.Context, _ string, delta int64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if delta < 0 {
+		b.ready = false
+		return nil
+	}
+	for i := int64(0); i < delta; i++ {
+		if b.waiters.Len() == 0 {
+			b.ready = true
+			break
+		}
+		b.leak(b.clock.Now())
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package bucketlimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+)
+
+// leakOnce 代替 Put 放行一次
+func leakOnce(b *QueueBucket) {
+	b.lock.Lock()
+	b.leak(time.Now())
+	b.lock.Unlock()
+}
+
+// waitQueued 等待队列中有 n 个请求
+func waitQueued(t *testing.T, b *QueueBucket, n int) {
+	require.Eventually(t, func() bool {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		return b.waiters.Len() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestQueueBucket_Limit(t *testing.T) {
+	b := NewQueueBucket(time.Hour, 10)
+	ctx := context.Background()
+
+	// 还没有放行的机会
+	got, err := b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	leakOnce(b)
+	got, err = b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	// 放行的机会只有一次
+	got, err = b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	got, err = b.Limit(canceled, "")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, got)
+
+	b.Close()
+	got, err = b.Limit(ctx, "")
+	assert.ErrorIs(t, err, limiter.ErrClosed)
+	assert.False(t, got)
+}
+
+func TestQueueBucket_FIFO(t *testing.T) {
+	b := NewQueueBucket(time.Hour, 10)
+	defer b.Close()
+
+	const n = 5
+	var lock sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		i := i
+		go func() {
+			defer wg.Done()
+			limited, err := b.BlockLimit(context.Background(), "")
+			assert.NoError(t, err)
+			assert.False(t, limited)
+			lock.Lock()
+			order = append(order, i)
+			lock.Unlock()
+		}()
+		// 保证按 i 的顺序排队
+		waitQueued(t, b, i+1)
+	}
+	for i := 0; i < n; i++ {
+		leakOnce(b)
+		// 每次只放行一个请求
+		waitQueued(t, b, n-i-1)
+		require.Eventually(t, func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(order) == i+1
+		}, time.Second, time.Millisecond)
+	}
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+}
+
+func TestQueueBucket_BlockLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxQueue int
+		// queued 已经在排队的请求数
+		queued  int
+		ctx     func() (context.Context, context.CancelFunc)
+		want    bool
+		wantErr error
+	}{
+		{
+			name:     "queue_is_full",
+			maxQueue: 2,
+			queued:   2,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			want: true,
+		},
+		{
+			name:     "no_queue",
+			maxQueue: 0,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			want: true,
+		},
+		{
+			// 预计等待 1h, 立即限流
+			name:     "delay_exceeds_deadline",
+			maxQueue: 2,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Minute)
+			},
+			want:    true,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewQueueBucket(time.Hour, tt.maxQueue)
+			for i := 0; i < tt.queued; i++ {
+				go func() {
+					_, _ = b.BlockLimit(context.Background(), "")
+				}()
+				waitQueued(t, b, i+1)
+			}
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			got, err := b.BlockLimit(ctx, "")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+			// 被拒绝的请求不会进入队列
+			waitQueued(t, b, tt.queued)
+			b.Close()
+		})
+	}
+}
+
+func TestQueueBucket_CancelWhileQueued(t *testing.T) {
+	b := NewQueueBucket(time.Hour, 10)
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := b.BlockLimit(ctx, "")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.True(t, got)
+	}()
+	waitQueued(t, b, 1)
+	cancel()
+	<-done
+	// 取消的请求离开队列, 放行的机会留给下一个请求
+	waitQueued(t, b, 0)
+	leakOnce(b)
+	got, err := b.Limit(context.Background(), "")
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestQueueBucket_Close(t *testing.T) {
+	b := NewQueueBucket(time.Hour, 10)
+	go b.Put()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 第一个请求使用 Put 开始时的放行机会, 第二个请求排队
+		_, _ = b.BlockLimit(context.Background(), "")
+		got, err := b.BlockLimit(context.Background(), "")
+		assert.ErrorIs(t, err, limiter.ErrClosed)
+		assert.False(t, got)
+	}()
+	waitQueued(t, b, 1)
+	// 排队的请求返回 limiter.ErrClosed, 且 Close 等待 Put 退出
+	b.Close()
+	<-done
+	waitQueued(t, b, 0)
+}
+
+func TestQueueBucket_OnQueue(t *testing.T) {
+	var infos []QueueInfo
+	var lock sync.Mutex
+	b := NewQueueBucket(time.Hour, 10, WithOnQueue(func(ctx context.Context, key string, info QueueInfo) {
+		lock.Lock()
+		defer lock.Unlock()
+		infos = append(infos, info)
+	}))
+	leakOnce(b)
+	assert.Equal(t, QueueInfo{}, b.Stat())
+
+	// 第一个请求使用放行的机会, 不需要排队
+	got, err := b.BlockLimit(context.Background(), "")
+	require.NoError(t, err)
+	require.False(t, got)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, _ = b.BlockLimit(context.Background(), "")
+		}()
+		waitQueued(t, b, i+1)
+	}
+	stat := b.Stat()
+	assert.Equal(t, 3, stat.Position)
+	assert.InDelta(t, 3*time.Hour, stat.Delay, float64(time.Second))
+
+	lock.Lock()
+	require.Len(t, infos, 2)
+	for i, info := range infos {
+		assert.Equal(t, i+1, info.Position)
+		assert.InDelta(t, time.Duration(i+1)*time.Hour, info.Delay, float64(time.Second))
+	}
+	lock.Unlock()
+	b.Close()
+}
+
+func TestQueueBucket_Admin(t *testing.T) {
+	b := NewQueueBucket(time.Hour, 2)
+	defer b.Close()
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.BlockLimit(ctx, "")
+		done <- err
+	}()
+	waitQueued(t, b, 1)
+	got, err := b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 1, Remaining: 1}, got)
+
+	// 放行队首的请求, 并保留一次放行的机会
+	require.NoError(t, b.Adjust(ctx, "", 2))
+	assert.NoError(t, <-done)
+	got, err = b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 0, Remaining: 2}, got)
+
+	require.NoError(t, b.Adjust(ctx, "", -1))
+	limited, err := b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.True(t, limited)
+
+	require.NoError(t, b.Reset(ctx, ""))
+	limited, err = b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+}
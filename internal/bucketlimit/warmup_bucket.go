@@ -0,0 +1,292 @@
+package bucketlimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// WarmUpBucket 带预热的令牌桶, 算法与 Guava 的 SmoothWarmingUp 相同.
+// 桶中存放的令牌越多说明系统越"冷", 取出令牌需要的时间越长:
+// 存放的令牌数超过 threshold 时, 取出每个令牌的时间从 interval 线性增加, 桶满时为 interval * coldFactor.
+// 因此冷启动或空闲一段时间之后, 放行的速率从 1/(interval*coldFactor) 经过 warmup 的时间线性提高到 1/interval.
+// 令牌按时间惰性计算, 不需要运行 Put
+type WarmUpBucket struct {
+	// 稳定时每个令牌的间隔
+	interval   time.Duration
+	warmup     time.Duration
+	coldFactor float64
+	clock      limiter.Clock
+	observer   limiter.Observer
+
+	// threshold 存放的令牌数超过 threshold 时进入预热
+	threshold float64
+	// maxTokens 桶的容量
+	maxTokens float64
+	// slope 超过 threshold 之后每多存放一个令牌, 取出令牌的间隔增加的时间
+	slope float64
+
+	lock sync.Mutex
+	// tokens 存放的令牌数
+	tokens float64
+	// next 下一个令牌可以被取出的时间, 也是已按时间补充令牌的时间
+	next    time.Time
+	closed  bool
+	closeCh chan struct{}
+	running sync.WaitGroup
+}
+
+// NewWarmUpBucket 创建带预热的令牌桶. 稳定时每 interval 放行一个请求,
+// 冷启动时经过 warmup 的时间达到稳定的速率. 创建时桶是满的, 即处于最冷的状态
+func NewWarmUpBucket(interval, warmup time.Duration, opts ...WarmUpOption) *WarmUpBucket {
+	b := &WarmUpBucket{
+		interval:   interval,
+		warmup:     warmup,
+		coldFactor: 3,
+		clock:      limiter.SystemClock(),
+		closeCh:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.applyWarmUp(b)
+	}
+	if b.coldFactor < 1 {
+		b.coldFactor = 1
+	}
+	b.resize()
+	b.tokens = b.maxTokens
+	b.next = b.clock.Now()
+	return b
+}
+
+// resize 根据 interval、warmup 与 coldFactor 计算 threshold、maxTokens 与 slope
+func (b *WarmUpBucket) resize() {
+	stable := float64(b.interval)
+	if stable <= 0 {
+		return
+	}
+	cold := stable * b.coldFactor
+	// 从 threshold 到 0 的时间为 warmup/2, 从 maxTokens 到 threshold 的时间(梯形面积)为 warmup
+	b.threshold = 0.5 * float64(b.warmup) / stable
+	b.maxTokens = b.threshold + 2*float64(b.warmup)/(stable+cold)
+	b.slope = 0
+	if b.maxTokens > b.threshold {
+		b.slope = (cold - stable) / (b.maxTokens - b.threshold)
+	}
+}
+
+type WarmUpOption interface {
+	applyWarmUp(*WarmUpBucket)
+}
+
+type warmUpOptionFunc func(*WarmUpBucket)
+
+func (f warmUpOptionFunc) applyWarmUp(b *WarmUpBucket) {
+	f(b)
+}
+
+// WithColdFactor 桶满时取出令牌的间隔为 interval * factor. 默认 3, 小于 1 时视为 1
+func WithColdFactor(factor float64) WarmUpOption {
+	return warmUpOptionFunc(func(b *WarmUpBucket) {
+		b.coldFactor = factor
+	})
+}
+
+// Put 令牌按时间惰性计算, Put 只是阻塞到 Close, 以便与其他桶限流器一样使用.
+// Close 之后调用 Put 会直接返回
+func (b *WarmUpBucket) Put() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.running.Add(1)
+	b.lock.Unlock()
+	defer b.running.Done()
+	<-b.closeCh
+}
+
+// Close 关闭限流器, 正在等待的请求返回 limiter.ErrClosed. 会等待正在运行的 Put 退出
+func (b *WarmUpBucket) Close() {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.closeCh)
+	}
+	b.lock.Unlock()
+	b.running.Wait()
+}
+
+func (b *WarmUpBucket) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := b.limit(ctx)
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *WarmUpBucket) limit(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return false, limiter.ErrClosed
+	}
+	now := b.clock.Now()
+	if b.next.After(now) {
+		return true, nil
+	}
+	b.reserve(now)
+	return false, nil
+}
+
+// BlockLimit 等待到可以取出令牌. 等待的时间超过 ctx 的截止时间时不等待, 直接返回 context.DeadlineExceeded.
+// 开始等待之后 ctx 结束时, 已预留的令牌不会归还
+func (b *WarmUpBucket) BlockLimit(ctx context.Context, key string) (bool, error) {
+	start := b.clock.Now()
+	limited, err := b.blockLimit(ctx)
+	observer.NotifyWait(ctx, b.observer, key, b.clock.Now().Sub(start))
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *WarmUpBucket) blockLimit(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return false, limiter.ErrClosed
+	}
+	now := b.clock.Now()
+	wait := b.next.Sub(now)
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		b.lock.Unlock()
+		return true, context.DeadlineExceeded
+	}
+	b.reserve(now)
+	b.lock.Unlock()
+	if wait <= 0 {
+		return false, nil
+	}
+
+	timer := b.clock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return false, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-b.closeCh:
+		return false, limiter.ErrClosed
+	}
+}
+
+// reserve 预留一个令牌, 下一个令牌的时间推迟取出该令牌需要的时间. 调用方需要持有锁
+func (b *WarmUpBucket) reserve(now time.Time) {
+	b.sync(now)
+	spend := math.Min(1, b.tokens)
+	fresh := 1 - spend
+	cost := b.storedCost(b.tokens, spend) + time.Duration(fresh*float64(b.interval))
+	b.next = b.next.Add(cost)
+	b.tokens -= spend
+}
+
+// sync 按经过的时间补充令牌. 每 warmup/maxTokens 补充一个令牌, 经过 warmup 的时间从空桶补满.
+// 令牌只在 next 之后补充, 即预留的令牌取出之前不会补充. 调用方需要持有锁
+func (b *WarmUpBucket) sync(now time.Time) {
+	if !now.After(b.next) {
+		return
+	}
+	if b.maxTokens > 0 {
+		coolDown := float64(b.warmup) / b.maxTokens
+		b.tokens = math.Min(b.maxTokens, b.tokens+float64(now.Sub(b.next))/coolDown)
+	}
+	b.next = now
+}
+
+// storedCost 从存放的 tokens 个令牌中取出 n 个需要的时间. 超过 threshold 的部分为梯形面积
+func (b *WarmUpBucket) storedCost(tokens, n float64) time.Duration {
+	var cost float64
+	if above := tokens - b.threshold; above > 0 {
+		take := math.Min(above, n)
+		cost = take * (b.intervalAt(above) + b.intervalAt(above-take)) / 2
+		n -= take
+	}
+	cost += n * float64(b.interval)
+	return time.Duration(cost)
+}
+
+// intervalAt 存放的令牌数超过 threshold aboveThreshold 个时取出令牌的间隔
+func (b *WarmUpBucket) intervalAt(aboveThreshold float64) float64 {
+	return float64(b.interval) + aboveThreshold*b.slope
+}
+
+// Rate 返回当前放行的速率, 即每秒可以取出的令牌数
+func (b *WarmUpBucket) Rate() float64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.sync(b.clock.Now())
+	interval := float64(b.interval)
+	if above := b.tokens - b.threshold; above > 0 {
+		interval = b.intervalAt(above)
+	}
+	if interval <= 0 {
+		return math.Inf(1)
+	}
+	return float64(time.Second) / interval
+}
+
+// Inspect 查询桶中存放的令牌数, 令牌数向下取整. Limit 为桶的容量, Used 为已被取走的令牌数
+func (b *WarmUpBucket) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.sync(b.clock.Now())
+	c := int64(math.Round(b.maxTokens))
+	return limiter.NewState(c, c-int64(b.tokens)), nil
+}
+
+// Reset 放满令牌并取消已预留的等待, 与刚创建时相同, 即处于最冷的状态.
+// 已经在等待的请求仍然等待到预留的时间
+func (b *WarmUpBucket) Reset(_ context.Context, _ string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens = b.maxTokens
+	b.next = b.clock.Now()
+	return nil
+}
+
+// Adjust delta 为正时放入 delta 个令牌, 最多放满; 为负时取走 -delta 个令牌.
+// 与令牌桶不同, 放入的令牌越多桶越冷, 取出令牌的间隔越长
+func (b *WarmUpBucket) Adjust(_ context.Context, _ string, delta int64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.sync(b.clock.Now())
+	b.tokens = math.Max(0, math.Min(b.maxTokens, b.tokens+float64(delta)))
+	return nil
+}
+
+// SetLimit 修改桶的容量. interval 与 coldFactor 不变, 预热的时间随容量按比例变化, 超出容量的令牌被丢弃
+func (b *WarmUpBucket) SetLimit(capacity int64) error {
+	if capacity < 0 {
+		return errs.InvalidConfig("capacity 不能小于0, 实际为 %d", capacity)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	stable := float64(b.interval)
+	if stable <= 0 {
+		return nil
+	}
+	// 按之前的补充速度补充到现在
+	b.sync(b.clock.Now())
+	// maxTokens = warmup * (0.5/stable + 2/(stable+cold))
+	b.warmup = time.Duration(float64(capacity) / (0.5/stable + 2/(stable+stable*b.coldFactor)))
+	b.resize()
+	b.tokens = math.Min(b.maxTokens, b.tokens)
+	return nil
+}
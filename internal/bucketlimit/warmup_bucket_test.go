@@ -0,0 +1,215 @@
+package bucketlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/fakeclock"
+)
+
+func TestWarmUpBucket_Limit(t *testing.T) {
+	// threshold 为 5, 容量为 10, 桶满时每个令牌的间隔为 300ms
+	tests := []struct {
+		name string
+		// idle 开始请求前空闲的时间
+		idle time.Duration
+		// gaps 持续请求时相邻两次放行的间隔, 在预热期间从 280ms 逐渐减少到 100ms
+		gaps []time.Duration
+	}{
+		{
+			name: "cold_start",
+			gaps: []time.Duration{280, 240, 200, 160, 120, 100, 100, 100},
+		},
+		{
+			// 空闲的时间从上一次放行的令牌可以被取出时开始计算, 每 100ms 补充一个令牌.
+			// 空闲 700ms 补充 6 个令牌, 从剩余 1 个令牌补充到 7 个, 超过 threshold 2 个
+			name: "partial_cool_down",
+			idle: 700 * time.Millisecond,
+			gaps: []time.Duration{160, 120, 100},
+		},
+		{
+			// 空闲足够长的时间后令牌补满, 重新预热
+			name: "idle_cool_down",
+			idle: time.Second,
+			gaps: []time.Duration{280, 240, 200},
+		},
+	}
+	clk := fakeclock.New(time.UnixMilli(1695571200000))
+	b := NewWarmUpBucket(100*time.Millisecond, time.Second, WithClock(clk))
+	defer b.Close()
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.idle)
+			got, err := b.Limit(ctx, "")
+			require.NoError(t, err)
+			require.False(t, got)
+			for _, gap := range tt.gaps {
+				gap *= time.Millisecond
+				clk.Advance(gap - time.Millisecond)
+				got, err = b.Limit(ctx, "")
+				require.NoError(t, err)
+				assert.True(t, got)
+				clk.Advance(time.Millisecond)
+				got, err = b.Limit(ctx, "")
+				require.NoError(t, err)
+				assert.False(t, got)
+			}
+		})
+	}
+}
+
+func TestWarmUpBucket_Rate(t *testing.T) {
+	clk := fakeclock.New(time.UnixMilli(1695571200000))
+	b := NewWarmUpBucket(100*time.Millisecond, time.Second, WithColdFactor(5), WithClock(clk))
+	ctx := context.Background()
+	// 桶满时最冷
+	assert.InDelta(t, 2, b.Rate(), 1e-9)
+	// 每次都在令牌可以被取出时请求
+	for i := 0; i < 20; i++ {
+		got, err := b.Limit(ctx, "")
+		require.NoError(t, err)
+		require.False(t, got)
+		clk.Set(b.next)
+	}
+	// 持续请求之后达到稳定的速率
+	assert.InDelta(t, 10, b.Rate(), 1e-9)
+}
+
+func TestWarmUpBucket_BlockLimit(t *testing.T) {
+	// ctx 的截止时间使用真实的时间, fakeclock 从当前时间开始
+	clk := fakeclock.New(time.Now())
+	b := NewWarmUpBucket(20*time.Millisecond, 0, WithClock(clk))
+	go b.Put()
+	ctx := context.Background()
+
+	got, err := b.BlockLimit(ctx, "")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	// 等待的时间超过截止时间, 不等待
+	timeout, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	got, err = b.BlockLimit(timeout, "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, got)
+
+	// 等待 20ms
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.BlockLimit(ctx, "")
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(19 * time.Millisecond)
+	select {
+	case err = <-done:
+		t.Fatalf("没有等待到可以取出令牌, err: %v", err)
+	default:
+	}
+	clk.Advance(time.Millisecond)
+	assert.NoError(t, <-done)
+
+	// 等待中关闭
+	go func() {
+		_, err := b.BlockLimit(ctx, "")
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	b.Close()
+	assert.ErrorIs(t, <-done, limiter.ErrClosed)
+	got, err = b.Limit(ctx, "")
+	assert.ErrorIs(t, err, limiter.ErrClosed)
+	assert.False(t, got)
+}
+
+func TestWarmUpBucket_Admin(t *testing.T) {
+	ctx := context.Background()
+	// 容量为 10, 创建时桶是满的
+	b := NewWarmUpBucket(100*time.Millisecond, time.Second,
+		WithClock(fakeclock.New(time.UnixMilli(1695571200000))))
+	defer b.Close()
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+	}{
+		{
+			name: "full",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 10, Used: 0, Remaining: 10},
+		},
+		{
+			name: "limit",
+			op: func() error {
+				_, err := b.Limit(ctx, "")
+				return err
+			},
+			want: limiter.State{Limit: 10, Used: 1, Remaining: 9},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return b.Adjust(ctx, "", -3) },
+			want: limiter.State{Limit: 10, Used: 4, Remaining: 6},
+		},
+		{
+			name: "deduct_beyond_tokens",
+			op:   func() error { return b.Adjust(ctx, "", -10) },
+			want: limiter.State{Limit: 10, Used: 10, Remaining: 0},
+		},
+		{
+			name: "grant",
+			op:   func() error { return b.Adjust(ctx, "", 2) },
+			want: limiter.State{Limit: 10, Used: 8, Remaining: 2},
+		},
+		{
+			name: "grant_beyond_capacity",
+			op:   func() error { return b.Adjust(ctx, "", 20) },
+			want: limiter.State{Limit: 10, Used: 0, Remaining: 10},
+		},
+		{
+			name: "reset",
+			op: func() error {
+				if err := b.Adjust(ctx, "", -5); err != nil {
+					return err
+				}
+				return b.Reset(ctx, "")
+			},
+			want: limiter.State{Limit: 10, Used: 0, Remaining: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.op())
+			got, err := b.Inspect(ctx, "")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Reset 取消了 limit 预留的等待
+	got, err := b.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestWarmUpBucket_SetLimit(t *testing.T) {
+	ctx := context.Background()
+	b := NewWarmUpBucket(100*time.Millisecond, time.Second,
+		WithClock(fakeclock.New(time.UnixMilli(1695571200000))))
+	defer b.Close()
+
+	// 超出容量的令牌被丢弃, 最冷时的速率不变
+	require.NoError(t, b.SetLimit(4))
+	got, err := b.Inspect(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 4, Used: 0, Remaining: 4}, got)
+	assert.Equal(t, 400*time.Millisecond, b.warmup)
+	assert.InDelta(t, 10.0/3, b.Rate(), 1e-9)
+	assert.ErrorIs(t, b.SetLimit(-1), limiter.ErrInvalidConfig)
+}
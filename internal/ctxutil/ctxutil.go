@@ -0,0 +1,28 @@
+package ctxutil
+
+import (
+	"context"
+	"time"
+)
+
+// WithoutCancel 返回保留 ctx 中的值但不会结束的 Context, 与 go1.21 的 context.WithoutCancel 相同.
+// 用于调用方的 ctx 已经结束时撤销已经计入 redis 的请求, 由 redis 客户端的超时限制等待的时间
+func WithoutCancel(ctx context.Context) context.Context {
+	return withoutCancel{ctx}
+}
+
+type withoutCancel struct {
+	context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (withoutCancel) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutCancel) Err() error {
+	return nil
+}
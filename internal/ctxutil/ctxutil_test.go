@@ -0,0 +1,22 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type valueKey struct{}
+
+func TestWithoutCancel(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), valueKey{}, "v"), time.Millisecond)
+	cancel()
+	ctx := WithoutCancel(parent)
+	assert.NoError(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	assert.Equal(t, "v", ctx.Value(valueKey{}))
+}
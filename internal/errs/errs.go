@@ -0,0 +1,28 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/udugong/limiter"
+)
+
+// Backend 将后端返回的 err 包装为 limiter.ErrBackendUnavailable.
+// err 为 nil 或 Context 的错误时原样返回
+func Backend(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", limiter.ErrBackendUnavailable, err)
+}
+
+// InvalidConfig 生成包装了 limiter.ErrInvalidConfig 的错误
+func InvalidConfig(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", limiter.ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
+
+// OverRelease 生成包装了 limiter.ErrOverRelease 的错误, name 为限流器的名称
+func OverRelease(name string) error {
+	return fmt.Errorf("错误使用 %s.Decr: %w", name, limiter.ErrOverRelease)
+}
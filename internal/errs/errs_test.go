@@ -0,0 +1,76 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/udugong/limiter"
+)
+
+func TestBackend(t *testing.T) {
+	mockErr := errors.New("mock error")
+	tests := []struct {
+		name       string
+		err        error
+		wantIs     []error
+		wantNotIs  []error
+		wantErrMsg string
+	}{
+		{
+			name: "nil",
+			err:  nil,
+		},
+		{
+			name:       "backend_error",
+			err:        mockErr,
+			wantIs:     []error{limiter.ErrBackendUnavailable, mockErr},
+			wantErrMsg: "后端不可用: mock error",
+		},
+		{
+			name:       "canceled",
+			err:        context.Canceled,
+			wantIs:     []error{context.Canceled},
+			wantNotIs:  []error{limiter.ErrBackendUnavailable},
+			wantErrMsg: context.Canceled.Error(),
+		},
+		{
+			name:       "wrapped_deadline_exceeded",
+			err:        fmt.Errorf("dial: %w", context.DeadlineExceeded),
+			wantIs:     []error{context.DeadlineExceeded},
+			wantNotIs:  []error{limiter.ErrBackendUnavailable},
+			wantErrMsg: "dial: context deadline exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Backend(tt.err)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			for _, target := range tt.wantIs {
+				assert.ErrorIs(t, err, target)
+			}
+			for _, target := range tt.wantNotIs {
+				assert.NotErrorIs(t, err, target)
+			}
+			assert.EqualError(t, err, tt.wantErrMsg)
+		})
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	err := InvalidConfig("rate 必须大于0, 实际为 %d", -1)
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	assert.EqualError(t, err, "限流器配置不合法: rate 必须大于0, 实际为 -1")
+}
+
+func TestOverRelease(t *testing.T) {
+	err := OverRelease("LocalActiveLimiter")
+	assert.ErrorIs(t, err, limiter.ErrOverRelease)
+	assert.EqualError(t, err, "错误使用 LocalActiveLimiter.Decr: 活跃请求数小于0")
+}
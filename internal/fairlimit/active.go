@@ -0,0 +1,220 @@
+package fairlimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// FairActiveLimiter 按权重在活跃的限流对象之间分配最大活跃请求数的本地限流器.
+// 有正在处理的请求, 或者在 idleTimeout 内请求过的限流对象视为活跃.
+// 每个活跃的限流对象预留 1 个活跃请求, 其余的按权重分配,
+// 即份额为 1 + (maxActive - 活跃的限流对象数) * 权重 / 活跃的限流对象的权重之和(向上取整).
+// 超过份额或总数超过 maxActive 时限流, 除第一个活跃请求外, 也不能占用其他没有正在处理的请求的限流对象预留的活跃请求.
+// 不活跃的限流对象不占用份额, 其份额由其他限流对象分享. 限流对象的权重在变为活跃时计算
+type FairActiveLimiter struct {
+	maxActive   int64
+	weight      func(key string) int
+	idleTimeout time.Duration
+	timeFunc    func() time.Time
+	observer    limiter.Observer
+
+	lock    sync.Mutex
+	total   int64
+	tenants map[string]*tenant
+	// weightSum 活跃的限流对象的权重之和
+	weightSum int64
+	// idle 没有正在处理的请求的限流对象, 按开始空闲的时间排序
+	idle *list.List
+}
+
+type tenant struct {
+	active int64
+	// lastSeen 最后一次请求或者开始空闲的时间
+	lastSeen time.Time
+	weight   int64
+	// idle 没有正在处理的请求时在 FairActiveLimiter.idle 中的位置
+	idle *list.Element
+}
+
+// NewFairActiveLimiter 创建按权重分配最大活跃请求数的限流器
+func NewFairActiveLimiter(maxActive int64, opts ...ActiveOption) *FairActiveLimiter {
+	l := &FairActiveLimiter{
+		maxActive:   maxActive,
+		weight:      weightFunc,
+		idleTimeout: time.Second,
+		timeFunc:    func() time.Time { return time.Now() },
+		tenants:     make(map[string]*tenant),
+		idle:        list.New(),
+	}
+	for _, opt := range opts {
+		opt.applyActive(l)
+	}
+	return l
+}
+
+type ActiveOption interface {
+	applyActive(*FairActiveLimiter)
+}
+
+type activeOptionFunc func(*FairActiveLimiter)
+
+func (f activeOptionFunc) applyActive(l *FairActiveLimiter) {
+	f(l)
+}
+
+// WithIdleTimeout 限流对象没有正在处理的请求且超过 d 没有请求时不再占用份额. 默认 1s
+func WithIdleTimeout(d time.Duration) ActiveOption {
+	return activeOptionFunc(func(l *FairActiveLimiter) {
+		l.idleTimeout = d
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) ActiveOption {
+	return activeOptionFunc(func(l *FairActiveLimiter) {
+		l.timeFunc = fn
+	})
+}
+
+// Limit 活跃请求数增加1, 被限流时同样需要调用 Decr
+func (l *FairActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited := l.limit(key)
+	observer.Notify(ctx, l.observer, key, limited, nil)
+	return limited, nil
+}
+
+func (l *FairActiveLimiter) limit(key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.timeFunc()
+	l.expire(now)
+	t := l.tenant(key, now)
+	t.lastSeen = now
+	l.setActive(key, t, t.active+1, now)
+	if l.total > l.maxActive || t.active > l.share(t) {
+		return true
+	}
+	// 第一个活跃请求使用自己预留的, 之后的不能占用其他限流对象预留的
+	return t.active > 1 && l.total+int64(l.idle.Len()) > l.maxActive
+}
+
+// tenant 返回 key 的状态, 不存在时创建并视为活跃. 调用方需要持有锁
+func (l *FairActiveLimiter) tenant(key string, now time.Time) *tenant {
+	t, ok := l.tenants[key]
+	if ok {
+		return t
+	}
+	t = &tenant{lastSeen: now, weight: int64(weightOf(l.weight, key))}
+	l.tenants[key] = t
+	l.weightSum += t.weight
+	t.idle = l.idle.PushBack(key)
+	return t
+}
+
+// setActive 修改活跃请求数, 同时维护空闲的限流对象. 调用方需要持有锁
+func (l *FairActiveLimiter) setActive(key string, t *tenant, active int64, now time.Time) {
+	l.total += active - t.active
+	t.active = active
+	switch {
+	case active > 0 && t.idle != nil:
+		l.idle.Remove(t.idle)
+		t.idle = nil
+	case active <= 0 && t.idle == nil:
+		t.lastSeen = now
+		t.idle = l.idle.PushBack(key)
+	}
+}
+
+// expire 删除空闲超过 idleTimeout 的限流对象. 调用方需要持有锁
+func (l *FairActiveLimiter) expire(now time.Time) {
+	for e := l.idle.Front(); e != nil; e = l.idle.Front() {
+		key := e.Value.(string)
+		t := l.tenants[key]
+		if now.Sub(t.lastSeen) < l.idleTimeout {
+			return
+		}
+		l.remove(key, t)
+	}
+}
+
+// remove 删除 key, 调用方需要持有锁
+func (l *FairActiveLimiter) remove(key string, t *tenant) {
+	if t.idle != nil {
+		l.idle.Remove(t.idle)
+		t.idle = nil
+	}
+	l.total -= t.active
+	l.weightSum -= t.weight
+	delete(l.tenants, key)
+}
+
+// share 计算 t 的份额. 调用方需要持有锁
+func (l *FairActiveLimiter) share(t *tenant) int64 {
+	rest := l.maxActive - int64(len(l.tenants))
+	if rest <= 0 {
+		return 1
+	}
+	return 1 + (rest*t.weight+l.weightSum-1)/l.weightSum
+}
+
+func (l *FairActiveLimiter) Decr(ctx context.Context, key string) error {
+	err := l.decr(key)
+	observer.NotifyRelease(ctx, l.observer, key, err)
+	return err
+}
+
+func (l *FairActiveLimiter) decr(key string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	t, ok := l.tenants[key]
+	if !ok || t.active <= 0 {
+		return errs.OverRelease("FairActiveLimiter")
+	}
+	l.setActive(key, t, t.active-1, l.timeFunc())
+	return nil
+}
+
+// Inspect 查询 key 的活跃请求数, Limit 为 key 当前的份额
+func (l *FairActiveLimiter) Inspect(_ context.Context, key string) (limiter.State, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.timeFunc()
+	l.expire(now)
+	t, ok := l.tenants[key]
+	if !ok {
+		// 计算份额时把 key 视为活跃
+		t = l.tenant(key, now)
+		defer l.remove(key, t)
+	}
+	return limiter.NewState(l.share(t), t.active), nil
+}
+
+// Reset key 的活跃请求数清零. 之后正在处理的请求调用 Decr 会返回 limiter.ErrOverRelease
+func (l *FairActiveLimiter) Reset(_ context.Context, key string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if t, ok := l.tenants[key]; ok {
+		l.setActive(key, t, 0, l.timeFunc())
+	}
+	return nil
+}
+
+// Adjust key 的活跃请求数减少 delta, 最少为 0
+func (l *FairActiveLimiter) Adjust(_ context.Context, key string, delta int64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.timeFunc()
+	t := l.tenant(key, now)
+	active := t.active - delta
+	if active < 0 {
+		active = 0
+	}
+	l.setActive(key, t, active, now)
+	return nil
+}
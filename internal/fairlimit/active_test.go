@@ -0,0 +1,188 @@
+package fairlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+)
+
+func TestFairActiveLimiter_Limit(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		opts []ActiveOption
+		// steps 依次调用 Limit 的限流对象与期望的结果
+		steps []struct {
+			key  string
+			want bool
+		}
+		// elapsed 每一步之前经过的时间
+		elapsed time.Duration
+	}{
+		{
+			// 只有一个限流对象时可以使用全部份额
+			name: "single_tenant_uses_all",
+			steps: []struct {
+				key  string
+				want bool
+			}{
+				{"noisy", false}, {"noisy", false}, {"noisy", false}, {"noisy", false}, {"noisy", true},
+			},
+		},
+		{
+			// 两个限流对象平分份额
+			name: "two_tenants_share",
+			steps: []struct {
+				key  string
+				want bool
+			}{
+				{"noisy", false}, {"quiet", false}, {"noisy", false}, {"noisy", true}, {"quiet", false},
+			},
+		},
+		{
+			// 权重为 3:1
+			name: "weighted",
+			opts: []ActiveOption{WithWeight(func(key string) int {
+				if key == "paid" {
+					return 3
+				}
+				return 1
+			})},
+			steps: []struct {
+				key  string
+				want bool
+			}{
+				{"free", false}, {"paid", false}, {"paid", false}, {"paid", false}, {"free", true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewFairActiveLimiter(4, append(tt.opts, WithTimeFunc(func() time.Time {
+				return now
+			}))...)
+			for i, step := range tt.steps {
+				got, err := l.Limit(ctx, step.key)
+				require.NoError(t, err)
+				if got {
+					// 被限流的请求立即释放
+					require.NoError(t, l.Decr(ctx, step.key))
+				}
+				assert.Equalf(t, step.want, got, "step %d", i)
+			}
+		})
+	}
+}
+
+// 不活跃的限流对象的份额由其他限流对象分享
+func TestFairActiveLimiter_IdleShare(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	ctx := context.Background()
+	l := NewFairActiveLimiter(4, WithIdleTimeout(time.Second), WithTimeFunc(func() time.Time {
+		return now
+	}))
+
+	// quiet 请求过一次后释放
+	got, err := l.Limit(ctx, "quiet")
+	require.NoError(t, err)
+	require.False(t, got)
+	require.NoError(t, l.Decr(ctx, "quiet"))
+
+	// quiet 仍然活跃, noisy 只能使用一半
+	for _, want := range []bool{false, false, true} {
+		got, err = l.Limit(ctx, "noisy")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	require.NoError(t, l.Decr(ctx, "noisy"))
+
+	// quiet 不活跃后, noisy 可以使用全部份额
+	now = now.Add(time.Second)
+	for _, want := range []bool{false, false, true} {
+		got, err = l.Limit(ctx, "noisy")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+// 每个活跃的限流对象预留 1 个活跃请求
+func TestFairActiveLimiter_Reserve(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	ctx := context.Background()
+	l := NewFairActiveLimiter(6, WithTimeFunc(func() time.Time { return now }))
+
+	// d 请求过一次后释放, 仍然活跃
+	got, err := l.Limit(ctx, "d")
+	require.NoError(t, err)
+	require.False(t, got)
+	require.NoError(t, l.Decr(ctx, "d"))
+
+	// 4 个活跃的限流对象, 每个的份额为 1 + ceil((6-4)/4) = 2
+	steps := []struct {
+		key  string
+		want bool
+	}{
+		{"a", false}, {"a", false}, {"b", false}, {"b", false}, {"c", false},
+		// c 的份额没有用完, 但剩下的 1 个预留给 d
+		{"c", true},
+		{"d", false},
+	}
+	for i, step := range steps {
+		got, err = l.Limit(ctx, step.key)
+		require.NoError(t, err)
+		if got {
+			require.NoError(t, l.Decr(ctx, step.key))
+		}
+		assert.Equalf(t, step.want, got, "step %d", i)
+	}
+	assert.Equal(t, int64(6), l.total)
+	assert.Equal(t, int64(4), l.weightSum)
+	assert.Equal(t, 0, l.idle.Len())
+}
+
+func TestFairActiveLimiter_Decr(t *testing.T) {
+	ctx := context.Background()
+	l := NewFairActiveLimiter(1)
+	_, err := l.Limit(ctx, "a")
+	require.NoError(t, err)
+	assert.NoError(t, l.Decr(ctx, "a"))
+	assert.ErrorIs(t, l.Decr(ctx, "a"), limiter.ErrOverRelease)
+	assert.ErrorIs(t, l.Decr(ctx, "b"), limiter.ErrOverRelease)
+}
+
+func TestFairActiveLimiter_Admin(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	ctx := context.Background()
+	l := NewFairActiveLimiter(4, WithTimeFunc(func() time.Time { return now }))
+
+	// 没有请求过的限流对象也视为活跃
+	got, err := l.Inspect(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 4, Used: 0, Remaining: 4}, got)
+
+	for i := 0; i < 3; i++ {
+		_, _ = l.Limit(ctx, "a")
+	}
+	_, _ = l.Limit(ctx, "b")
+	got, err = l.Inspect(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 3, Remaining: 0}, got)
+
+	require.NoError(t, l.Adjust(ctx, "a", 2))
+	got, err = l.Inspect(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 1, Remaining: 1}, got)
+
+	require.NoError(t, l.Reset(ctx, "a"))
+	assert.ErrorIs(t, l.Decr(ctx, "a"), limiter.ErrOverRelease)
+	// 清零之后总数也随之减少
+	limited, err := l.Limit(ctx, "c")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+}
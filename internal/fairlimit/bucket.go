@@ -0,0 +1,304 @@
+package fairlimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// FairBucket 按权重在限流对象之间公平分配令牌的令牌桶.
+// 桶中没有令牌时, 等待的请求按限流对象排队, 令牌按差额轮询(deficit round robin)分配给各个限流对象:
+// 每一轮每个有请求在等待的限流对象可以获得与权重相同数量的令牌.
+// 没有请求在等待的限流对象不参与分配, 其份额由其他限流对象分享
+type FairBucket struct {
+	interval time.Duration
+	capacity int
+	weight   func(key string) int
+	clock    limiter.Clock
+	observer limiter.Observer
+
+	lock   sync.Mutex
+	tokens int
+	queues map[string]*keyQueue
+	// ring 有请求在等待的限流对象, 元素为 *keyQueue. cursor 为当前轮到的限流对象
+	ring    *list.List
+	cursor  *list.Element
+	closed  bool
+	closeCh chan struct{}
+	running sync.WaitGroup
+}
+
+// keyQueue 某个限流对象等待的请求
+type keyQueue struct {
+	key string
+	// waiters 元素为 chan struct{}, 获得令牌时关闭
+	waiters *list.List
+	// deficit 本轮剩余可以获得的令牌数
+	deficit int
+	elem    *list.Element
+}
+
+// NewFairBucket 创建公平分配令牌的令牌桶. 每 interval 放置一个令牌, 最多存放 capacity 个令牌
+func NewFairBucket(interval time.Duration, capacity int, opts ...BucketOption) *FairBucket {
+	b := &FairBucket{
+		interval: interval,
+		capacity: capacity,
+		weight:   weightFunc,
+		clock:    limiter.SystemClock(),
+		queues:   make(map[string]*keyQueue),
+		ring:     list.New(),
+		closeCh:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.applyBucket(b)
+	}
+	return b
+}
+
+type BucketOption interface {
+	applyBucket(*FairBucket)
+}
+
+// Put 每隔 interval 放置一个令牌, 直到调用 Close.
+// Close 之后调用 Put 会直接返回
+func (b *FairBucket) Put() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.running.Add(1)
+	b.put()
+	b.lock.Unlock()
+	defer b.running.Done()
+
+	ticker := b.clock.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closeCh:
+			return
+		case <-ticker.C():
+			b.lock.Lock()
+			b.put()
+			b.lock.Unlock()
+		}
+	}
+}
+
+// put 令牌优先分配给等待的请求, 没有等待的请求时放入桶中. 调用方需要持有锁
+func (b *FairBucket) put() {
+	if b.cursor == nil {
+		if b.tokens < b.capacity {
+			b.tokens++
+		}
+		return
+	}
+	for {
+		q := b.cursor.Value.(*keyQueue)
+		if q.deficit > 0 {
+			q.deficit--
+			front := q.waiters.Front()
+			q.waiters.Remove(front)
+			close(front.Value.(chan struct{}))
+			if q.waiters.Len() == 0 {
+				b.removeQueue(q)
+			}
+			return
+		}
+		b.advance()
+	}
+}
+
+// advance 轮到下一个限流对象, 并补充其本轮可以获得的令牌数. 调用方需要持有锁
+func (b *FairBucket) advance() {
+	next := b.cursor.Next()
+	if next == nil {
+		next = b.ring.Front()
+	}
+	b.cursor = next
+	q := next.Value.(*keyQueue)
+	q.deficit += weightOf(b.weight, q.key)
+}
+
+// removeQueue 限流对象没有等待的请求时退出轮询. 调用方需要持有锁
+func (b *FairBucket) removeQueue(q *keyQueue) {
+	delete(b.queues, q.key)
+	if b.ring.Len() == 1 {
+		b.ring.Remove(q.elem)
+		b.cursor = nil
+		return
+	}
+	if b.cursor == q.elem {
+		b.advance()
+	}
+	b.ring.Remove(q.elem)
+}
+
+// Close 关闭限流器, 正在等待的请求返回 limiter.ErrClosed. 会等待正在运行的 Put 退出
+func (b *FairBucket) Close() {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.closeCh)
+	}
+	b.lock.Unlock()
+	b.running.Wait()
+}
+
+// Limit 不等待. 有请求在等待时不会插队
+func (b *FairBucket) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := b.limit(ctx)
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *FairBucket) limit(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return false, limiter.ErrClosed
+	}
+	if b.tokens > 0 && b.cursor == nil {
+		b.tokens--
+		return false, nil
+	}
+	return true, nil
+}
+
+func (b *FairBucket) BlockLimit(ctx context.Context, key string) (bool, error) {
+	start := b.clock.Now()
+	limited, err := b.blockLimit(ctx, key)
+	observer.NotifyWait(ctx, b.observer, key, b.clock.Now().Sub(start))
+	observer.Notify(ctx, b.observer, key, limited, err)
+	return limited, err
+}
+
+func (b *FairBucket) blockLimit(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return false, limiter.ErrClosed
+	}
+	if b.tokens > 0 && b.cursor == nil {
+		b.tokens--
+		b.lock.Unlock()
+		return false, nil
+	}
+	q, ok := b.queues[key]
+	if !ok {
+		q = &keyQueue{key: key, waiters: list.New()}
+		q.elem = b.ring.PushBack(q)
+		b.queues[key] = q
+		if b.cursor == nil {
+			b.cursor = q.elem
+			q.deficit = weightOf(b.weight, key)
+		}
+	}
+	ch := make(chan struct{})
+	elem := q.waiters.PushBack(ch)
+	b.lock.Unlock()
+
+	select {
+	case <-ch:
+		return false, nil
+	case <-ctx.Done():
+		if b.remove(q, elem, ch) {
+			return true, ctx.Err()
+		}
+		// 在 Context 结束的同时已获得令牌
+		return false, nil
+	case <-b.closeCh:
+		if b.remove(q, elem, ch) {
+			return false, limiter.ErrClosed
+		}
+		return false, nil
+	}
+}
+
+// remove 移除未获得令牌的请求. 已获得令牌时返回 false
+func (b *FairBucket) remove(q *keyQueue, elem *list.Element, ch chan struct{}) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	select {
+	case <-ch:
+		return false
+	default:
+	}
+	q.waiters.Remove(elem)
+	if q.waiters.Len() == 0 {
+		b.removeQueue(q)
+	}
+	return true
+}
+
+// Inspect 查询桶中的令牌数. Used 为已被取走的令牌数. 所有限流对象共用一个桶
+func (b *FairBucket) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return limiter.NewState(int64(b.capacity), int64(b.capacity-b.tokens)), nil
+}
+
+// Reset 放满令牌, 令牌优先分配给等待的请求
+func (b *FairBucket) Reset(_ context.Context, _ string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.adjust(int64(b.capacity))
+	return nil
+}
+
+// Adjust delta 为正时放入 delta 个令牌, 令牌优先分配给等待的请求; 为负时取走 -delta 个令牌
+func (b *FairBucket) Adjust(_ context.Context, _ string, delta int64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.adjust(delta)
+	return nil
+}
+
+// adjust 放入的令牌最多分配给所有等待的请求并放满, 多余的部分被丢弃. 调用方需要持有锁
+func (b *FairBucket) adjust(delta int64) {
+	if room := int64(b.capacity - b.tokens + b.waiting()); delta > room {
+		delta = room
+	}
+	for ; delta > 0; delta-- {
+		b.put()
+	}
+	b.tokens += int(delta)
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+}
+
+// waiting 等待的请求数. 调用方需要持有锁
+func (b *FairBucket) waiting() int {
+	n := 0
+	for _, q := range b.queues {
+		n += q.waiters.Len()
+	}
+	return n
+}
+
+// SetLimit 修改桶的容量, 超出容量的令牌被丢弃
+func (b *FairBucket) SetLimit(capacity int64) error {
+	if capacity < 0 {
+		return errs.InvalidConfig("capacity 不能小于0, 实际为 %d", capacity)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.capacity = int(capacity)
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package fairlimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/fakeclock"
+)
+
+// putOnce 代替 Put 放置一个令牌
+func putOnce(b *FairBucket) {
+	b.lock.Lock()
+	b.put()
+	b.lock.Unlock()
+}
+
+func waitWaiters(t *testing.T, b *FairBucket, n int) {
+	require.Eventually(t, func() bool {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		return b.waiting() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestFairBucket_BlockLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []BucketOption
+		queued map[string]int
+		tokens int
+		want   map[string]int
+	}{
+		{
+			// noisy 排队的请求再多, 也只能与 quiet 轮流获得令牌
+			name:   "round_robin",
+			queued: map[string]int{"noisy": 10, "quiet": 2},
+			tokens: 4,
+			want:   map[string]int{"noisy": 2, "quiet": 2},
+		},
+		{
+			// quiet 没有请求在等待后, noisy 获得全部令牌
+			name:   "idle_share",
+			queued: map[string]int{"noisy": 10, "quiet": 1},
+			tokens: 6,
+			want:   map[string]int{"noisy": 5, "quiet": 1},
+		},
+		{
+			name: "weighted",
+			opts: []BucketOption{WithWeight(func(key string) int {
+				if key == "paid" {
+					return 3
+				}
+				return 1
+			})},
+			queued: map[string]int{"paid": 10, "free": 10},
+			tokens: 8,
+			want:   map[string]int{"paid": 6, "free": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewFairBucket(time.Hour, 1, tt.opts...)
+			var lock sync.Mutex
+			got := make(map[string]int)
+			var wg sync.WaitGroup
+			total := 0
+			for key, n := range tt.queued {
+				for i := 0; i < n; i++ {
+					wg.Add(1)
+					key := key
+					go func() {
+						defer wg.Done()
+						limited, err := b.BlockLimit(context.Background(), key)
+						if err == nil && !limited {
+							lock.Lock()
+							got[key]++
+							lock.Unlock()
+						}
+					}()
+				}
+				total += n
+			}
+			waitWaiters(t, b, total)
+			for i := 0; i < tt.tokens; i++ {
+				putOnce(b)
+			}
+			waitWaiters(t, b, total-tt.tokens)
+			b.Close()
+			wg.Wait()
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFairBucket_Limit(t *testing.T) {
+	b := NewFairBucket(time.Hour, 2)
+	ctx := context.Background()
+	putOnce(b)
+	putOnce(b)
+	putOnce(b)
+	for _, want := range []bool{false, false, true} {
+		got, err := b.Limit(ctx, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	b.Close()
+	got, err := b.Limit(ctx, "a")
+	assert.ErrorIs(t, err, limiter.ErrClosed)
+	assert.False(t, got)
+}
+
+func TestFairBucket_Put(t *testing.T) {
+	clk := fakeclock.New(time.Now())
+	b := NewFairBucket(10*time.Millisecond, 1, WithClock(clk))
+	go b.Put()
+	ctx := context.Background()
+	// Put 开始时立即放置一个令牌, 之后每 10ms 放置一个令牌
+	clk.BlockUntil(1)
+	got, err := b.Limit(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.BlockLimit(ctx, "a")
+		done <- err
+	}()
+	waitWaiters(t, b, 1)
+	clk.Advance(10 * time.Millisecond)
+	assert.NoError(t, <-done)
+	b.Close()
+	assert.Equal(t, 0, clk.Waiters())
+}
+
+func TestFairBucket_Cancel(t *testing.T) {
+	b := NewFairBucket(time.Hour, 1)
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := b.BlockLimit(ctx, "a")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.True(t, got)
+	}()
+	waitWaiters(t, b, 1)
+	cancel()
+	<-done
+	// 取消的请求离开队列, 令牌放入桶中
+	waitWaiters(t, b, 0)
+	putOnce(b)
+	got, err := b.Limit(context.Background(), "b")
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestFairBucket_Admin(t *testing.T) {
+	b := NewFairBucket(time.Hour, 2)
+	defer b.Close()
+	ctx := context.Background()
+
+	// 令牌优先分配给等待的请求
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.BlockLimit(ctx, "a")
+		done <- err
+	}()
+	waitWaiters(t, b, 1)
+	require.NoError(t, b.Reset(ctx, "a"))
+	assert.NoError(t, <-done)
+	got, err := b.Inspect(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 1, Remaining: 1}, got)
+
+	require.NoError(t, b.Adjust(ctx, "a", -1))
+	limited, err := b.Limit(ctx, "b")
+	assert.NoError(t, err)
+	assert.True(t, limited)
+
+	require.NoError(t, b.Adjust(ctx, "a", 1))
+	limited, err = b.Limit(ctx, "b")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+}
+
+// 很大的 delta 在放满之后立即返回, 不会长时间持有锁
+func TestFairBucket_AdjustHugeDelta(t *testing.T) {
+	b := NewFairBucket(time.Hour, 2)
+	defer b.Close()
+	ctx := context.Background()
+	done := make(chan error, 2)
+	for _, key := range []string{"a", "b"} {
+		go func(key string) {
+			_, err := b.BlockLimit(ctx, key)
+			done <- err
+		}(key)
+	}
+	waitWaiters(t, b, 2)
+
+	adjusted := make(chan error, 1)
+	go func() {
+		adjusted <- b.Adjust(ctx, "a", math.MaxInt64)
+	}()
+	select {
+	case err := <-adjusted:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Adjust 没有返回")
+	}
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	got, err := b.Inspect(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 2, Used: 0, Remaining: 2}, got)
+}
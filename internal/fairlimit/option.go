@@ -0,0 +1,60 @@
+package fairlimit
+
+import "github.com/udugong/limiter"
+
+// weightFunc 默认所有限流对象的权重都为 1
+func weightFunc(string) int {
+	return 1
+}
+
+// weightOf 权重至少为 1
+func weightOf(fn func(key string) int, key string) int {
+	w := fn(key)
+	if w < 1 {
+		return 1
+	}
+	return w
+}
+
+// CommonOption 同时适用于 FairActiveLimiter 与 FairBucket
+type CommonOption interface {
+	ActiveOption
+	BucketOption
+}
+
+type commonOption struct {
+	active func(*FairActiveLimiter)
+	bucket func(*FairBucket)
+}
+
+func (o commonOption) applyActive(l *FairActiveLimiter) {
+	o.active(l)
+}
+
+func (o commonOption) applyBucket(b *FairBucket) {
+	o.bucket(b)
+}
+
+// WithWeight 设置限流对象的权重, 权重越大分到的份额越多. 默认都为 1, 小于 1 时视为 1
+func WithWeight(fn func(key string) int) CommonOption {
+	return commonOption{
+		active: func(l *FairActiveLimiter) { l.weight = fn },
+		bucket: func(b *FairBucket) { b.weight = fn },
+	}
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) CommonOption {
+	return commonOption{
+		active: func(l *FairActiveLimiter) { l.observer = o },
+		bucket: func(b *FairBucket) { b.observer = o },
+	}
+}
+
+// WithClock 使用 c 获取当前时间与创建定时器, 默认为 limiter.SystemClock
+func WithClock(c limiter.Clock) CommonOption {
+	return commonOption{
+		active: func(l *FairActiveLimiter) { l.timeFunc = c.Now },
+		bucket: func(b *FairBucket) { b.clock = c },
+	}
+}
@@ -0,0 +1,272 @@
+package fakeclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+)
+
+// Clock 手动推进的 limiter.Clock, 只有调用 Advance 或 Set 时时间才会前进.
+// 推进时到期的 Timer 与 Ticker 按到期时间依次触发, 与 time 包一样,
+// 通道中已有未读取的值时丢弃本次触发. AfterFunc 的 f 在 Advance 中同步执行
+type Clock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	// changed 在等待中的 Timer 与 Ticker 的数量变化时关闭并替换, 用于 BlockUntil
+	changed chan struct{}
+	// sent 已经发送过值的通道, 用于 BlockUntilRead
+	sent map[chan time.Time]struct{}
+}
+
+// waiter 等待中的 Timer 或 Ticker
+type waiter struct {
+	when time.Time
+	// period Ticker 的周期, Timer 为 0
+	period time.Duration
+	ch     chan time.Time
+	fn     func()
+}
+
+// New 创建一个当前时间为 now 的 Clock
+func New(now time.Time) *Clock {
+	return &Clock{
+		now:     now,
+		changed: make(chan struct{}),
+		sent:    make(map[chan time.Time]struct{}),
+	}
+}
+
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) limiter.Timer {
+	t := &timer{clock: c, w: &waiter{ch: make(chan time.Time, 1)}}
+	t.Reset(d)
+	return t
+}
+
+func (c *Clock) AfterFunc(d time.Duration, f func()) limiter.Timer {
+	t := &timer{clock: c, w: &waiter{fn: f}}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker d 必须大于 0, 否则 panic
+func (c *Clock) NewTicker(d time.Duration) limiter.Ticker {
+	if d <= 0 {
+		panic("fakeclock: NewTicker 的 d 必须大于 0")
+	}
+	t := &ticker{clock: c, w: &waiter{ch: make(chan time.Time, 1)}}
+	t.Reset(d)
+	return t
+}
+
+// Advance 将时间推进 d, 并依次触发到期的 Timer 与 Ticker
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	target := c.now.Add(d)
+	c.lock.Unlock()
+	c.advanceTo(target)
+}
+
+// Set 将时间设置为 t. t 晚于当前时间时与 Advance 相同, 否则只修改当前时间
+func (c *Clock) Set(t time.Time) {
+	c.lock.Lock()
+	if !t.After(c.now) {
+		c.now = t
+		c.lock.Unlock()
+		return
+	}
+	c.lock.Unlock()
+	c.advanceTo(t)
+}
+
+func (c *Clock) advanceTo(target time.Time) {
+	for {
+		c.lock.Lock()
+		if len(c.waiters) == 0 || c.waiters[0].when.After(target) {
+			if target.After(c.now) {
+				c.now = target
+			}
+			c.lock.Unlock()
+			return
+		}
+		w := c.waiters[0]
+		if w.when.After(c.now) {
+			c.now = w.when
+		}
+		fn := c.fire(w)
+		c.lock.Unlock()
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// fire 触发 w, 返回需要执行的 AfterFunc 的 f. 调用方需要持有锁
+func (c *Clock) fire(w *waiter) func() {
+	if w.period > 0 {
+		w.when = w.when.Add(w.period)
+		c.sort()
+	} else {
+		c.remove(w)
+	}
+	if w.fn != nil {
+		return w.fn
+	}
+	select {
+	case w.ch <- c.now:
+		c.sent[w.ch] = struct{}{}
+	default:
+	}
+	return nil
+}
+
+// Waiters 等待中的 Timer 与 Ticker 的数量
+func (c *Clock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil 阻塞直到至少有 n 个等待中的 Timer 与 Ticker.
+// 用于在推进时间之前, 确认被测试的 goroutine 已经开始等待
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.lock.Lock()
+		if len(c.waiters) >= n {
+			c.lock.Unlock()
+			return
+		}
+		ch := c.changed
+		c.lock.Unlock()
+		<-ch
+	}
+}
+
+// readPollInterval BlockUntilRead 检查通道是否被读取的间隔
+const readPollInterval = 100 * time.Microsecond
+
+// BlockUntilRead 阻塞直到 Timer 与 Ticker 已经发送的值都从通道中被读取.
+// 只保证值被读取, 不保证被测试的 goroutine 已经处理完, 返回时它可能还在处理,
+// 断言处理的结果时需要重试(如 require.Eventually), 只有断言结果没有变化时可以直接判断.
+// 读取通道不会通知 Clock, 因此每隔 readPollInterval 检查一次.
+// Stop 或 Reset 之后通道中没有被读取的值不再等待
+func (c *Clock) BlockUntilRead() {
+	for {
+		c.lock.Lock()
+		for ch := range c.sent {
+			if len(ch) == 0 {
+				delete(c.sent, ch)
+			}
+		}
+		n := len(c.sent)
+		c.lock.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(readPollInterval)
+	}
+}
+
+// schedule 在 d 之后触发 w, d 小于等于 0 时立即触发. 返回 w 之前是否在等待
+func (c *Clock) schedule(w *waiter, d time.Duration) bool {
+	c.lock.Lock()
+	active := c.remove(w)
+	delete(c.sent, w.ch)
+	w.when = c.now.Add(d)
+	if d > 0 || w.period > 0 {
+		c.waiters = append(c.waiters, w)
+		c.sort()
+		c.notify()
+		c.lock.Unlock()
+		return active
+	}
+	// 与 time.AfterFunc 一样, 立即触发的 f 在新的 goroutine 中执行
+	fn := c.fire(w)
+	c.lock.Unlock()
+	if fn != nil {
+		go fn()
+	}
+	return active
+}
+
+// stop 停止 w, 返回 w 之前是否在等待
+func (c *Clock) stop(w *waiter) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.sent, w.ch)
+	return c.remove(w)
+}
+
+// remove 调用方需要持有锁
+func (c *Clock) remove(w *waiter) bool {
+	for i, v := range c.waiters {
+		if v == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.notify()
+			return true
+		}
+	}
+	return false
+}
+
+// sort 按到期时间排序, 同时到期时保持创建的顺序. 调用方需要持有锁
+func (c *Clock) sort() {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].when.Before(c.waiters[j].when)
+	})
+}
+
+// notify 唤醒 BlockUntil. 调用方需要持有锁
+func (c *Clock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+type timer struct {
+	clock *Clock
+	w     *waiter
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *timer) Stop() bool {
+	return t.clock.stop(t.w)
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	return t.clock.schedule(t.w, d)
+}
+
+type ticker struct {
+	clock *Clock
+	w     *waiter
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *ticker) Stop() {
+	t.clock.stop(t.w)
+}
+
+// Reset d 必须大于 0, 否则 panic
+func (t *ticker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("fakeclock: Ticker.Reset 的 d 必须大于 0")
+	}
+	t.clock.lock.Lock()
+	t.w.period = d
+	t.clock.lock.Unlock()
+	t.clock.schedule(t.w, d)
+}
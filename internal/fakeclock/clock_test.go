@@ -0,0 +1,138 @@
+package fakeclock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.UnixMilli(1695571200000)
+
+func TestClock_Timer(t *testing.T) {
+	c := New(start)
+	timer := c.NewTimer(10 * time.Second)
+	assert.Equal(t, 1, c.Waiters())
+
+	c.Advance(9 * time.Second)
+	assertNoTick(t, timer.C())
+	c.Advance(2 * time.Second)
+	assert.Equal(t, start.Add(10*time.Second), <-timer.C())
+	assert.Equal(t, start.Add(11*time.Second), c.Now())
+	assert.Equal(t, 0, c.Waiters())
+	assert.False(t, timer.Stop())
+
+	assert.False(t, timer.Reset(time.Second))
+	assert.True(t, timer.Stop())
+	c.Advance(time.Second)
+	assertNoTick(t, timer.C())
+
+	// 立即到期
+	timer.Reset(0)
+	assert.Equal(t, start.Add(12*time.Second), <-timer.C())
+}
+
+func TestClock_Ticker(t *testing.T) {
+	c := New(start)
+	ticker := c.NewTicker(time.Second)
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// 没有读取时丢弃之后的触发
+	c.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	assertNoTick(t, ticker.C())
+
+	ticker.Reset(5 * time.Second)
+	c.Advance(4 * time.Second)
+	assertNoTick(t, ticker.C())
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(9*time.Second), <-ticker.C())
+
+	ticker.Stop()
+	assert.Equal(t, 0, c.Waiters())
+	c.Advance(time.Minute)
+	assertNoTick(t, ticker.C())
+
+	assert.Panics(t, func() { c.NewTicker(0) })
+}
+
+func TestClock_AfterFunc(t *testing.T) {
+	c := New(start)
+	var got []string
+	c.AfterFunc(2*time.Second, func() { got = append(got, "b") })
+	c.AfterFunc(time.Second, func() {
+		got = append(got, "a")
+		// f 中看到的是到期的时间
+		assert.Equal(t, start.Add(time.Second), c.Now())
+	})
+	stopped := c.AfterFunc(time.Second, func() { got = append(got, "c") })
+	assert.True(t, stopped.Stop())
+	assert.Nil(t, stopped.C())
+
+	c.Advance(3 * time.Second)
+	assert.Equal(t, []string{"a", "b"}, got)
+
+	done := make(chan struct{})
+	c.AfterFunc(0, func() { close(done) })
+	<-done
+}
+
+func TestClock_Set(t *testing.T) {
+	c := New(start)
+	timer := c.NewTimer(time.Minute)
+	c.Set(start.Add(-time.Hour))
+	assert.Equal(t, start.Add(-time.Hour), c.Now())
+	assertNoTick(t, timer.C())
+
+	c.Set(start.Add(time.Minute))
+	assert.Equal(t, start.Add(time.Minute), <-timer.C())
+}
+
+func TestClock_BlockUntil(t *testing.T) {
+	c := New(start)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-c.NewTimer(time.Second).C()
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-done)
+}
+
+func TestClock_BlockUntilRead(t *testing.T) {
+	c := New(start)
+	ticker := c.NewTicker(time.Second)
+	var got []time.Time
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			got = append(got, <-ticker.C())
+		}
+	}()
+	// 没有发送过值时立即返回
+	c.BlockUntilRead()
+	c.Advance(time.Second)
+	c.BlockUntilRead()
+	c.Advance(time.Second)
+	c.BlockUntilRead()
+	<-done
+	assert.Equal(t, []time.Time{start.Add(time.Second), start.Add(2 * time.Second)}, got)
+	ticker.Stop()
+
+	// Stop 之后不再等待没有被读取的值
+	timer := c.NewTimer(time.Second)
+	c.Advance(time.Second)
+	timer.Stop()
+	c.BlockUntilRead()
+}
+
+func assertNoTick(t *testing.T, ch <-chan time.Time) {
+	t.Helper()
+	select {
+	case v := <-ch:
+		t.Errorf("不应触发, 实际在 %v 触发", v)
+	default:
+	}
+}
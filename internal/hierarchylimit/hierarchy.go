@@ -0,0 +1,125 @@
+package hierarchylimit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// Result 分层限流的结果
+type Result struct {
+	// Limited 是否限流
+	Limited bool
+	// Level 限流的层的名称, 没有限流时为空
+	Level string
+}
+
+// Level 分层限流中的一层
+type Level struct {
+	// Name 层的名称, 例如 "user"、"tenant"、"cluster"
+	Name string
+	// Key 将请求的限流对象映射为这一层的限流对象, 例如从用户映射到所属的租户. 为 nil 时不映射
+	Key func(key string) string
+	// Limiter 这一层的限流器
+	Limiter limiter.Limiter
+}
+
+func (l Level) key(key string) string {
+	if l.Key == nil {
+		return key
+	}
+	return l.Key(key)
+}
+
+// HierarchicalLimiter 本地的分层限流器.
+// 按从叶子到根的顺序依次判断每一层, 任意一层限流时撤销已经通过的层, 使被限流的请求不计入任何一层.
+// 所有层的判断与撤销在同一把锁内完成, 是原子的.
+// 除根以外的层的限流器需要实现 limiter.Reserver 或 limiter.Reverter, 优先使用 limiter.Reserver 撤销这一次计入的请求.
+// 没有实现 limiter.Admin, 每一层的状态需要通过该层的限流器分别管理
+type HierarchicalLimiter struct {
+	levels   []Level
+	observer limiter.Observer
+	lock     sync.Mutex
+}
+
+// NewHierarchicalLimiter levels 按从叶子到根的顺序排列, 例如 user、tenant、cluster.
+// 除根以外的层的限流器没有实现 limiter.Reserver 或 limiter.Reverter 时返回 limiter.ErrInvalidConfig
+func NewHierarchicalLimiter(levels []Level, opts ...LocalOption) (*HierarchicalLimiter, error) {
+	for i := 0; i < len(levels)-1; i++ {
+		switch levels[i].Limiter.(type) {
+		case limiter.Reserver, limiter.Reverter:
+		default:
+			return nil, errs.InvalidConfig("第 %d 层 %s 的限流器 %T 不支持撤销", i, levels[i].Name, levels[i].Limiter)
+		}
+	}
+	h := &HierarchicalLimiter{levels: levels}
+	for _, opt := range opts {
+		opt.applyLocal(h)
+	}
+	return h, nil
+}
+
+func (h *HierarchicalLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := h.Decide(ctx, key)
+	return res.Limited, err
+}
+
+// Decide 判断是否限流, 并返回限流的层
+func (h *HierarchicalLimiter) Decide(ctx context.Context, key string) (Result, error) {
+	res, err := h.decide(ctx, key)
+	observer.Notify(ctx, h.observer, key, res.Limited, err)
+	return res, err
+}
+
+func (h *HierarchicalLimiter) decide(ctx context.Context, key string) (Result, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	cancels := make([]func(context.Context) error, 0, len(h.levels))
+	for _, level := range h.levels {
+		limited, cancel, err := reserve(ctx, level.Limiter, level.key(key))
+		if err == nil && !limited {
+			cancels = append(cancels, cancel)
+			continue
+		}
+		if rerr := revert(ctx, cancels); rerr != nil && err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Limited: true, Level: level.Name}, nil
+	}
+	return Result{}, nil
+}
+
+// reserve 判断一层, 没有被限流时返回撤销这一层的 cancel. 根的限流器不支持撤销时 cancel 为 nil
+func reserve(ctx context.Context, l limiter.Limiter, key string) (bool, func(context.Context) error, error) {
+	if r, ok := l.(limiter.Reserver); ok {
+		return r.Reserve(ctx, key)
+	}
+	limited, err := l.Limit(ctx, key)
+	if err != nil || limited {
+		return limited, nil, err
+	}
+	r, ok := l.(limiter.Reverter)
+	if !ok {
+		return false, nil, nil
+	}
+	return false, func(ctx context.Context) error {
+		return r.Revert(ctx, key)
+	}, nil
+}
+
+// revert 按从根到叶子的顺序撤销已经通过的层
+func revert(ctx context.Context, cancels []func(context.Context) error) error {
+	var err error
+	for i := len(cancels) - 1; i >= 0; i-- {
+		if e := cancels[i](ctx); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+-- 每一层的滑动窗口, KEYS 按从叶子到根的顺序
+-- ARGV[1] 当前时间, 小于 0 时使用 redis 服务器的时间
+-- ARGV[2] 请求的唯一标识
+-- ARGV[3..] 每一层的窗口大小与阈值
+local now = tonumber(ARGV[1])
+local id = ARGV[2]
+if now < 0 then
+    redis.replicate_commands()
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+
+-- 先检查所有层, 任意一层限流时不计入任何一层
+for i, key in ipairs(KEYS) do
+    local window = tonumber(ARGV[1 + i * 2])
+    local threshold = tonumber(ARGV[2 + i * 2])
+    redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+    local cnt = redis.call('ZCOUNT', key, '-inf', '+inf')
+    if cnt >= threshold then
+        -- 返回限流的层, 从 1 开始
+        return i
+    end
+end
+
+for i, key in ipairs(KEYS) do
+    local window = tonumber(ARGV[1 + i * 2])
+    redis.call('ZADD', key, now, now .. ':' .. id)
+    redis.call('PEXPIRE', key, window)
+end
+return 0
@@ -0,0 +1,231 @@
+package hierarchylimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/keyedlimit"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+	"github.com/udugong/limiter/internal/queue"
+	"github.com/udugong/limiter/internal/slidewindowlimit"
+)
+
+// tenantOf 限流对象的格式为 tenant/user
+func tenantOf(key string) string {
+	return strings.SplitN(key, "/", 2)[0]
+}
+
+func newLocalLevel(name string, rate int, now *time.Time, key func(string) string) Level {
+	return Level{
+		Name: name,
+		Key:  key,
+		Limiter: keyedlimit.NewKeyedLimiter(func() limiter.Limiter {
+			return slidewindowlimit.NewLocalSlideWindowLimiter(time.Second, queue.NewArrayBoundedQueue(rate),
+				slidewindowlimit.WithTimeFunc(func() time.Time { return *now }))
+		}),
+	}
+}
+
+func TestHierarchicalLimiter_Decide(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	h, err := NewHierarchicalLimiter([]Level{
+		newLocalLevel("user", 2, &now, nil),
+		newLocalLevel("tenant", 3, &now, tenantOf),
+		newLocalLevel("cluster", 4, &now, func(string) string { return "" }),
+	})
+	require.NoError(t, err)
+	steps := []struct {
+		key  string
+		want Result
+	}{
+		{key: "a/1", want: Result{}},
+		{key: "a/1", want: Result{}},
+		{key: "a/1", want: Result{Limited: true, Level: "user"}},
+		{key: "a/2", want: Result{}},
+		// 租户 a 已经用完 3 个额度
+		{key: "a/3", want: Result{Limited: true, Level: "tenant"}},
+		{key: "b/1", want: Result{}},
+		// 集群已经用完 4 个额度, 被限流的请求不计入 user 与 tenant
+		{key: "b/1", want: Result{Limited: true, Level: "cluster"}},
+		{key: "c/1", want: Result{Limited: true, Level: "cluster"}},
+	}
+	for i, step := range steps {
+		got, err := h.Decide(context.Background(), step.key)
+		require.NoError(t, err)
+		assert.Equalf(t, step.want, got, "step %d", i)
+	}
+
+	// 放宽集群的阈值后, 之前被集群限流的 b/1 没有占用 user 的额度
+	h.levels[2] = newLocalLevel("cluster", 100, &now, func(string) string { return "" })
+	got, err := h.Decide(context.Background(), "b/1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{}, got)
+	got, err = h.Decide(context.Background(), "b/1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limited: true, Level: "user"}, got)
+}
+
+// 并发时没有任何一层超过阈值, 被限流的请求也不会占用其他层的额度
+func TestHierarchicalLimiter_Concurrent(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	h, err := NewHierarchicalLimiter([]Level{
+		newLocalLevel("user", 2, &now, nil),
+		newLocalLevel("tenant", 5, &now, tenantOf),
+		newLocalLevel("cluster", 8, &now, func(string) string { return "" }),
+	})
+	require.NoError(t, err)
+	var (
+		lock    sync.Mutex
+		users   = make(map[string]int)
+		tenants = make(map[string]int)
+		total   int
+		wg      sync.WaitGroup
+	)
+	for _, tenant := range []string{"a", "b", "c"} {
+		for _, user := range []string{"1", "2", "3", "4"} {
+			key := tenant + "/" + user
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					got, err := h.Decide(context.Background(), key)
+					assert.NoError(t, err)
+					if got.Limited {
+						return
+					}
+					lock.Lock()
+					defer lock.Unlock()
+					users[key]++
+					tenants[tenantOf(key)]++
+					total++
+				}()
+			}
+		}
+	}
+	wg.Wait()
+	for key, n := range users {
+		assert.LessOrEqual(t, n, 2, key)
+	}
+	for key, n := range tenants {
+		assert.LessOrEqual(t, n, 5, key)
+	}
+	// 判断是原子的, 不会因为稍后被撤销的请求而少放行
+	assert.Equal(t, 8, total)
+}
+
+// reserveLimiter 同时实现 limiter.Limiter 与 limiter.Reserver
+type reserveLimiter struct {
+	*limitermocks.MockLimiter
+	*limitermocks.MockReserver
+}
+
+// 优先使用 Reserve 撤销这一次计入的请求
+func TestHierarchicalLimiter_Reserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	leaf := reserveLimiter{limitermocks.NewMockLimiter(ctrl), limitermocks.NewMockReserver(ctrl)}
+	root := limitermocks.NewMockLimiter(ctrl)
+	h, err := NewHierarchicalLimiter([]Level{
+		{Name: "leaf", Limiter: leaf},
+		{Name: "root", Limiter: root},
+	})
+	require.NoError(t, err)
+
+	var canceled int
+	leaf.MockReserver.EXPECT().Reserve(gomock.Any(), "a").Return(false, func(context.Context) error {
+		canceled++
+		return nil
+	}, nil)
+	root.EXPECT().Limit(gomock.Any(), "a").Return(true, nil)
+	got, err := h.Decide(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Limited: true, Level: "root"}, got)
+	assert.Equal(t, 1, canceled)
+}
+
+// revertLimiter 同时实现 limiter.Limiter 与 limiter.Reverter
+type revertLimiter struct {
+	*limitermocks.MockLimiter
+	*limitermocks.MockReverter
+}
+
+func TestHierarchicalLimiter_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockErr := errors.New("mock error")
+
+	// 除根以外的层不支持撤销
+	_, err := NewHierarchicalLimiter([]Level{
+		{Name: "leaf", Limiter: limitermocks.NewMockLimiter(ctrl)},
+		{Name: "root", Limiter: limitermocks.NewMockLimiter(ctrl)},
+	})
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+
+	leaf := revertLimiter{limitermocks.NewMockLimiter(ctrl), limitermocks.NewMockReverter(ctrl)}
+	root := limitermocks.NewMockLimiter(ctrl)
+	h, err := NewHierarchicalLimiter([]Level{
+		{Name: "leaf", Limiter: leaf},
+		{Name: "root", Limiter: root},
+	})
+	require.NoError(t, err)
+
+	// root 出错时撤销 leaf
+	leaf.MockLimiter.EXPECT().Limit(gomock.Any(), "a").Return(false, nil)
+	root.EXPECT().Limit(gomock.Any(), "a").Return(false, mockErr)
+	leaf.MockReverter.EXPECT().Revert(gomock.Any(), "a").Return(nil)
+	got, err := h.Decide(context.Background(), "a")
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, Result{}, got)
+
+	// root 限流时撤销 leaf 失败
+	leaf.MockLimiter.EXPECT().Limit(gomock.Any(), "a").Return(false, nil)
+	root.EXPECT().Limit(gomock.Any(), "a").Return(true, nil)
+	leaf.MockReverter.EXPECT().Revert(gomock.Any(), "a").Return(mockErr)
+	got, err = h.Decide(context.Background(), "a")
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, Result{}, got)
+
+	// leaf 限流时不会判断 root
+	leaf.MockLimiter.EXPECT().Limit(gomock.Any(), "a").Return(true, nil)
+	got, err = h.Decide(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Limited: true, Level: "leaf"}, got)
+}
+
+// countObserver 统计各类事件的次数
+type countObserver struct {
+	limiter.NopObserver
+	allow, limit, errs int
+}
+
+func (c *countObserver) OnAllow(context.Context, string) { c.allow++ }
+
+func (c *countObserver) OnLimit(context.Context, string) { c.limit++ }
+
+func (c *countObserver) OnError(context.Context, string, error) { c.errs++ }
+
+func TestHierarchicalLimiter_Observer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	root := limitermocks.NewMockLimiter(ctrl)
+	o := &countObserver{}
+	h, err := NewHierarchicalLimiter([]Level{{Name: "root", Limiter: root}}, WithObserver(o))
+	require.NoError(t, err)
+
+	root.EXPECT().Limit(gomock.Any(), "a").Return(false, nil)
+	root.EXPECT().Limit(gomock.Any(), "a").Return(true, nil)
+	root.EXPECT().Limit(gomock.Any(), "a").Return(false, errors.New("mock error"))
+	for i := 0; i < 3; i++ {
+		_, _ = h.Limit(context.Background(), "a")
+	}
+	assert.Equal(t, &countObserver{allow: 1, limit: 1, errs: 1}, o)
+}
@@ -0,0 +1,35 @@
+package hierarchylimit
+
+import "github.com/udugong/limiter"
+
+// LocalOption 适用于 HierarchicalLimiter
+type LocalOption interface {
+	applyLocal(*HierarchicalLimiter)
+}
+
+// CommonOption 同时适用于 HierarchicalLimiter 与 RedisHierarchicalLimiter
+type CommonOption interface {
+	Option
+	LocalOption
+}
+
+type commonOption struct {
+	local func(*HierarchicalLimiter)
+	redis func(*RedisHierarchicalLimiter)
+}
+
+func (o commonOption) applyLocal(h *HierarchicalLimiter) {
+	o.local(h)
+}
+
+func (o commonOption) apply(r *RedisHierarchicalLimiter) {
+	o.redis(r)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) CommonOption {
+	return commonOption{
+		local: func(h *HierarchicalLimiter) { h.observer = o },
+		redis: func(r *RedisHierarchicalLimiter) { r.observer = o },
+	}
+}
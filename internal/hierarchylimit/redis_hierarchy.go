@@ -0,0 +1,209 @@
+package hierarchylimit
+
+import (
+	"context"
+	_ "embed"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+	"github.com/udugong/limiter/internal/rediskey"
+	"github.com/udugong/limiter/internal/slidewindowlimit"
+)
+
+//go:embed hierarchy.lua
+var luaHierarchy string
+
+// hierarchyScript 优先使用 EVALSHA 执行, 脚本不存在时退回 EVAL
+var hierarchyScript = redis.NewScript(luaHierarchy)
+
+// RedisLevel 基于 redis 的分层限流中的一层
+type RedisLevel struct {
+	// Name 层的名称
+	Name string
+	// Key 将请求的限流对象映射为这一层的限流对象. 为 nil 时不映射
+	Key func(key string) string
+	// Limiter 提供这一层的窗口大小、阈值与 redis 上的 key.
+	// 与单独使用该限流器时计入同一个 key, 但不会调用它的 Limit
+	Limiter *slidewindowlimit.RedisSlidingWindowLimiter
+}
+
+// RedisHierarchicalLimiter 基于 redis 的分层滑动窗口限流器.
+// 在一个脚本中按从叶子到根的顺序检查每一层, 所有层都通过时才计入, 因此判断是原子的.
+// 在 redis cluster 中, 只有同一个请求在每一层的 key 落在同一个 slot 时(见 rediskey.SameSlot,
+// 例如所有层的 Prefix 使用同一个 hash tag)才在一个脚本中判断, 否则按从叶子到根的顺序每层执行一次脚本,
+// 任意一层限流时撤销已经计入的层. 此时判断不再是原子的, 并发时一个请求可能因为另一个稍后被撤销的请求而被限流.
+// 没有实现 limiter.Admin, 各层的滑动窗口没有对应的限流器, 无法单独查询或清空
+type RedisHierarchicalLimiter struct {
+	cmd        redis.Cmdable
+	levels     []RedisLevel
+	serverTime bool
+	cluster    bool
+	timeFunc   func() time.Time
+	observer   limiter.Observer
+}
+
+// NewRedisHierarchicalLimiter levels 按从叶子到根的顺序排列
+func NewRedisHierarchicalLimiter(cmd redis.Cmdable, levels []RedisLevel, opts ...Option) *RedisHierarchicalLimiter {
+	_, cluster := cmd.(*redis.ClusterClient)
+	r := &RedisHierarchicalLimiter{
+		cmd:      cmd,
+		levels:   levels,
+		cluster:  cluster,
+		timeFunc: func() time.Time { return time.Now() },
+	}
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	return r
+}
+
+type Option interface {
+	apply(*RedisHierarchicalLimiter)
+}
+
+type optionFunc func(*RedisHierarchicalLimiter)
+
+func (f optionFunc) apply(r *RedisHierarchicalLimiter) {
+	f(r)
+}
+
+// WithServerTime 使用 redis 服务器的时间
+func WithServerTime() Option {
+	return optionFunc(func(r *RedisHierarchicalLimiter) {
+		r.serverTime = true
+	})
+}
+
+// WithCluster cmd 连接的是 redis cluster. cmd 为 *redis.ClusterClient 时不需要设置
+func WithCluster() Option {
+	return optionFunc(func(r *RedisHierarchicalLimiter) {
+		r.cluster = true
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(r *RedisHierarchicalLimiter) {
+		r.timeFunc = fn
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
+
+func (r *RedisHierarchicalLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := r.Decide(ctx, key)
+	return res.Limited, err
+}
+
+// Decide 判断是否限流, 并返回限流的层
+func (r *RedisHierarchicalLimiter) Decide(ctx context.Context, key string) (Result, error) {
+	res, err := r.decide(ctx, key)
+	observer.Notify(ctx, r.observer, key, res.Limited, err)
+	return res, err
+}
+
+func (r *RedisHierarchicalLimiter) decide(ctx context.Context, key string) (Result, error) {
+	if len(r.levels) == 0 {
+		return Result{}, nil
+	}
+	keys := make([]string, len(r.levels))
+	for i, level := range r.levels {
+		l := level.Limiter
+		if l.Interval.Milliseconds() <= 0 {
+			return Result{}, errs.InvalidConfig("第 %d 层 %s 的窗口至少为 1ms, 实际为 %s", i, level.Name, l.Interval)
+		}
+		k := key
+		if level.Key != nil {
+			k = level.Key(key)
+		}
+		keys[i] = l.Keys.AlgoKey(k, rediskey.SuffixSlideWindow)
+	}
+	now := r.timeFunc().UnixMilli()
+	if r.serverTime {
+		now = -1
+	}
+	id := slidewindowlimit.NextMemberID()
+	var (
+		idx int
+		err error
+	)
+	if r.cluster && !rediskey.SameSlot(keys...) {
+		idx, err = r.decideEach(ctx, keys, now, id)
+	} else {
+		idx, err = r.decideAll(ctx, keys, now, id)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if idx <= 0 || idx > len(r.levels) {
+		return Result{}, nil
+	}
+	return Result{Limited: true, Level: r.levels[idx-1].Name}, nil
+}
+
+// decideAll 在一个脚本中判断所有层, 返回限流的层, 从 1 开始
+func (r *RedisHierarchicalLimiter) decideAll(ctx context.Context, keys []string, now int64, id string) (int, error) {
+	args := make([]any, 0, 2+len(r.levels)*2)
+	args = append(args, now, id)
+	for _, level := range r.levels {
+		args = append(args, level.Limiter.Interval.Milliseconds(), level.Limiter.Threshold())
+	}
+	idx, err := hierarchyScript.Run(ctx, r.cmd, keys, args...).Int()
+	return idx, errs.Backend(err)
+}
+
+// decideEach 每层执行一次脚本, 任意一层限流时撤销已经计入的层. 返回限流的层, 从 1 开始
+func (r *RedisHierarchicalLimiter) decideEach(ctx context.Context, keys []string, now int64, id string) (int, error) {
+	if now < 0 {
+		// 每层使用同一个时间, 撤销时才能找到已经计入的成员
+		t, err := r.cmd.Time(ctx).Result()
+		if err != nil {
+			return 0, errs.Backend(err)
+		}
+		now = t.UnixMilli()
+	}
+	for i, key := range keys {
+		l := r.levels[i].Limiter
+		idx, err := hierarchyScript.Run(ctx, r.cmd, []string{key}, now, id,
+			l.Interval.Milliseconds(), l.Threshold()).Int()
+		if err == nil && idx == 0 {
+			continue
+		}
+		rerr := r.revert(ctx, keys[:i], strconv.FormatInt(now, 10)+":"+id)
+		if err != nil {
+			return 0, errs.Backend(err)
+		}
+		if rerr != nil {
+			return 0, rerr
+		}
+		return i + 1, nil
+	}
+	return 0, nil
+}
+
+// revert 从 keys 中删除 member. pipeline 中每个命令只有一个 key, 在 redis cluster 中按 slot 拆分执行
+func (r *RedisHierarchicalLimiter) revert(ctx context.Context, keys []string, member string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.cmd.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			p.ZRem(ctx, key, member)
+		}
+		return nil
+	})
+	return errs.Backend(err)
+}
+
+// Preload 预先加载脚本到 redis, 可用于启动时的健康检查
+func (r *RedisHierarchicalLimiter) Preload(ctx context.Context) error {
+	return errs.Backend(hierarchyScript.Load(ctx, r.cmd).Err())
+}
@@ -0,0 +1,282 @@
+package hierarchylimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/redismocks"
+	"github.com/udugong/limiter/internal/rediskey"
+	"github.com/udugong/limiter/internal/redistest"
+	"github.com/udugong/limiter/internal/slidewindowlimit"
+)
+
+func TestRedisHierarchicalLimiter_Decide(t *testing.T) {
+	cli := initRedis()
+	now := time.UnixMilli(1695571200000)
+	newLevel := func(name string, rate int, key func(string) string) RedisLevel {
+		return RedisLevel{
+			Name: name,
+			Key:  key,
+			Limiter: slidewindowlimit.NewRedisSlidingWindowLimiter(cli, time.Second, rate,
+				slidewindowlimit.WithKeyPrefix("hierarchy_test:"+name)),
+		}
+	}
+	levels := []RedisLevel{
+		newLevel("user", 2, nil),
+		newLevel("tenant", 3, tenantOf),
+		newLevel("cluster", 4, func(string) string { return "all" }),
+	}
+	r := NewRedisHierarchicalLimiter(cli, levels, WithTimeFunc(func() time.Time { return now }))
+	keys := []string{
+		"hierarchy_test:user:a/1", "hierarchy_test:user:a/2", "hierarchy_test:user:a/3",
+		"hierarchy_test:user:b/1", "hierarchy_test:user:c/1",
+		"hierarchy_test:tenant:a", "hierarchy_test:tenant:b", "hierarchy_test:tenant:c",
+		"hierarchy_test:cluster:all",
+	}
+	require.NoError(t, cli.Del(context.Background(), keys...).Err())
+	defer cli.Del(context.Background(), keys...)
+
+	steps := []struct {
+		key  string
+		want Result
+	}{
+		{key: "a/1", want: Result{}},
+		{key: "a/1", want: Result{}},
+		{key: "a/1", want: Result{Limited: true, Level: "user"}},
+		{key: "a/2", want: Result{}},
+		{key: "a/3", want: Result{Limited: true, Level: "tenant"}},
+		{key: "b/1", want: Result{}},
+		{key: "b/1", want: Result{Limited: true, Level: "cluster"}},
+		{key: "c/1", want: Result{Limited: true, Level: "cluster"}},
+	}
+	for i, step := range steps {
+		got, err := r.Decide(context.Background(), step.key)
+		require.NoError(t, err)
+		assert.Equalf(t, step.want, got, "step %d", i)
+	}
+
+	// 被限流的请求不计入任何一层
+	cnt, err := cli.ZCard(context.Background(), "hierarchy_test:user:b/1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+	cnt, err = cli.ZCard(context.Background(), "hierarchy_test:tenant:c").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cnt)
+	// 与单独使用这一层的限流器计入同一个 key
+	cnt, err = cli.ZCard(context.Background(), "hierarchy_test:tenant:a").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), cnt)
+}
+
+// clusterTests redis cluster 上的分层限流. 每层限流 user 1, tenant 2, cluster 3
+var clusterTests = []struct {
+	name   string
+	prefix string
+	opts   []Option
+	// sameSlot 每一层的 key 是否在同一个 slot, 在同一个 slot 时在一个脚本中判断
+	sameSlot bool
+}{
+	{
+		name:     "shared_hash_tag",
+		prefix:   "{hierarchy_cluster_test}",
+		opts:     []Option{WithTimeFunc(func() time.Time { return time.UnixMilli(1695571200000) })},
+		sameSlot: true,
+	},
+	{
+		name:   "per_level",
+		prefix: "hierarchy_cluster_test",
+		opts:   []Option{WithTimeFunc(func() time.Time { return time.UnixMilli(1695571200000) })},
+	},
+	{
+		name:   "per_level_server_time",
+		prefix: "hierarchy_cluster_test",
+		opts:   []Option{WithServerTime()},
+	},
+}
+
+// clusterSteps 被集群限流的请求不计入 user 与 tenant
+var clusterSteps = []struct {
+	key  string
+	want Result
+}{
+	{key: "a/1", want: Result{}},
+	{key: "a/1", want: Result{Limited: true, Level: "user"}},
+	{key: "a/2", want: Result{}},
+	{key: "b/1", want: Result{}},
+	{key: "c/1", want: Result{Limited: true, Level: "cluster"}},
+}
+
+func newClusterLimiter(cli redis.Cmdable, prefix string, opts ...Option) *RedisHierarchicalLimiter {
+	newLevel := func(name string, rate int, key func(string) string) RedisLevel {
+		return RedisLevel{
+			Name: name,
+			Key:  key,
+			Limiter: slidewindowlimit.NewRedisSlidingWindowLimiter(cli, time.Minute, rate,
+				slidewindowlimit.WithKeyPrefix(prefix+":"+name)),
+		}
+	}
+	return NewRedisHierarchicalLimiter(cli, []RedisLevel{
+		newLevel("user", 1, nil),
+		newLevel("tenant", 2, tenantOf),
+		newLevel("cluster", 3, func(string) string { return "all" }),
+	}, opts...)
+}
+
+// fakeWindows 在内存中模拟 hierarchy.lua 与 ZREM, 窗口内的请求不会过期
+type fakeWindows struct {
+	members map[string]map[string]struct{}
+	// scripts 每次执行脚本的 key
+	scripts [][]string
+}
+
+func (f *fakeWindows) evalSha(ctx context.Context, _ string, keys []string, args ...any) *redis.Cmd {
+	f.scripts = append(f.scripts, keys)
+	cmd := redis.NewCmd(ctx)
+	for i, key := range keys {
+		if len(f.members[key]) >= args[3+2*i].(int) {
+			cmd.SetVal(int64(i + 1))
+			return cmd
+		}
+	}
+	member := strconv.FormatInt(args[0].(int64), 10) + ":" + args[1].(string)
+	for _, key := range keys {
+		if f.members[key] == nil {
+			f.members[key] = map[string]struct{}{}
+		}
+		f.members[key][member] = struct{}{}
+	}
+	cmd.SetVal(int64(0))
+	return cmd
+}
+
+func (f *fakeWindows) zrem(cmd redis.Cmder) {
+	args := cmd.Args()
+	for _, m := range args[2:] {
+		delete(f.members[args[1].(string)], m.(string))
+	}
+}
+
+// 每个脚本与 ZREM 的 key 都要在同一个 slot
+func TestRedisHierarchicalLimiter_Cluster(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	for _, tt := range clusterTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			windows := &fakeWindows{members: map[string]map[string]struct{}{}}
+			pipe := &redistest.Pipeliner{Reply: windows.zrem}
+			cmd.EXPECT().EvalSha(gomock.Any(), hierarchyScript.Hash(), gomock.Any(), gomock.Any()).
+				DoAndReturn(windows.evalSha).AnyTimes()
+			cmd.EXPECT().Pipelined(gomock.Any(), gomock.Any()).DoAndReturn(pipe.Pipelined).AnyTimes()
+			serverTime := redis.NewTimeCmd(context.Background())
+			serverTime.SetVal(now)
+			cmd.EXPECT().Time(gomock.Any()).Return(serverTime).AnyTimes()
+			r := newClusterLimiter(cmd, tt.prefix, append(tt.opts, WithCluster())...)
+
+			for i, step := range clusterSteps {
+				got, err := r.Decide(context.Background(), step.key)
+				require.NoError(t, err)
+				assert.Equalf(t, step.want, got, "step %d", i)
+			}
+
+			wantKeys := 1
+			if tt.sameSlot {
+				wantKeys = 3
+				assert.Len(t, windows.scripts, len(clusterSteps))
+				assert.Empty(t, pipe.Cmds)
+			} else {
+				assert.NotEmpty(t, pipe.Cmds)
+			}
+			for _, keys := range windows.scripts {
+				assert.Len(t, keys, wantKeys)
+				assert.Truef(t, rediskey.SameSlot(keys...), "脚本的 key 不在同一个 slot: %v", keys)
+			}
+			for _, c := range pipe.Cmds {
+				assert.NoError(t, redistest.CheckSlot(c))
+			}
+			assert.Empty(t, windows.members[tt.prefix+":user:c/1"])
+			assert.Empty(t, windows.members[tt.prefix+":tenant:c"])
+			assert.Len(t, windows.members[tt.prefix+":cluster:all"], 3)
+		})
+	}
+}
+
+// 可选的集成测试, localhost:16379 不可用时跳过
+func TestRedisHierarchicalLimiter_LiveCluster(t *testing.T) {
+	ctx := context.Background()
+	cli := redistest.LiveClusterClient(t, "localhost:16379")
+	for _, tt := range clusterTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newClusterLimiter(cli, tt.prefix, tt.opts...)
+			userKey := func(user string) string { return tt.prefix + ":user:" + user + "" }
+			tenantKey := func(tenant string) string { return tt.prefix + ":tenant:" + tenant + "" }
+			clusterKey := tt.prefix + ":cluster:all"
+			assert.Equal(t, tt.sameSlot, rediskey.SameSlot(userKey("a/1"), tenantKey("a"), clusterKey))
+			keys := []string{
+				userKey("a/1"), userKey("a/2"), userKey("b/1"), userKey("c/1"),
+				tenantKey("a"), tenantKey("b"), tenantKey("c"), clusterKey,
+			}
+			for _, k := range keys {
+				require.NoError(t, cli.Del(ctx, k).Err())
+				defer cli.Del(ctx, k)
+			}
+
+			for i, step := range clusterSteps {
+				got, err := r.Decide(ctx, step.key)
+				require.NoError(t, err)
+				assert.Equalf(t, step.want, got, "step %d", i)
+			}
+
+			cnt, err := cli.ZCard(ctx, userKey("c/1")).Result()
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), cnt)
+			cnt, err = cli.ZCard(ctx, tenantKey("c")).Result()
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), cnt)
+			cnt, err = cli.ZCard(ctx, clusterKey).Result()
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), cnt)
+		})
+	}
+}
+
+func TestRedisHierarchicalLimiter_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	now := time.UnixMilli(1695571200000)
+
+	levels := []RedisLevel{{
+		Name:    "user",
+		Limiter: slidewindowlimit.NewRedisSlidingWindowLimiter(cmd, time.Second, 1),
+	}}
+	o := &countObserver{}
+	r := NewRedisHierarchicalLimiter(cmd, levels, WithTimeFunc(func() time.Time { return now }), WithObserver(o))
+	res := redis.NewCmd(context.Background())
+	res.SetErr(context.DeadlineExceeded)
+	cmd.EXPECT().EvalSha(gomock.Any(), hierarchyScript.Hash(), []string{"a"},
+		now.UnixMilli(), gomock.Any(), int64(1000), 1).Return(res)
+	_, err := r.Limit(context.Background(), "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, &countObserver{errs: 1}, o)
+
+	levels[0].Limiter.Interval = time.Microsecond
+	_, err = r.Limit(context.Background(), "a")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+}
+
+func initRedis() redis.Cmdable {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:16379",
+	})
+	return redisClient
+}
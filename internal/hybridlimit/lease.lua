@@ -0,0 +1,45 @@
+-- 限流对象
+local key = KEYS[1]
+-- 阈值
+local threshold = tonumber(ARGV[1])
+-- 本次申请的额度
+local batch = tonumber(ARGV[2])
+-- 归还的未使用额度
+local returned = tonumber(ARGV[3])
+-- 归还的额度所属的窗口
+local returnedWindow = tonumber(ARGV[4])
+-- 窗口大小
+local interval = tonumber(ARGV[5])
+-- 当前时间, 小于 0 时使用 redis 服务器的时间
+local now = tonumber(ARGV[6])
+if now < 0 then
+    redis.replicate_commands()
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+local window = math.floor(now / interval)
+
+local cnt = 0
+if tonumber(redis.call('HGET', key, 'w')) == window then
+    cnt = tonumber(redis.call('HGET', key, 'c'))
+end
+-- 只有同一个窗口内未使用的额度才需要归还
+if returnedWindow == window then
+    cnt = cnt - returned
+    if cnt < 0 then
+        cnt = 0
+    end
+end
+local granted = threshold - cnt
+if granted > batch then
+    granted = batch
+end
+if granted < 0 then
+    granted = 0
+end
+cnt = cnt + granted
+-- 当前窗口剩余的时间
+local ttl = (window + 1) * interval - now
+redis.call('HSET', key, 'w', window, 'c', cnt)
+redis.call('PEXPIRE', key, ttl)
+return {granted, window, ttl}
@@ -0,0 +1,26 @@
+-- 限流对象
+local key = KEYS[1]
+-- 窗口大小
+local interval = tonumber(ARGV[1])
+-- 当前时间, 小于 0 时使用 redis 服务器的时间
+local now = tonumber(ARGV[2])
+-- 为正时归还额度, 为负时扣除额度
+local delta = tonumber(ARGV[3])
+if now < 0 then
+    redis.replicate_commands()
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+local window = math.floor(now / interval)
+
+local cnt = 0
+if tonumber(redis.call('HGET', key, 'w')) == window then
+    cnt = tonumber(redis.call('HGET', key, 'c'))
+end
+cnt = cnt - delta
+if cnt < 0 then
+    cnt = 0
+end
+redis.call('HSET', key, 'w', window, 'c', cnt)
+redis.call('PEXPIRE', key, (window + 1) * interval - now)
+return cnt
@@ -0,0 +1,392 @@
+package hybridlimit
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+	"github.com/udugong/limiter/internal/rediskey"
+)
+
+//go:embed lease.lua
+var luaLease string
+
+// leaseScript 优先使用 EVALSHA 执行, 脚本不存在时退回 EVAL
+var leaseScript = redis.NewScript(luaLease)
+
+//go:embed lease_adjust.lua
+var luaLeaseAdjust string
+
+var leaseAdjustScript = redis.NewScript(luaLeaseAdjust)
+
+// RedisLeaseLimiter 本地缓存 + Redis 的固定窗口限流器.
+// 每次从 Redis 上批量租用 batch 个额度在本地消耗, 以减少访问 Redis 的次数.
+// 租约在 syncInterval 后或窗口结束时过期, 过期时未使用的额度会在下一次租用时归还.
+// 租用不到额度时, 在租约过期前都会直接限流而不访问 Redis.
+// 代价是: 每个实例最多持有 batch 个暂未使用的额度, 其他实例可能因此被提前限流
+type RedisLeaseLimiter struct {
+	cmd redis.Cmdable
+	// 窗口大小
+	interval time.Duration
+	// 阈值
+	rate int64
+	// 每次租用的额度
+	batch int64
+	// 租约的有效期
+	syncInterval time.Duration
+	timeFunc     func() time.Time
+	// 使用 redis 服务器的时间判断窗口
+	serverTime bool
+	keys       rediskey.Builder
+	observer   limiter.Observer
+
+	lock   sync.Mutex
+	leases map[string]*lease
+	// lastSweep 上一次删除不再持有额度的租约的时间
+	lastSweep time.Time
+}
+
+// lease 某个 key 在本地的租约
+type lease struct {
+	lock sync.Mutex
+	// 租约所属的窗口, 归还额度时使用
+	window int64
+	// 剩余未使用的额度
+	remaining int64
+	expireAt  time.Time
+	// windowEnd 租约所属的窗口结束的时间, 之后未使用的额度不需要归还
+	windowEnd time.Time
+	// removed 已经从 RedisLeaseLimiter.leases 中删除, 需要重新获取
+	removed bool
+}
+
+// idle 租约已经过期, 并且没有需要归还的额度
+func (l *lease) idle(now time.Time) bool {
+	return !now.Before(l.expireAt) && (l.remaining <= 0 || !now.Before(l.windowEnd))
+}
+
+// NewRedisLeaseLimiter 创建租用额度的限流器. 在 interval 内允许 rate 个请求
+func NewRedisLeaseLimiter(cmd redis.Cmdable, interval time.Duration, rate int64, opts ...Option) *RedisLeaseLimiter {
+	r := &RedisLeaseLimiter{
+		cmd:          cmd,
+		interval:     interval,
+		rate:         rate,
+		batch:        50,
+		syncInterval: 100 * time.Millisecond,
+		timeFunc:     func() time.Time { return time.Now() },
+		leases:       make(map[string]*lease),
+	}
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	return r
+}
+
+type Option interface {
+	apply(*RedisLeaseLimiter)
+}
+
+type optionFunc func(*RedisLeaseLimiter)
+
+func (f optionFunc) apply(r *RedisLeaseLimiter) {
+	f(r)
+}
+
+// WithBatchSize 每次从 Redis 租用的额度. 默认 50
+func WithBatchSize(batch int64) Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.batch = batch
+	})
+}
+
+// WithSyncInterval 租约的有效期, 过期后归还未使用的额度并重新租用. 默认 100ms
+func WithSyncInterval(interval time.Duration) Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.syncInterval = interval
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.timeFunc = fn
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
+
+// WithServerTime 使用 redis 服务器的时间判断窗口, 避免各实例之间的时钟偏差.
+// 本地租约的过期时间依然使用 timeFunc
+func WithServerTime() Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.serverTime = true
+	})
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀
+func WithKeyPrefix(prefix string) Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.keys.Prefix = prefix
+	})
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster
+func WithHashTag() Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.keys.HashTag = true
+	})
+}
+
+// WithKeySuffix 在 redis 上的 key 后加上算法的后缀 "lease", 多个算法共用 redis 时避免 key 冲突.
+// 不设置时与之前的版本使用同一个 key, 开启后之前的计数不再生效
+func WithKeySuffix() Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.keys.Suffix = true
+	})
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) Option {
+	return optionFunc(func(r *RedisLeaseLimiter) {
+		r.observer = o
+	})
+}
+
+// getLease 返回 key 的租约并加锁, 调用方需要解锁
+func (r *RedisLeaseLimiter) getLease(key string) *lease {
+	for {
+		r.lock.Lock()
+		if now := r.timeFunc(); now.Sub(r.lastSweep) >= r.syncInterval {
+			r.sweep(now)
+		}
+		l, ok := r.leases[key]
+		if !ok {
+			l = &lease{}
+			r.leases[key] = l
+		}
+		r.lock.Unlock()
+		l.lock.Lock()
+		if !l.removed {
+			return l
+		}
+		l.lock.Unlock()
+	}
+}
+
+// sweep 删除不再持有额度的租约, 每个租约的有效期内最多执行一次. 正在使用的租约留到下一次.
+// 调用方需要持有 r.lock
+func (r *RedisLeaseLimiter) sweep(now time.Time) {
+	r.lastSweep = now
+	for key, l := range r.leases {
+		if !l.lock.TryLock() {
+			continue
+		}
+		if l.idle(now) {
+			l.removed = true
+			delete(r.leases, key)
+		}
+		l.lock.Unlock()
+	}
+}
+
+func (r *RedisLeaseLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := r.limit(ctx, key)
+	observer.Notify(ctx, r.observer, key, limited, err)
+	return limited, err
+}
+
+func (r *RedisLeaseLimiter) limit(ctx context.Context, key string) (bool, error) {
+	if err := r.validate(); err != nil {
+		return false, err
+	}
+	l := r.getLease(key)
+	defer l.lock.Unlock()
+	now := r.timeFunc()
+	if now.Before(l.expireAt) {
+		if l.remaining <= 0 {
+			return true, nil
+		}
+		l.remaining--
+		return false, nil
+	}
+
+	res, err := r.lease(ctx, key, r.batch, l.remaining, l.window, now)
+	if err != nil {
+		return false, err
+	}
+	l.window = res.window
+	l.remaining = res.granted
+	// 租约最多持续到窗口结束
+	ttl := r.syncInterval
+	if res.ttl < ttl {
+		ttl = res.ttl
+	}
+	l.expireAt = now.Add(ttl)
+	l.windowEnd = now.Add(res.ttl)
+	if l.remaining <= 0 {
+		return true, nil
+	}
+	l.remaining--
+	return false, nil
+}
+
+// LimitMany 依次判断多个限流对象, 只有租约过期的限流对象才会访问 redis
+func (r *RedisLeaseLimiter) LimitMany(ctx context.Context, keys []string) ([]bool, error) {
+	res := make([]bool, len(keys))
+	for i, key := range keys {
+		limited, err := r.Limit(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = limited
+	}
+	return res, nil
+}
+
+// Flush 归还所有 key 在当前窗口内未使用的额度. 一般在实例退出前调用
+func (r *RedisLeaseLimiter) Flush(ctx context.Context) error {
+	r.lock.Lock()
+	keys := make([]string, 0, len(r.leases))
+	for key := range r.leases {
+		keys = append(keys, key)
+	}
+	r.lock.Unlock()
+	for _, key := range keys {
+		if err := r.flush(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisLeaseLimiter) flush(ctx context.Context, key string) error {
+	l := r.getLease(key)
+	defer l.lock.Unlock()
+	if l.remaining > 0 {
+		if _, err := r.lease(ctx, key, 0, l.remaining, l.window, r.timeFunc()); err != nil {
+			return err
+		}
+	}
+	l.remaining = 0
+	l.expireAt = time.Time{}
+	return nil
+}
+
+// validate 窗口小于 1ms 或每次租用的额度小于 1 时无法放行任何请求
+func (r *RedisLeaseLimiter) validate() error {
+	if r.interval.Milliseconds() <= 0 {
+		return errs.InvalidConfig("interval 至少为 1ms, 实际为 %s", r.interval)
+	}
+	if r.batch <= 0 {
+		return errs.InvalidConfig("batch 必须大于0, 实际为 %d", r.batch)
+	}
+	return nil
+}
+
+// Preload 预先加载脚本到 redis, 可用于启动时的健康检查
+func (r *RedisLeaseLimiter) Preload(ctx context.Context) error {
+	return errs.Backend(leaseScript.Load(ctx, r.cmd).Err())
+}
+
+type leaseResult struct {
+	granted int64
+	window  int64
+	// 当前窗口剩余的时间
+	ttl time.Duration
+}
+
+// lease 归还 returnedWindow 窗口内未使用的 returned 个额度, 并租用 batch 个额度
+func (r *RedisLeaseLimiter) lease(ctx context.Context, key string, batch, returned, returnedWindow int64,
+	now time.Time) (leaseResult, error) {
+	nowMilli := now.UnixMilli()
+	if r.serverTime {
+		nowMilli = -1
+	}
+	res, err := leaseScript.Run(ctx, r.cmd, []string{r.keys.AlgoKey(key, rediskey.SuffixLease)},
+		r.rate, batch, returned, returnedWindow, r.interval.Milliseconds(), nowMilli).Int64Slice()
+	if err != nil {
+		return leaseResult{}, errs.Backend(err)
+	}
+	if len(res) != 3 {
+		return leaseResult{}, errs.Backend(fmt.Errorf("hybridlimit: 非预期的脚本返回值 %v", res))
+	}
+	return leaseResult{
+		granted: res[0],
+		window:  res[1],
+		ttl:     time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+// Inspect 查询 key 在当前窗口已租出的额度, 包括各实例本地暂未使用的额度
+func (r *RedisLeaseLimiter) Inspect(ctx context.Context, key string) (limiter.State, error) {
+	if err := r.validate(); err != nil {
+		return limiter.State{}, err
+	}
+	now, err := r.nowMilli(ctx)
+	if err != nil {
+		return limiter.State{}, err
+	}
+	res, err := r.cmd.HMGet(ctx, r.keys.AlgoKey(key, rediskey.SuffixLease), "w", "c").Result()
+	if err != nil {
+		return limiter.State{}, errs.Backend(err)
+	}
+	var used int64
+	if w, ok := res[0].(string); ok && w == strconv.FormatInt(now/r.interval.Milliseconds(), 10) {
+		if c, ok := res[1].(string); ok {
+			used, _ = strconv.ParseInt(c, 10, 64)
+		}
+	}
+	return limiter.NewState(r.rate, used), nil
+}
+
+// Reset 清空 key 在 redis 上的计数与本实例的租约. 其他实例的租约在过期前依然有效
+func (r *RedisLeaseLimiter) Reset(ctx context.Context, key string) error {
+	l := r.getLease(key)
+	defer l.lock.Unlock()
+	if err := r.cmd.Del(ctx, r.keys.AlgoKey(key, rediskey.SuffixLease)).Err(); err != nil {
+		return errs.Backend(err)
+	}
+	l.remaining = 0
+	l.expireAt = time.Time{}
+	return nil
+}
+
+// Adjust 先归还本实例的租约, 再把 key 在当前窗口已租出的额度减少 delta, 最少为 0
+func (r *RedisLeaseLimiter) Adjust(ctx context.Context, key string, delta int64) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if err := r.flush(ctx, key); err != nil {
+		return err
+	}
+	now := r.timeFunc().UnixMilli()
+	if r.serverTime {
+		now = -1
+	}
+	err := leaseAdjustScript.Run(ctx, r.cmd, []string{r.keys.AlgoKey(key, rediskey.SuffixLease)},
+		r.interval.Milliseconds(), now, delta).Err()
+	return errs.Backend(err)
+}
+
+// nowMilli 返回当前的毫秒时间戳, 使用 redis 服务器的时间时查询 redis
+func (r *RedisLeaseLimiter) nowMilli(ctx context.Context) (int64, error) {
+	if !r.serverTime {
+		return r.timeFunc().UnixMilli(), nil
+	}
+	t, err := r.cmd.Time(ctx).Result()
+	if err != nil {
+		return 0, errs.Backend(err)
+	}
+	return t.UnixMilli(), nil
+}
@@ -0,0 +1,348 @@
+package hybridlimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/redismocks"
+)
+
+const (
+	testKey = "lease_limiter_test"
+	// testRedisKey testKey 在 redis 上的 key, 默认不加后缀
+	testRedisKey = testKey
+)
+
+func TestRedisLeaseLimiter_Limit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	l := NewRedisLeaseLimiter(cmd, time.Second, 3,
+		WithBatchSize(2),
+		WithSyncInterval(100*time.Millisecond),
+		WithTimeFunc(func() time.Time { return now }),
+	)
+	const window = int64(1695571200)
+	expectLease := func(returned, returnedWindow int64, granted, ttl int64) {
+		res := redis.NewCmd(context.Background())
+		res.SetVal([]interface{}{granted, window, ttl})
+		cmd.EXPECT().EvalSha(gomock.Any(), leaseScript.Hash(), []string{testRedisKey},
+			int64(3), int64(2), returned, returnedWindow, int64(1000), now.UnixMilli()).Return(res)
+	}
+
+	// 第一次租用 2 个额度
+	expectLease(0, 0, 2, 1000)
+	for i := 0; i < 2; i++ {
+		got, err := l.Limit(context.Background(), testKey)
+		assert.NoError(t, err)
+		assert.False(t, got)
+	}
+
+	// 额度用完, 租约未过期时直接限流
+	got, err := l.Limit(context.Background(), testKey)
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	// 租约过期后重新租用, 只剩 1 个额度. 用完的租约已经删除, 不需要归还额度
+	now = now.Add(100 * time.Millisecond)
+	expectLease(0, 0, 1, 900)
+	got, err = l.Limit(context.Background(), testKey)
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	// 窗口内租用不到额度
+	now = now.Add(100 * time.Millisecond)
+	expectLease(0, 0, 0, 800)
+	got, err = l.Limit(context.Background(), testKey)
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	// redis 出错
+	now = now.Add(100 * time.Millisecond)
+	res := redis.NewCmd(context.Background())
+	res.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().EvalSha(gomock.Any(), leaseScript.Hash(), []string{testRedisKey},
+		int64(3), int64(2), int64(0), int64(0), int64(1000), now.UnixMilli()).Return(res)
+	got, err = l.Limit(context.Background(), testKey)
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.EqualError(t, err, "后端不可用: mock redis error")
+	assert.False(t, got)
+}
+
+func TestRedisLeaseLimiter_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		opts     []Option
+	}{
+		{
+			name:     "interval_less_than_1ms",
+			interval: time.Microsecond,
+		},
+		{
+			name:     "batch_is_0",
+			interval: time.Second,
+			opts:     []Option{WithBatchSize(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			// 配置不合法时不会访问 redis
+			l := NewRedisLeaseLimiter(redismocks.NewMockCmdable(ctrl), tt.interval, 10, tt.opts...)
+			got, err := l.Limit(context.Background(), testKey)
+			assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+			assert.False(t, got)
+		})
+	}
+}
+
+func TestRedisLeaseLimiter_ServerTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	l := NewRedisLeaseLimiter(cmd, time.Second, 3, WithBatchSize(2), WithServerTime())
+	res := redis.NewCmd(context.Background())
+	res.SetVal([]interface{}{int64(2), int64(1695571200), int64(1000)})
+	cmd.EXPECT().EvalSha(gomock.Any(), leaseScript.Hash(), []string{testRedisKey},
+		int64(3), int64(2), int64(0), int64(0), int64(1000), int64(-1)).Return(res)
+	got, err := l.Limit(context.Background(), testKey)
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestRedisLeaseLimiter_Key(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	l := NewRedisLeaseLimiter(cmd, time.Second, 3, WithBatchSize(2), WithServerTime(),
+		WithKeyPrefix("limiter"), WithHashTag(), WithKeySuffix())
+	res := redis.NewCmd(context.Background())
+	res.SetVal([]interface{}{int64(2), int64(1695571200), int64(1000)})
+	cmd.EXPECT().EvalSha(gomock.Any(), leaseScript.Hash(), []string{"limiter:{" + testKey + "}:lease"},
+		int64(3), int64(2), int64(0), int64(0), int64(1000), int64(-1)).Return(res)
+	got, err := l.Limit(context.Background(), testKey)
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestRedisLeaseLimiter_Preload(t *testing.T) {
+	cli := initRedis()
+	l := NewRedisLeaseLimiter(cli, time.Second, 3)
+	require.NoError(t, l.Preload(context.Background()))
+	exists, err := cli.ScriptExists(context.Background(), leaseScript.Hash()).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true}, exists)
+}
+
+func TestRedisLeaseLimiter_Lifecycle(t *testing.T) {
+	cli := initRedis()
+	now := time.Now().Truncate(time.Second)
+	timeFunc := func() time.Time { return now }
+	l1 := NewRedisLeaseLimiter(cli, time.Second, 3, WithBatchSize(2), WithTimeFunc(timeFunc))
+	l2 := NewRedisLeaseLimiter(cli, time.Second, 3, WithBatchSize(2), WithTimeFunc(timeFunc))
+	tests := []struct {
+		name    string
+		op      func() (bool, error)
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "l1_lease",
+			op: func() (bool, error) {
+				return l1.Limit(context.Background(), testKey)
+			},
+			want: false,
+		},
+		{
+			name: "l2_lease",
+			op: func() (bool, error) {
+				return l2.Limit(context.Background(), testKey)
+			},
+			want: false,
+		},
+		{
+			name: "l2_limited",
+			op: func() (bool, error) {
+				return l2.Limit(context.Background(), testKey)
+			},
+			want: true,
+		},
+		{
+			// 归还 l1 未使用的额度
+			name: "l1_flush",
+			op: func() (bool, error) {
+				return false, l1.Flush(context.Background())
+			},
+			want: false,
+		},
+		{
+			// 租约过期后 l2 可以租用 l1 归还的额度
+			name: "l2_lease_returned",
+			op: func() (bool, error) {
+				now = now.Add(200 * time.Millisecond)
+				return l2.Limit(context.Background(), testKey)
+			},
+			want: false,
+		},
+	}
+	err := cli.Del(context.Background(), testRedisKey).Err()
+	require.NoError(t, err)
+	defer cli.Del(context.Background(), testRedisKey)
+	for _, tt := range tests {
+		got, err := tt.op()
+		assert.Equalf(t, tt.wantErr, err, "%s: failed", tt.name)
+		assert.Equalf(t, tt.want, got, "%s: failed", tt.name)
+	}
+}
+
+// 删除不再持有额度的租约, 未使用的额度在窗口结束前依然保留以便归还
+func TestRedisLeaseLimiter_Sweep(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	now := time.UnixMilli(1695571200000)
+	l := NewRedisLeaseLimiter(cli, time.Second, 2, WithBatchSize(2), WithKeyPrefix("lease_sweep_test"),
+		WithTimeFunc(func() time.Time { return now }))
+	keys := []string{"lease_sweep_test:a", "lease_sweep_test:b", "lease_sweep_test:c"}
+	require.NoError(t, cli.Del(ctx, keys...).Err())
+	defer cli.Del(ctx, keys...)
+	leased := func() []string {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		var res []string
+		for key := range l.leases {
+			res = append(res, key)
+		}
+		return res
+	}
+
+	// a 剩余 1 个额度, b 的额度已经用完
+	got, err := l.LimitMany(ctx, []string{"a", "b", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, false, false}, got)
+	assert.ElementsMatch(t, []string{"a", "b"}, leased())
+
+	// 租约过期, b 不再持有额度
+	now = now.Add(150 * time.Millisecond)
+	_, err = l.Limit(ctx, "c")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "c"}, leased())
+
+	// 窗口结束后 a 未使用的额度不需要归还
+	now = now.Add(850 * time.Millisecond)
+	_, err = l.Limit(ctx, "c")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"c"}, leased())
+
+	require.NoError(t, l.Flush(ctx))
+	now = now.Add(100 * time.Millisecond)
+	_, err = l.Limit(ctx, "a")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a"}, leased())
+}
+
+func TestRedisLeaseLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	now := time.Now().Truncate(time.Second)
+	l := NewRedisLeaseLimiter(cli, time.Second, 3, WithBatchSize(2),
+		WithTimeFunc(func() time.Time { return now }))
+	require.NoError(t, cli.Del(ctx, testRedisKey).Err())
+	defer cli.Del(ctx, testRedisKey)
+
+	// 租用 2 个额度, 本地使用了 1 个
+	got, err := l.Limit(ctx, testKey)
+	require.NoError(t, err)
+	require.False(t, got)
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+	}{
+		{
+			// 本地未使用的额度也算作已租出
+			name: "inspect",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 3, Used: 2, Remaining: 1},
+		},
+		{
+			// 先归还本地未使用的 1 个额度
+			name: "grant",
+			op:   func() error { return l.Adjust(ctx, testKey, 1) },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return l.Adjust(ctx, testKey, -5) },
+			want: limiter.State{Limit: 3, Used: 5, Remaining: 0},
+		},
+		{
+			name: "reset",
+			op:   func() error { return l.Reset(ctx, testKey) },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.op())
+			got, err := l.Inspect(ctx, testKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	// 清空本地的租约之后重新租用
+	got, err = l.Limit(ctx, testKey)
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	// 窗口结束后计数失效
+	now = now.Add(time.Second)
+	state, err := l.Inspect(ctx, testKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), state.Used)
+}
+
+func TestRedisLeaseLimiter_AdminServerTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	l := NewRedisLeaseLimiter(cmd, time.Second, 3, WithServerTime())
+	now := redis.NewTimeCmd(context.Background())
+	now.SetVal(time.UnixMilli(1695571200500))
+	cmd.EXPECT().Time(gomock.Any()).Return(now)
+	res := redis.NewSliceCmd(context.Background())
+	res.SetVal([]interface{}{"1695571200", "2"})
+	cmd.EXPECT().HMGet(gomock.Any(), testRedisKey, "w", "c").Return(res)
+	got, err := l.Inspect(context.Background(), testKey)
+	require.NoError(t, err)
+	assert.Equal(t, limiter.State{Limit: 3, Used: 2, Remaining: 1}, got)
+
+	adjust := redis.NewCmd(context.Background())
+	adjust.SetVal(int64(0))
+	cmd.EXPECT().EvalSha(gomock.Any(), leaseAdjustScript.Hash(), []string{testRedisKey},
+		int64(1000), int64(-1), int64(2)).Return(adjust)
+	assert.NoError(t, l.Adjust(context.Background(), testKey, 2))
+
+	timeErr := redis.NewTimeCmd(context.Background())
+	timeErr.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().Time(gomock.Any()).Return(timeErr)
+	_, err = l.Inspect(context.Background(), testKey)
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+}
+
+func initRedis() redis.Cmdable {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:16379",
+	})
+	return redisClient
+}
@@ -0,0 +1,217 @@
+package keyedlimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+)
+
+// registry 按 key 保存的限流器, 删除空闲超过 idleTimeout 的限流器
+type registry struct {
+	idleTimeout time.Duration
+	timeFunc    func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*entry
+	// idle 没有正在处理的请求的 key, 按最后一次使用的时间排序
+	idle *list.List
+}
+
+type entry struct {
+	l        limiter.Limiter
+	lastSeen time.Time
+	// active 正在处理的请求数, 只用于 KeyedActiveLimiter. 大于 0 时不会删除
+	active int64
+	// idle 没有正在处理的请求时在 registry.idle 中的位置
+	idle *list.Element
+}
+
+func newRegistry(opts []Option) *registry {
+	r := &registry{
+		idleTimeout: 10 * time.Minute,
+		timeFunc:    func() time.Time { return time.Now() },
+		entries:     make(map[string]*entry),
+		idle:        list.New(),
+	}
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	return r
+}
+
+type Option interface {
+	apply(*registry)
+}
+
+type optionFunc func(*registry)
+
+func (f optionFunc) apply(r *registry) {
+	f(r)
+}
+
+// WithIdleTimeout 超过 d 没有使用且没有正在处理的请求的 key 删除对应的限流器, 再次出现时重新创建.
+// d 应不小于限流器的窗口, 否则删除后 key 的限流会提前重置. 默认 10 分钟, 小于等于 0 时不删除
+func WithIdleTimeout(d time.Duration) Option {
+	return optionFunc(func(r *registry) {
+		r.idleTimeout = d
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(r *registry) {
+		r.timeFunc = fn
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
+
+// acquire 返回 key 的限流器, 不存在时使用 newFunc 创建. delta 为正在处理的请求数的变化
+func (r *registry) acquire(key string, newFunc func() limiter.Limiter, delta int64) limiter.Limiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.timeFunc()
+	r.expire(now)
+	e, ok := r.entries[key]
+	if !ok {
+		e = &entry{l: newFunc()}
+		r.entries[key] = e
+	}
+	e.lastSeen = now
+	e.active += delta
+	if e.active < 0 {
+		e.active = 0
+	}
+	switch {
+	case e.active > 0 && e.idle != nil:
+		r.idle.Remove(e.idle)
+		e.idle = nil
+	case e.active == 0 && e.idle == nil:
+		e.idle = r.idle.PushBack(key)
+	case e.idle != nil:
+		r.idle.MoveToBack(e.idle)
+	}
+	return e.l
+}
+
+// lookup 返回 key 已经创建的限流器
+func (r *registry) lookup(key string) (limiter.Limiter, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.l, true
+}
+
+// expire 删除空闲超过 idleTimeout 的限流器. 调用方需要持有锁
+func (r *registry) expire(now time.Time) {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	for e := r.idle.Front(); e != nil; e = r.idle.Front() {
+		key := e.Value.(string)
+		if now.Sub(r.entries[key].lastSeen) < r.idleTimeout {
+			return
+		}
+		r.idle.Remove(e)
+		delete(r.entries, key)
+	}
+}
+
+// KeyedLimiter 按 key 区分的本地限流器.
+// 每个 key 第一次出现时使用 newFunc 创建独立的限流器, 空闲的 key 见 WithIdleTimeout.
+// 没有实现 limiter.Admin, 每个 key 的限流器由 newFunc 创建, 不对外暴露
+type KeyedLimiter struct {
+	newFunc  func() limiter.Limiter
+	limiters *registry
+}
+
+func NewKeyedLimiter(newFunc func() limiter.Limiter, opts ...Option) *KeyedLimiter {
+	return &KeyedLimiter{
+		newFunc:  newFunc,
+		limiters: newRegistry(opts),
+	}
+}
+
+func (k *KeyedLimiter) get(key string) limiter.Limiter {
+	return k.limiters.acquire(key, k.newFunc, 0)
+}
+
+func (k *KeyedLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return k.get(key).Limit(ctx, key)
+}
+
+// Reserve 与 Limit 相同, 没有被限流时返回撤销这一次 Limit 的 cancel.
+// 限流器没有实现 limiter.Reserver 时, cancel 与 Revert 相同, 撤销的是最近一次没有被限流的 Limit
+func (k *KeyedLimiter) Reserve(ctx context.Context, key string) (bool, func(ctx context.Context) error, error) {
+	l := k.get(key)
+	if r, ok := l.(limiter.Reserver); ok {
+		return r.Reserve(ctx, key)
+	}
+	limited, err := l.Limit(ctx, key)
+	if err != nil || limited {
+		return limited, nil, err
+	}
+	return false, func(ctx context.Context) error {
+		return k.Revert(ctx, key)
+	}, nil
+}
+
+// Revert 撤销 key 对应的限流器最近一次没有被限流的 Limit. 限流器需要实现 limiter.Reverter
+func (k *KeyedLimiter) Revert(ctx context.Context, key string) error {
+	l, ok := k.limiters.lookup(key)
+	if !ok {
+		return nil
+	}
+	r, ok := l.(limiter.Reverter)
+	if !ok {
+		return errs.InvalidConfig("%T 不支持撤销", l)
+	}
+	return r.Revert(ctx, key)
+}
+
+// LimitMany 依次判断多个限流对象
+func (k *KeyedLimiter) LimitMany(ctx context.Context, keys []string) ([]bool, error) {
+	res := make([]bool, len(keys))
+	for i, key := range keys {
+		limited, err := k.Limit(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = limited
+	}
+	return res, nil
+}
+
+// KeyedActiveLimiter 按 key 区分的本地活跃请求数限流器.
+// 每个 key 第一次出现时使用 newFunc 创建独立的限流器, 有正在处理的请求的 key 不会被删除.
+// 与 KeyedLimiter 一样没有实现 limiter.Admin
+type KeyedActiveLimiter struct {
+	newFunc  func() limiter.Limiter
+	limiters *registry
+}
+
+func NewKeyedActiveLimiter(newFunc func() limiter.ActiveLimiter, opts ...Option) *KeyedActiveLimiter {
+	return &KeyedActiveLimiter{
+		newFunc:  func() limiter.Limiter { return newFunc() },
+		limiters: newRegistry(opts),
+	}
+}
+
+// Limit 活跃请求数增加1, 被限流时同样需要调用 Decr
+func (k *KeyedActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return k.limiters.acquire(key, k.newFunc, 1).Limit(ctx, key)
+}
+
+func (k *KeyedActiveLimiter) Decr(ctx context.Context, key string) error {
+	return k.limiters.acquire(key, k.newFunc, -1).(limiter.ActiveLimiter).Decr(ctx, key)
+}
@@ -0,0 +1,165 @@
+package keyedlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/activelimit"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+	"github.com/udugong/limiter/internal/queue"
+	"github.com/udugong/limiter/internal/slidewindowlimit"
+)
+
+func newSlideWindow() limiter.Limiter {
+	return slidewindowlimit.NewLocalSlideWindowLimiter(time.Minute, queue.NewArrayBoundedQueue(1))
+}
+
+func TestKeyedLimiter_Limit(t *testing.T) {
+	k := NewKeyedLimiter(newSlideWindow)
+	ctx := context.Background()
+	got, err := k.LimitMany(ctx, []string{"a", "b", "a"})
+	require.NoError(t, err)
+	// 每个 key 使用独立的限流器
+	assert.Equal(t, []bool{false, false, true}, got)
+
+	require.NoError(t, k.Revert(ctx, "a"))
+	limited, err := k.Limit(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+	// 没有出现过的 key 不需要撤销
+	assert.NoError(t, k.Revert(ctx, "c"))
+}
+
+func TestKeyedLimiter_RevertUnsupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "a").Return(false, nil)
+	k := NewKeyedLimiter(func() limiter.Limiter { return l })
+	_, err := k.Limit(context.Background(), "a")
+	require.NoError(t, err)
+	assert.ErrorIs(t, k.Revert(context.Background(), "a"), limiter.ErrInvalidConfig)
+}
+
+func TestKeyedLimiter_Reserve(t *testing.T) {
+	ctx := context.Background()
+	k := NewKeyedLimiter(newSlideWindow)
+	limited, cancel, err := k.Reserve(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, limited)
+	limited, _, err = k.Reserve(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, limited)
+	require.NoError(t, cancel(ctx))
+	limited, err = k.Limit(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+}
+
+// revertLimiter 同时实现 limiter.Limiter 与 limiter.Reverter
+type revertLimiter struct {
+	*limitermocks.MockLimiter
+	*limitermocks.MockReverter
+}
+
+// 限流器没有实现 limiter.Reserver 时, cancel 与 Revert 相同
+func TestKeyedLimiter_ReserveWithReverter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := revertLimiter{limitermocks.NewMockLimiter(ctrl), limitermocks.NewMockReverter(ctrl)}
+	k := NewKeyedLimiter(func() limiter.Limiter { return l })
+	l.MockLimiter.EXPECT().Limit(gomock.Any(), "a").Return(false, nil)
+	l.MockReverter.EXPECT().Revert(gomock.Any(), "a").Return(nil)
+	limited, cancel, err := k.Reserve(context.Background(), "a")
+	require.NoError(t, err)
+	require.False(t, limited)
+	assert.NoError(t, cancel(context.Background()))
+}
+
+func TestKeyedActiveLimiter(t *testing.T) {
+	k := NewKeyedActiveLimiter(func() limiter.ActiveLimiter {
+		return activelimit.NewLocalActiveLimiter(1)
+	})
+	ctx := context.Background()
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{{key: "a"}, {key: "b"}, {key: "a", want: true}} {
+		got, err := k.Limit(ctx, tt.key)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.key)
+	}
+	assert.NoError(t, k.Decr(ctx, "a"))
+	assert.NoError(t, k.Decr(ctx, "a"))
+	assert.ErrorIs(t, k.Decr(ctx, "a"), limiter.ErrOverRelease)
+}
+
+func TestKeyedLimiter_IdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(1695571200000)
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		// wantKeys 空闲 1 分钟后剩下的 key 数
+		wantKeys int
+	}{
+		{name: "expired", idleTimeout: time.Minute, wantKeys: 1},
+		{name: "not_expired", idleTimeout: 2 * time.Minute, wantKeys: 2},
+		{name: "disabled", idleTimeout: 0, wantKeys: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKeyedLimiter(func() limiter.Limiter {
+				return slidewindowlimit.NewLocalSlideWindowLimiter(time.Second, queue.NewArrayBoundedQueue(1))
+			}, WithIdleTimeout(tt.idleTimeout), WithTimeFunc(func() time.Time { return now }))
+			got, err := k.LimitMany(ctx, []string{"a", "b", "a"})
+			require.NoError(t, err)
+			assert.Equal(t, []bool{false, false, true}, got)
+
+			now = now.Add(30 * time.Second)
+			_, err = k.Limit(ctx, "b")
+			require.NoError(t, err)
+			now = now.Add(30 * time.Second)
+			_, err = k.Limit(ctx, "c")
+			require.NoError(t, err)
+			// b 在 30s 前使用过
+			assert.Len(t, k.limiters.entries, tt.wantKeys+1)
+			_, ok := k.limiters.lookup("a")
+			assert.Equal(t, tt.wantKeys == 2, ok)
+		})
+	}
+}
+
+// 有正在处理的请求的 key 不会被删除
+func TestKeyedActiveLimiter_IdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(1695571200000)
+	k := NewKeyedActiveLimiter(func() limiter.ActiveLimiter {
+		return activelimit.NewLocalActiveLimiter(1)
+	}, WithIdleTimeout(time.Minute), WithTimeFunc(func() time.Time { return now }))
+	got, err := k.Limit(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, got)
+
+	now = now.Add(2 * time.Minute)
+	_, err = k.Limit(ctx, "b")
+	require.NoError(t, err)
+	assert.Len(t, k.limiters.entries, 2)
+	got, err = k.Limit(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, got)
+	require.NoError(t, k.Decr(ctx, "a"))
+	require.NoError(t, k.Decr(ctx, "a"))
+
+	now = now.Add(time.Minute)
+	require.NoError(t, k.Decr(ctx, "b"))
+	assert.Len(t, k.limiters.entries, 1)
+	_, ok := k.limiters.lookup("a")
+	assert.False(t, ok)
+}
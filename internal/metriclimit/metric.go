@@ -0,0 +1,215 @@
+package metriclimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/udugong/limiter"
+)
+
+// Decision 限流判断的结果
+type Decision string
+
+const (
+	// Allowed 放行
+	Allowed Decision = "allowed"
+	// Limited 限流
+	Limited Decision = "limited"
+	// Errored 限流器本身出错
+	Errored Decision = "error"
+)
+
+// Collector 指标收集器.
+// name 为限流器的名称, group 为限流对象所属的分组
+type Collector interface {
+	// IncDecision 记录一次限流判断
+	IncDecision(name, group string, decision Decision)
+	// AddActive 活跃请求数变化
+	AddActive(name, group string, delta float64)
+	// IncReleaseError 记录一次 Decr 出错, 不计入限流判断
+	IncReleaseError(name, group string)
+	// ObserveWait 记录 BlockLimit 的等待时间
+	ObserveWait(name, group string, d time.Duration)
+	// ObserveLatency 记录限流器本身(如访问 redis)的耗时
+	ObserveLatency(name, group string, d time.Duration)
+}
+
+type config struct {
+	name      string
+	collector Collector
+	// keyGroup 将限流对象映射到分组, 分组的数量应当是有限的
+	keyGroup func(key string) string
+	timeFunc func() time.Time
+}
+
+func newConfig(name string, collector Collector, opts []Option) config {
+	c := config{
+		name:      name,
+		collector: collector,
+		keyGroup:  func(key string) string { return "" },
+		timeFunc:  func() time.Time { return time.Now() },
+	}
+	for _, opt := range opts {
+		opt.apply(&c)
+	}
+	return c
+}
+
+func (c config) observe(key string, start time.Time, limited bool, err error) {
+	group := c.keyGroup(key)
+	c.collector.ObserveLatency(c.name, group, c.timeFunc().Sub(start))
+	c.collector.IncDecision(c.name, group, decisionOf(limited, err))
+}
+
+func decisionOf(limited bool, err error) Decision {
+	switch {
+	case err != nil:
+		return Errored
+	case limited:
+		return Limited
+	default:
+		return Allowed
+	}
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (f optionFunc) apply(c *config) {
+	f(c)
+}
+
+// WithKeyGroup 将限流对象映射到分组作为指标的标签.
+// 为避免标签基数过大, 不要直接使用限流对象. 默认所有限流对象属于同一个分组 ""
+func WithKeyGroup(fn func(key string) string) Option {
+	return optionFunc(func(c *config) {
+		c.keyGroup = fn
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(c *config) {
+		c.timeFunc = fn
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
+
+// MetricLimiter 记录指标的限流器.
+// 没有实现 limiter.Admin, 通过被包装的限流器管理状态, 这些操作不会记录指标
+type MetricLimiter struct {
+	l limiter.Limiter
+	config
+}
+
+// NewMetricLimiter 包装 l, 记录限流判断的次数与耗时
+func NewMetricLimiter(l limiter.Limiter, name string, collector Collector, opts ...Option) *MetricLimiter {
+	return &MetricLimiter{
+		l:      l,
+		config: newConfig(name, collector, opts),
+	}
+}
+
+func (m *MetricLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	start := m.timeFunc()
+	limited, err := m.l.Limit(ctx, key)
+	m.observe(key, start, limited, err)
+	return limited, err
+}
+
+// MetricActiveLimiter 记录指标的活跃请求数限流器.
+// 没有实现 limiter.Admin. 通过被包装的限流器 Reset 或 Adjust 之后, 活跃请求数的指标不会随之变化
+type MetricActiveLimiter struct {
+	l limiter.ActiveLimiter
+	config
+}
+
+// NewMetricActiveLimiter 包装 l, 记录限流判断的次数、耗时与活跃请求数.
+// 活跃请求数只统计成功经过 l 的请求, 包括被限流的请求
+func NewMetricActiveLimiter(l limiter.ActiveLimiter, name string, collector Collector,
+	opts ...Option) *MetricActiveLimiter {
+	return &MetricActiveLimiter{
+		l:      l,
+		config: newConfig(name, collector, opts),
+	}
+}
+
+func (m *MetricActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	start := m.timeFunc()
+	limited, err := m.l.Limit(ctx, key)
+	m.observe(key, start, limited, err)
+	if err == nil {
+		m.collector.AddActive(m.name, m.keyGroup(key), 1)
+	}
+	return limited, err
+}
+
+func (m *MetricActiveLimiter) Decr(ctx context.Context, key string) error {
+	start := m.timeFunc()
+	err := m.l.Decr(ctx, key)
+	group := m.keyGroup(key)
+	m.collector.ObserveLatency(m.name, group, m.timeFunc().Sub(start))
+	if err != nil {
+		m.collector.IncReleaseError(m.name, group)
+		return err
+	}
+	m.collector.AddActive(m.name, group, -1)
+	return nil
+}
+
+// MetricBucketLimiter 记录指标的桶限流器.
+// 没有实现 limiter.Admin, 通过被包装的限流器管理状态
+type MetricBucketLimiter struct {
+	l limiter.BucketLimiter
+	config
+}
+
+// NewMetricBucketLimiter 包装 l, 记录限流判断的次数与 BlockLimit 的等待时间
+func NewMetricBucketLimiter(l limiter.BucketLimiter, name string, collector Collector,
+	opts ...Option) *MetricBucketLimiter {
+	return &MetricBucketLimiter{
+		l:      l,
+		config: newConfig(name, collector, opts),
+	}
+}
+
+func (m *MetricBucketLimiter) Put() {
+	m.l.Put()
+}
+
+func (m *MetricBucketLimiter) Close() {
+	m.l.Close()
+}
+
+func (m *MetricBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	start := m.timeFunc()
+	limited, err := m.l.Limit(ctx, key)
+	group := m.keyGroup(key)
+	m.collector.ObserveLatency(m.name, group, m.timeFunc().Sub(start))
+	m.collector.IncDecision(m.name, group, bucketDecisionOf(limited, err))
+	return limited, err
+}
+
+func (m *MetricBucketLimiter) BlockLimit(ctx context.Context, key string) (bool, error) {
+	start := m.timeFunc()
+	limited, err := m.l.BlockLimit(ctx, key)
+	group := m.keyGroup(key)
+	m.collector.ObserveWait(m.name, group, m.timeFunc().Sub(start))
+	m.collector.IncDecision(m.name, group, bucketDecisionOf(limited, err))
+	return limited, err
+}
+
+// bucketDecisionOf 桶限流器在 Context 出错时会同时返回 true 与 error, 视为限流
+func bucketDecisionOf(limited bool, err error) Decision {
+	if limited {
+		return Limited
+	}
+	return decisionOf(limited, err)
+}
@@ -0,0 +1,127 @@
+package metriclimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+// fakeCollector 在内存中记录指标
+type fakeCollector struct {
+	decisions map[Decision]int
+	active    float64
+	// releaseErrors Decr 出错的次数
+	releaseErrors int
+	wait          []time.Duration
+	latency       []time.Duration
+	groups        []string
+}
+
+func newFakeCollector() *fakeCollector {
+	return &fakeCollector{decisions: make(map[Decision]int)}
+}
+
+func (f *fakeCollector) IncDecision(name, group string, decision Decision) {
+	f.decisions[decision]++
+	f.groups = append(f.groups, name+"/"+group)
+}
+
+func (f *fakeCollector) AddActive(name, group string, delta float64) {
+	f.active += delta
+}
+
+func (f *fakeCollector) IncReleaseError(name, group string) {
+	f.releaseErrors++
+}
+
+func (f *fakeCollector) ObserveWait(name, group string, d time.Duration) {
+	f.wait = append(f.wait, d)
+}
+
+func (f *fakeCollector) ObserveLatency(name, group string, d time.Duration) {
+	f.latency = append(f.latency, d)
+}
+
+// stepClock 每次调用前进 step
+func stepClock(step time.Duration) func() time.Time {
+	now := time.UnixMilli(1695571200000)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestMetricLimiter_Limit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "user:1").Return(false, nil)
+	l.EXPECT().Limit(gomock.Any(), "user:2").Return(true, nil)
+	l.EXPECT().Limit(gomock.Any(), "ip:1").Return(false, errors.New("mock error"))
+	c := newFakeCollector()
+	m := NewMetricLimiter(l, "api", c,
+		WithTimeFunc(stepClock(time.Millisecond)),
+		WithKeyGroup(func(key string) string {
+			return key[:2]
+		}),
+	)
+	for _, key := range []string{"user:1", "user:2", "ip:1"} {
+		_, _ = m.Limit(context.Background(), key)
+	}
+	assert.Equal(t, map[Decision]int{Allowed: 1, Limited: 1, Errored: 1}, c.decisions)
+	assert.Equal(t, []string{"api/us", "api/us", "api/ip"}, c.groups)
+	assert.Equal(t, []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}, c.latency)
+}
+
+func TestMetricActiveLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockActiveLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errors.New("mock error"))
+	l.EXPECT().Decr(gomock.Any(), "foo").Return(nil)
+	l.EXPECT().Decr(gomock.Any(), "foo").Return(limiter.ErrOverRelease)
+	c := newFakeCollector()
+	m := NewMetricActiveLimiter(l, "active", c)
+	for i := 0; i < 3; i++ {
+		_, _ = m.Limit(context.Background(), "foo")
+	}
+	assert.Equal(t, float64(2), c.active)
+	assert.NoError(t, m.Decr(context.Background(), "foo"))
+	assert.Equal(t, float64(1), c.active)
+	// Decr 出错不计入限流判断, 活跃请求数不变
+	assert.ErrorIs(t, m.Decr(context.Background(), "foo"), limiter.ErrOverRelease)
+	assert.Equal(t, float64(1), c.active)
+	assert.Equal(t, 1, c.releaseErrors)
+	assert.Equal(t, map[Decision]int{Allowed: 1, Limited: 1, Errored: 1}, c.decisions)
+}
+
+func TestMetricBucketLimiter_BlockLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockBucketLimiter(ctrl)
+	l.EXPECT().BlockLimit(gomock.Any(), "").Return(false, nil)
+	l.EXPECT().BlockLimit(gomock.Any(), "").Return(true, context.DeadlineExceeded)
+	l.EXPECT().BlockLimit(gomock.Any(), "").Return(false, errors.New("限流器被关闭了"))
+	c := newFakeCollector()
+	m := NewMetricBucketLimiter(l, "bucket", c, WithTimeFunc(stepClock(time.Second)))
+
+	got, err := m.BlockLimit(context.Background(), "")
+	assert.NoError(t, err)
+	assert.False(t, got)
+	got, err = m.BlockLimit(context.Background(), "")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, got)
+	_, _ = m.BlockLimit(context.Background(), "")
+
+	assert.Equal(t, map[Decision]int{Allowed: 1, Limited: 1, Errored: 1}, c.decisions)
+	assert.Equal(t, []time.Duration{time.Second, time.Second, time.Second}, c.wait)
+}
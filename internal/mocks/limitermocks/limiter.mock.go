@@ -0,0 +1,260 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./limiter.go
+//
+// Generated by this command:
+//
+//	mockgen -source=./limiter.go -package=limitermocks -destination=./internal/mocks/limitermocks/limiter.mock.go
+//
+
+// Package limitermocks is a generated GoMock package.
+package limitermocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLimiter is a mock of Limiter interface.
+type MockLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLimiterMockRecorder
+}
+
+// MockLimiterMockRecorder is the mock recorder for MockLimiter.
+type MockLimiterMockRecorder struct {
+	mock *MockLimiter
+}
+
+// NewMockLimiter creates a new mock instance.
+func NewMockLimiter(ctrl *gomock.Controller) *MockLimiter {
+	mock := &MockLimiter{ctrl: ctrl}
+	mock.recorder = &MockLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLimiter) EXPECT() *MockLimiterMockRecorder {
+	return m.recorder
+}
+
+// Limit mocks base method.
+func (m *MockLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockLimiter)(nil).Limit), ctx, key)
+}
+
+// MockReverter is a mock of Reverter interface.
+type MockReverter struct {
+	ctrl     *gomock.Controller
+	recorder *MockReverterMockRecorder
+}
+
+// MockReverterMockRecorder is the mock recorder for MockReverter.
+type MockReverterMockRecorder struct {
+	mock *MockReverter
+}
+
+// NewMockReverter creates a new mock instance.
+func NewMockReverter(ctrl *gomock.Controller) *MockReverter {
+	mock := &MockReverter{ctrl: ctrl}
+	mock.recorder = &MockReverterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReverter) EXPECT() *MockReverterMockRecorder {
+	return m.recorder
+}
+
+// Revert mocks base method.
+func (m *MockReverter) Revert(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revert", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revert indicates an expected call of Revert.
+func (mr *MockReverterMockRecorder) Revert(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revert", reflect.TypeOf((*MockReverter)(nil).Revert), ctx, key)
+}
+
+// MockReserver is a mock of Reserver interface.
+type MockReserver struct {
+	ctrl     *gomock.Controller
+	recorder *MockReserverMockRecorder
+}
+
+// MockReserverMockRecorder is the mock recorder for MockReserver.
+type MockReserverMockRecorder struct {
+	mock *MockReserver
+}
+
+// NewMockReserver creates a new mock instance.
+func NewMockReserver(ctrl *gomock.Controller) *MockReserver {
+	mock := &MockReserver{ctrl: ctrl}
+	mock.recorder = &MockReserverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReserver) EXPECT() *MockReserverMockRecorder {
+	return m.recorder
+}
+
+// Reserve mocks base method.
+func (m *MockReserver) Reserve(ctx context.Context, key string) (bool, func(context.Context) error, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(func(context.Context) error)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Reserve indicates an expected call of Reserve.
+func (mr *MockReserverMockRecorder) Reserve(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockReserver)(nil).Reserve), ctx, key)
+}
+
+// MockActiveLimiter is a mock of ActiveLimiter interface.
+type MockActiveLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockActiveLimiterMockRecorder
+}
+
+// MockActiveLimiterMockRecorder is the mock recorder for MockActiveLimiter.
+type MockActiveLimiterMockRecorder struct {
+	mock *MockActiveLimiter
+}
+
+// NewMockActiveLimiter creates a new mock instance.
+func NewMockActiveLimiter(ctrl *gomock.Controller) *MockActiveLimiter {
+	mock := &MockActiveLimiter{ctrl: ctrl}
+	mock.recorder = &MockActiveLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockActiveLimiter) EXPECT() *MockActiveLimiterMockRecorder {
+	return m.recorder
+}
+
+// Decr mocks base method.
+func (m *MockActiveLimiter) Decr(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decr", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Decr indicates an expected call of Decr.
+func (mr *MockActiveLimiterMockRecorder) Decr(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decr", reflect.TypeOf((*MockActiveLimiter)(nil).Decr), ctx, key)
+}
+
+// Limit mocks base method.
+func (m *MockActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockActiveLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockActiveLimiter)(nil).Limit), ctx, key)
+}
+
+// MockBucketLimiter is a mock of BucketLimiter interface.
+type MockBucketLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockBucketLimiterMockRecorder
+}
+
+// MockBucketLimiterMockRecorder is the mock recorder for MockBucketLimiter.
+type MockBucketLimiterMockRecorder struct {
+	mock *MockBucketLimiter
+}
+
+// NewMockBucketLimiter creates a new mock instance.
+func NewMockBucketLimiter(ctrl *gomock.Controller) *MockBucketLimiter {
+	mock := &MockBucketLimiter{ctrl: ctrl}
+	mock.recorder = &MockBucketLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBucketLimiter) EXPECT() *MockBucketLimiterMockRecorder {
+	return m.recorder
+}
+
+// BlockLimit mocks base method.
+func (m *MockBucketLimiter) BlockLimit(ctx context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BlockLimit", ctx, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BlockLimit indicates an expected call of BlockLimit.
+func (mr *MockBucketLimiterMockRecorder) BlockLimit(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlockLimit", reflect.TypeOf((*MockBucketLimiter)(nil).BlockLimit), ctx, arg1)
+}
+
+// Close mocks base method.
+func (m *MockBucketLimiter) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockBucketLimiterMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockBucketLimiter)(nil).Close))
+}
+
+// Limit mocks base method.
+func (m *MockBucketLimiter) Limit(ctx context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockBucketLimiterMockRecorder) Limit(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockBucketLimiter)(nil).Limit), ctx, arg1)
+}
+
+// Put mocks base method.
+func (m *MockBucketLimiter) Put() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Put")
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockBucketLimiterMockRecorder) Put() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockBucketLimiter)(nil).Put))
+}
@@ -96,3 +96,129 @@ func (mr *MockBoundedQueueMockRecorder) Peek() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Peek", reflect.TypeOf((*MockBoundedQueue)(nil).Peek))
 }
+
+// MockSizer is a mock of Sizer interface.
+type MockSizer struct {
+	ctrl     *gomock.Controller
+	recorder *MockSizerMockRecorder
+}
+
+// MockSizerMockRecorder is the mock recorder for MockSizer.
+type MockSizerMockRecorder struct {
+	mock *MockSizer
+}
+
+// NewMockSizer creates a new mock instance.
+func NewMockSizer(ctrl *gomock.Controller) *MockSizer {
+	mock := &MockSizer{ctrl: ctrl}
+	mock.recorder = &MockSizerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSizer) EXPECT() *MockSizerMockRecorder {
+	return m.recorder
+}
+
+// Cap mocks base method.
+func (m *MockSizer) Cap() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cap")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Cap indicates an expected call of Cap.
+func (mr *MockSizerMockRecorder) Cap() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cap", reflect.TypeOf((*MockSizer)(nil).Cap))
+}
+
+// Len mocks base method.
+func (m *MockSizer) Len() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Len")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Len indicates an expected call of Len.
+func (mr *MockSizerMockRecorder) Len() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockSizer)(nil).Len))
+}
+
+// MockTailRemover is a mock of TailRemover interface.
+type MockTailRemover struct {
+	ctrl     *gomock.Controller
+	recorder *MockTailRemoverMockRecorder
+}
+
+// MockTailRemoverMockRecorder is the mock recorder for MockTailRemover.
+type MockTailRemoverMockRecorder struct {
+	mock *MockTailRemover
+}
+
+// NewMockTailRemover creates a new mock instance.
+func NewMockTailRemover(ctrl *gomock.Controller) *MockTailRemover {
+	mock := &MockTailRemover{ctrl: ctrl}
+	mock.recorder = &MockTailRemoverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTailRemover) EXPECT() *MockTailRemoverMockRecorder {
+	return m.recorder
+}
+
+// RemoveTail mocks base method.
+func (m *MockTailRemover) RemoveTail() (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveTail")
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveTail indicates an expected call of RemoveTail.
+func (mr *MockTailRemoverMockRecorder) RemoveTail() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTail", reflect.TypeOf((*MockTailRemover)(nil).RemoveTail))
+}
+
+// MockRemover is a mock of Remover interface.
+type MockRemover struct {
+	ctrl     *gomock.Controller
+	recorder *MockRemoverMockRecorder
+}
+
+// MockRemoverMockRecorder is the mock recorder for MockRemover.
+type MockRemoverMockRecorder struct {
+	mock *MockRemover
+}
+
+// NewMockRemover creates a new mock instance.
+func NewMockRemover(ctrl *gomock.Controller) *MockRemover {
+	mock := &MockRemover{ctrl: ctrl}
+	mock.recorder = &MockRemoverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRemover) EXPECT() *MockRemoverMockRecorder {
+	return m.recorder
+}
+
+// Remove mocks base method.
+func (m *MockRemover) Remove(val time.Time) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", val)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockRemoverMockRecorder) Remove(val any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockRemover)(nil).Remove), val)
+}
@@ -0,0 +1,167 @@
+package observer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/udugong/limiter"
+)
+
+// Notify 根据限流判断的结果通知 o, o 为 nil 时什么也不做
+func Notify(ctx context.Context, o limiter.Observer, key string, limited bool, err error) {
+	switch {
+	case o == nil:
+		return
+	case err != nil:
+		o.OnError(ctx, key, err)
+	case limited:
+		o.OnLimit(ctx, key)
+	default:
+		o.OnAllow(ctx, key)
+	}
+}
+
+// NotifyRelease 通知 o 活跃请求数减少, o 为 nil 时什么也不做
+func NotifyRelease(ctx context.Context, o limiter.Observer, key string, err error) {
+	switch {
+	case o == nil:
+		return
+	case err != nil:
+		o.OnError(ctx, key, err)
+	default:
+		o.OnRelease(ctx, key)
+	}
+}
+
+// NotifyWait 通知 o BlockLimit 的等待时间, o 为 nil 时什么也不做
+func NotifyWait(ctx context.Context, o limiter.Observer, key string, d time.Duration) {
+	if o != nil {
+		o.OnWait(ctx, key, d)
+	}
+}
+
+type eventKind int
+
+const (
+	eventAllow eventKind = iota
+	eventLimit
+	eventError
+	eventRelease
+	eventWait
+)
+
+type event struct {
+	kind eventKind
+	ctx  context.Context
+	key  string
+	err  error
+	wait time.Duration
+}
+
+// AsyncObserver 异步的 Observer.
+// 事件放入有界队列后由单独的 goroutine 交给被包装的 Observer 处理, 队列已满时丢弃事件, 不会阻塞限流器.
+// 注意: 处理事件时 ctx 可能已经结束
+type AsyncObserver struct {
+	o       limiter.Observer
+	events  chan event
+	closeCh chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// NewAsyncObserver 创建队列长度为 size 的异步 Observer, 需要调用 Close 停止
+func NewAsyncObserver(o limiter.Observer, size int) *AsyncObserver {
+	a := &AsyncObserver{
+		o:       o,
+		events:  make(chan event, size),
+		closeCh: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncObserver) run() {
+	defer close(a.done)
+	for {
+		select {
+		case e := <-a.events:
+			a.handle(e)
+		case <-a.closeCh:
+			// 处理完队列中剩余的事件
+			for {
+				select {
+				case e := <-a.events:
+					a.handle(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AsyncObserver) handle(e event) {
+	switch e.kind {
+	case eventAllow:
+		a.o.OnAllow(e.ctx, e.key)
+	case eventLimit:
+		a.o.OnLimit(e.ctx, e.key)
+	case eventError:
+		a.o.OnError(e.ctx, e.key, e.err)
+	case eventRelease:
+		a.o.OnRelease(e.ctx, e.key)
+	case eventWait:
+		a.o.OnWait(e.ctx, e.key, e.wait)
+	}
+}
+
+func (a *AsyncObserver) dispatch(e event) {
+	select {
+	case <-a.closeCh:
+		a.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case a.events <- e:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+func (a *AsyncObserver) OnAllow(ctx context.Context, key string) {
+	a.dispatch(event{kind: eventAllow, ctx: ctx, key: key})
+}
+
+func (a *AsyncObserver) OnLimit(ctx context.Context, key string) {
+	a.dispatch(event{kind: eventLimit, ctx: ctx, key: key})
+}
+
+func (a *AsyncObserver) OnError(ctx context.Context, key string, err error) {
+	a.dispatch(event{kind: eventError, ctx: ctx, key: key, err: err})
+}
+
+func (a *AsyncObserver) OnRelease(ctx context.Context, key string) {
+	a.dispatch(event{kind: eventRelease, ctx: ctx, key: key})
+}
+
+func (a *AsyncObserver) OnWait(ctx context.Context, key string, d time.Duration) {
+	a.dispatch(event{kind: eventWait, ctx: ctx, key: key, wait: d})
+}
+
+// Dropped 因队列已满或已关闭而丢弃的事件数
+func (a *AsyncObserver) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Close 停止接收事件, 并等待队列中剩余的事件处理完毕
+func (a *AsyncObserver) Close() {
+	a.once.Do(func() {
+		close(a.closeCh)
+	})
+	<-a.done
+}
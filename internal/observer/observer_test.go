@@ -0,0 +1,148 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/udugong/limiter"
+)
+
+// recordObserver 按顺序记录收到的事件
+type recordObserver struct {
+	limiter.NopObserver
+	lock   sync.Mutex
+	events []string
+	// block 不为 nil 时, 处理事件前等待 block 关闭
+	block chan struct{}
+}
+
+func (r *recordObserver) record(event string) {
+	if r.block != nil {
+		<-r.block
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordObserver) OnAllow(_ context.Context, key string) {
+	r.record("allow:" + key)
+}
+
+func (r *recordObserver) OnLimit(_ context.Context, key string) {
+	r.record("limit:" + key)
+}
+
+func (r *recordObserver) OnError(_ context.Context, key string, err error) {
+	r.record("error:" + key + ":" + err.Error())
+}
+
+func (r *recordObserver) OnRelease(_ context.Context, key string) {
+	r.record("release:" + key)
+}
+
+func (r *recordObserver) OnWait(_ context.Context, key string, d time.Duration) {
+	r.record("wait:" + key + ":" + d.String())
+}
+
+func (r *recordObserver) Events() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	o := &recordObserver{}
+	Notify(ctx, o, "a", false, nil)
+	Notify(ctx, o, "b", true, nil)
+	Notify(ctx, o, "c", true, errors.New("mock error"))
+	NotifyRelease(ctx, o, "d", nil)
+	NotifyRelease(ctx, o, "e", errors.New("mock error"))
+	NotifyWait(ctx, o, "f", time.Second)
+	assert.Equal(t, []string{
+		"allow:a",
+		"limit:b",
+		"error:c:mock error",
+		"release:d",
+		"error:e:mock error",
+		"wait:f:1s",
+	}, o.Events())
+
+	// o 为 nil 时不会 panic
+	Notify(ctx, nil, "a", false, nil)
+	NotifyRelease(ctx, nil, "a", nil)
+	NotifyWait(ctx, nil, "a", time.Second)
+}
+
+func TestAsyncObserver(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		size        int
+		dispatch    func(a *AsyncObserver)
+		wantEvents  []string
+		wantDropped int64
+	}{
+		{
+			name: "normal",
+			size: 10,
+			dispatch: func(a *AsyncObserver) {
+				a.OnAllow(ctx, "a")
+				a.OnLimit(ctx, "a")
+				a.OnError(ctx, "a", errors.New("mock error"))
+				a.OnRelease(ctx, "a")
+				a.OnWait(ctx, "a", time.Millisecond)
+			},
+			wantEvents: []string{
+				"allow:a",
+				"limit:a",
+				"error:a:mock error",
+				"release:a",
+				"wait:a:1ms",
+			},
+		},
+		{
+			// 第一个事件被取出后阻塞在处理中, 队列只能再容纳 1 个事件
+			name: "drop_when_full",
+			size: 1,
+			dispatch: func(a *AsyncObserver) {
+				a.OnAllow(ctx, "a")
+				assert.Eventually(t, func() bool {
+					return len(a.events) == 0
+				}, time.Second, time.Millisecond)
+				a.OnAllow(ctx, "b")
+				a.OnAllow(ctx, "c")
+				a.OnAllow(ctx, "d")
+			},
+			wantEvents:  []string{"allow:a", "allow:b"},
+			wantDropped: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &recordObserver{block: make(chan struct{})}
+			a := NewAsyncObserver(o, tt.size)
+			tt.dispatch(a)
+			close(o.block)
+			// Close 会处理完队列中剩余的事件
+			a.Close()
+			assert.Equal(t, tt.wantEvents, o.Events())
+			assert.Equal(t, tt.wantDropped, a.Dropped())
+		})
+	}
+	t.Run("after_close", func(t *testing.T) {
+		o := &recordObserver{}
+		a := NewAsyncObserver(o, 10)
+		a.Close()
+		a.Close()
+		a.OnAllow(ctx, "a")
+		assert.Empty(t, o.Events())
+		assert.Equal(t, int64(1), a.Dropped())
+	})
+}
@@ -0,0 +1,281 @@
+package otellimit
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/metriclimit"
+)
+
+const instrumentationName = "github.com/udugong/limiter"
+
+// 属性名称
+const (
+	AttrAlgorithm = attribute.Key("limiter.algorithm")
+	AttrKeyHash   = attribute.Key("limiter.key_hash")
+	AttrDecision  = attribute.Key("limiter.decision")
+	AttrRemaining = attribute.Key("limiter.remaining")
+)
+
+type config struct {
+	algorithm      string
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	// spanEvent 为 true 时在当前 span 上记录事件而不是创建子 span
+	spanEvent bool
+	// remaining 为 true 时在 span 上记录剩余的额度
+	remaining bool
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (f optionFunc) apply(c *config) {
+	f(c)
+}
+
+// WithTracerProvider 默认使用 otel.GetTracerProvider()
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return optionFunc(func(c *config) {
+		c.tracerProvider = tp
+	})
+}
+
+// WithMeterProvider 默认使用 otel.GetMeterProvider()
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return optionFunc(func(c *config) {
+		c.meterProvider = mp
+	})
+}
+
+// WithSpanEvent 在当前 span 上记录事件而不是创建子 span
+func WithSpanEvent() Option {
+	return optionFunc(func(c *config) {
+		c.spanEvent = true
+	})
+}
+
+// WithRemaining 在 span 上记录限流对象剩余的额度.
+// 只对实现了 limiter.Admin 的限流器生效, 每次判断之后调用一次 Inspect, 基于 redis 的限流器会多一次往返
+func WithRemaining() Option {
+	return optionFunc(func(c *config) {
+		c.remaining = true
+	})
+}
+
+// instrument 记录 span 与指标. OtelLimiter、OtelActiveLimiter 与 OtelBucketLimiter 共用
+type instrument struct {
+	config
+	tracer    trace.Tracer
+	decisions metric.Int64Counter
+	// admin 被包装的限流器, 用于查询剩余的额度. 没有启用 WithRemaining 或者没有实现 limiter.Admin 时为 nil
+	admin limiter.Admin
+}
+
+// newInstrument l 为被包装的限流器
+func newInstrument(l any, algorithm string, opts []Option) (*instrument, error) {
+	c := config{
+		algorithm:      algorithm,
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, opt := range opts {
+		opt.apply(&c)
+	}
+	decisions, err := c.meterProvider.Meter(instrumentationName).Int64Counter("limiter.decisions",
+		metric.WithDescription("限流判断的次数"))
+	if err != nil {
+		return nil, err
+	}
+	i := &instrument{
+		config:    c,
+		tracer:    c.tracerProvider.Tracer(instrumentationName),
+		decisions: decisions,
+	}
+	if c.remaining {
+		i.admin, _ = l.(limiter.Admin)
+	}
+	return i, nil
+}
+
+// remaining 查询 key 剩余的额度, 判断出错或者无法查询时返回 nil
+func (i *instrument) remaining(ctx context.Context, key string, err error) []attribute.KeyValue {
+	if i.admin == nil || err != nil {
+		return nil
+	}
+	state, err := i.admin.Inspect(ctx, key)
+	if err != nil {
+		return nil
+	}
+	return []attribute.KeyValue{AttrRemaining.Int64(state.Remaining)}
+}
+
+// start 开始一次调用, 返回的函数用于结束调用, extra 为额外记录在 span 上的属性
+func (i *instrument) start(ctx context.Context, op, key string) (context.Context,
+	func(decision metriclimit.Decision, err error, extra ...attribute.KeyValue)) {
+	attrs := []attribute.KeyValue{
+		AttrAlgorithm.String(i.algorithm),
+		AttrKeyHash.String(hashKey(key)),
+	}
+	var span trace.Span
+	if i.spanEvent {
+		span = trace.SpanFromContext(ctx)
+	} else {
+		ctx, span = i.tracer.Start(ctx, "limiter."+op, trace.WithAttributes(attrs...))
+	}
+	return ctx, func(decision metriclimit.Decision, err error, extra ...attribute.KeyValue) {
+		if decision != "" {
+			i.decisions.Add(ctx, 1, metric.WithAttributes(
+				AttrAlgorithm.String(i.algorithm), AttrDecision.String(string(decision))))
+		}
+		if i.spanEvent {
+			eventAttrs := append(attrs, extra...)
+			if decision != "" {
+				eventAttrs = append(eventAttrs, AttrDecision.String(string(decision)))
+			}
+			span.AddEvent("limiter."+op, trace.WithAttributes(eventAttrs...))
+			if err != nil {
+				span.RecordError(err)
+			}
+			return
+		}
+		if decision != "" {
+			span.SetAttributes(AttrDecision.String(string(decision)))
+		}
+		span.SetAttributes(extra...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// hashKey 限流对象可能包含用户信息, 只记录其哈希值
+func hashKey(key string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func decisionOf(limited bool, err error) metriclimit.Decision {
+	switch {
+	case err != nil:
+		return metriclimit.Errored
+	case limited:
+		return metriclimit.Limited
+	default:
+		return metriclimit.Allowed
+	}
+}
+
+// bucketDecisionOf 桶限流器在 Context 出错时会同时返回 true 与 error, 视为限流
+func bucketDecisionOf(limited bool, err error) metriclimit.Decision {
+	if limited {
+		return metriclimit.Limited
+	}
+	return decisionOf(limited, err)
+}
+
+// OtelLimiter 记录 OpenTelemetry span 与指标的限流器.
+// 没有实现 limiter.Admin, WithRemaining 只使用被包装的限流器的 Inspect, 管理时直接使用被包装的限流器
+type OtelLimiter struct {
+	l limiter.Limiter
+	*instrument
+}
+
+// NewOtelLimiter 包装 l. algorithm 为限流算法的名称
+func NewOtelLimiter(l limiter.Limiter, algorithm string, opts ...Option) (*OtelLimiter, error) {
+	i, err := newInstrument(l, algorithm, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &OtelLimiter{l: l, instrument: i}, nil
+}
+
+func (o *OtelLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	ctx, end := o.start(ctx, "Limit", key)
+	limited, err := o.l.Limit(ctx, key)
+	end(decisionOf(limited, err), err, o.remaining(ctx, key, err)...)
+	return limited, err
+}
+
+// OtelActiveLimiter 记录 OpenTelemetry span 与指标的活跃请求数限流器.
+// 没有实现 limiter.Admin, 管理时直接使用被包装的限流器
+type OtelActiveLimiter struct {
+	l limiter.ActiveLimiter
+	*instrument
+}
+
+// NewOtelActiveLimiter 包装 l. algorithm 为限流算法的名称
+func NewOtelActiveLimiter(l limiter.ActiveLimiter, algorithm string, opts ...Option) (*OtelActiveLimiter, error) {
+	i, err := newInstrument(l, algorithm, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &OtelActiveLimiter{l: l, instrument: i}, nil
+}
+
+func (o *OtelActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	ctx, end := o.start(ctx, "Limit", key)
+	limited, err := o.l.Limit(ctx, key)
+	end(decisionOf(limited, err), err, o.remaining(ctx, key, err)...)
+	return limited, err
+}
+
+// Decr 只记录 span, 不计入限流判断的次数
+func (o *OtelActiveLimiter) Decr(ctx context.Context, key string) error {
+	ctx, end := o.start(ctx, "Decr", key)
+	err := o.l.Decr(ctx, key)
+	end("", err)
+	return err
+}
+
+// OtelBucketLimiter 记录 OpenTelemetry span 与指标的桶限流器.
+// 没有实现 limiter.Admin, 管理时直接使用被包装的限流器
+type OtelBucketLimiter struct {
+	l limiter.BucketLimiter
+	*instrument
+}
+
+// NewOtelBucketLimiter 包装 l. algorithm 为限流算法的名称
+func NewOtelBucketLimiter(l limiter.BucketLimiter, algorithm string, opts ...Option) (*OtelBucketLimiter, error) {
+	i, err := newInstrument(l, algorithm, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &OtelBucketLimiter{l: l, instrument: i}, nil
+}
+
+func (o *OtelBucketLimiter) Put() {
+	o.l.Put()
+}
+
+func (o *OtelBucketLimiter) Close() {
+	o.l.Close()
+}
+
+func (o *OtelBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	ctx, end := o.start(ctx, "Limit", key)
+	limited, err := o.l.Limit(ctx, key)
+	end(bucketDecisionOf(limited, err), err, o.remaining(ctx, key, err)...)
+	return limited, err
+}
+
+func (o *OtelBucketLimiter) BlockLimit(ctx context.Context, key string) (bool, error) {
+	ctx, end := o.start(ctx, "BlockLimit", key)
+	limited, err := o.l.BlockLimit(ctx, key)
+	end(bucketDecisionOf(limited, err), err, o.remaining(ctx, key, err)...)
+	return limited, err
+}
@@ -0,0 +1,152 @@
+package otellimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter/internal/activelimit"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+func TestOtelLimiter_Limit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "user:1").Return(false, nil)
+	l.EXPECT().Limit(gomock.Any(), "user:1").Return(true, nil)
+	l.EXPECT().Limit(gomock.Any(), "user:1").Return(false, errors.New("mock error"))
+	o, err := NewOtelLimiter(l, "redis_sliding_window",
+		WithTracerProvider(tp), WithMeterProvider(mp))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, _ = o.Limit(context.Background(), "user:1")
+	}
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "limiter.Limit", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), AttrAlgorithm.String("redis_sliding_window"))
+	assert.Contains(t, spans[0].Attributes(), AttrKeyHash.String(hashKey("user:1")))
+	assert.Contains(t, spans[0].Attributes(), AttrDecision.String("allowed"))
+	assert.Contains(t, spans[1].Attributes(), AttrDecision.String("limited"))
+	assert.Contains(t, spans[2].Attributes(), AttrDecision.String("error"))
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+	sum := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64])
+	got := make(map[string]int64)
+	for _, dp := range sum.DataPoints {
+		decision, _ := dp.Attributes.Value(AttrDecision)
+		got[decision.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{"allowed": 1, "limited": 1, "error": 1}, got)
+}
+
+func TestOtelActiveLimiter_SpanEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	mp := sdkmetric.NewMeterProvider()
+
+	l := limitermocks.NewMockActiveLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	l.EXPECT().Decr(gomock.Any(), "foo").Return(nil)
+	o, err := NewOtelActiveLimiter(l, "local_active",
+		WithTracerProvider(tp), WithMeterProvider(mp), WithSpanEvent())
+	require.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	_, _ = o.Limit(ctx, "foo")
+	assert.NoError(t, o.Decr(ctx, "foo"))
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "limiter.Limit", events[0].Name)
+	assert.Contains(t, events[0].Attributes, attribute.String("limiter.decision", "allowed"))
+	assert.Equal(t, "limiter.Decr", events[1].Name)
+}
+
+func TestOtelBucketLimiter_BlockLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	l := limitermocks.NewMockBucketLimiter(ctrl)
+	l.EXPECT().BlockLimit(gomock.Any(), "").Return(true, context.DeadlineExceeded)
+	o, err := NewOtelBucketLimiter(l, "token_bucket",
+		WithTracerProvider(tp), WithMeterProvider(sdkmetric.NewMeterProvider()))
+	require.NoError(t, err)
+	got, err := o.BlockLimit(context.Background(), "")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, got)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "limiter.BlockLimit", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), AttrDecision.String("limited"))
+}
+
+func TestOtelLimiter_Remaining(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	mp := sdkmetric.NewMeterProvider()
+	ctx := context.Background()
+
+	// 实现了 limiter.Admin 的限流器记录剩余的额度
+	o, err := NewOtelActiveLimiter(activelimit.NewLocalActiveLimiter(2), "local_active",
+		WithTracerProvider(tp), WithMeterProvider(mp), WithRemaining())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, _ = o.Limit(ctx, "foo")
+	}
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Contains(t, spans[0].Attributes(), AttrRemaining.Int64(1))
+	assert.Contains(t, spans[1].Attributes(), AttrRemaining.Int64(0))
+	assert.Contains(t, spans[2].Attributes(), AttrRemaining.Int64(0))
+
+	// 没有实现 limiter.Admin 的限流器不记录
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	ol, err := NewOtelLimiter(l, "mock", WithTracerProvider(tp), WithMeterProvider(mp), WithRemaining())
+	require.NoError(t, err)
+	_, _ = ol.Limit(ctx, "foo")
+	// 没有启用 WithRemaining 时不查询
+	oa, err := NewOtelActiveLimiter(activelimit.NewLocalActiveLimiter(2), "local_active",
+		WithTracerProvider(tp), WithMeterProvider(mp))
+	require.NoError(t, err)
+	_, _ = oa.Limit(ctx, "foo")
+	spans = recorder.Ended()
+	require.Len(t, spans, 5)
+	for _, span := range spans[3:] {
+		for _, attr := range span.Attributes() {
+			assert.NotEqual(t, AttrRemaining, attr.Key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package penaltylimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LocalStore 本地保存违规次数与封禁, 只对当前实例生效
+type LocalStore struct {
+	lock    sync.Mutex
+	records map[string]*record
+}
+
+type record struct {
+	// windowStart 当前计数窗口的开始时间, 即窗口内第一次违规的时间
+	windowStart time.Time
+	violations  int64
+	// offences 已经封禁的次数
+	offences int64
+	lastBan  time.Time
+	until    time.Time
+	// expireAt 之后记录不再有用, 可以删除
+	expireAt time.Time
+}
+
+func NewLocalStore() *LocalStore {
+	return &LocalStore{
+		records: make(map[string]*record),
+	}
+}
+
+func (s *LocalStore) BannedUntil(_ context.Context, key string, now time.Time) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.records[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if !now.Before(r.expireAt) {
+		delete(s.records, key)
+		return time.Time{}, nil
+	}
+	if now.Before(r.until) {
+		return r.until, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *LocalStore) Violate(_ context.Context, key string, now time.Time, p Policy) (time.Time, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.records[key]
+	if !ok || !now.Before(r.expireAt) {
+		r = &record{}
+		s.records[key] = r
+	}
+	if now.Before(r.until) {
+		return r.until, false, nil
+	}
+	if r.violations == 0 || now.Sub(r.windowStart) >= p.Window {
+		r.windowStart = now
+		r.violations = 0
+	}
+	r.violations++
+	if r.violations < p.Threshold {
+		r.expire(now.Add(p.Window))
+		return time.Time{}, false, nil
+	}
+
+	if r.offences > 0 && now.Sub(r.lastBan) >= p.ForgetAfter {
+		r.offences = 0
+	}
+	r.offences++
+	r.violations = 0
+	r.lastBan = now
+	r.until = now.Add(p.banDuration(r.offences))
+	r.expire(r.until)
+	r.expire(now.Add(p.ForgetAfter))
+	return r.until, true, nil
+}
+
+// expire 记录至少保留到 t
+func (r *record) expire(t time.Time) {
+	if t.After(r.expireAt) {
+		r.expireAt = t
+	}
+}
+
+func (s *LocalStore) Inspect(_ context.Context, key string, now time.Time, p Policy) (int64, time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.records[key]
+	if !ok || !now.Before(r.expireAt) {
+		return 0, time.Time{}, nil
+	}
+	var until time.Time
+	if now.Before(r.until) {
+		until = r.until
+	}
+	if now.Sub(r.windowStart) >= p.Window {
+		return 0, until, nil
+	}
+	return r.violations, until, nil
+}
+
+func (s *LocalStore) SetViolations(_ context.Context, key string, now time.Time, p Policy, n int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.records[key]
+	if !ok || !now.Before(r.expireAt) {
+		if n == 0 {
+			delete(s.records, key)
+			return nil
+		}
+		r = &record{}
+		s.records[key] = r
+	}
+	if r.violations == 0 || now.Sub(r.windowStart) >= p.Window {
+		r.windowStart = now
+	}
+	r.violations = n
+	r.until = time.Time{}
+	if n > 0 {
+		r.expire(now.Add(p.Window))
+	}
+	return nil
+}
+
+func (s *LocalStore) Unban(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.records, key)
+	return nil
+}
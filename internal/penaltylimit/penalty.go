@@ -0,0 +1,266 @@
+package penaltylimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// PenaltyLimiter 封禁反复被限流的限流对象, 类似 fail2ban.
+// 限流对象被 l 限流时记录一次违规, 在窗口内违规达到阈值时封禁, 封禁的时长随封禁的次数递增.
+// 封禁期间直接限流, 不再调用 l. 允许名单中的限流对象总是放行, 拒绝名单中的限流对象总是限流,
+// 都不会访问 l 与 Store. 实现了 limiter.Admin, 管理的是违规次数与封禁, 不会修改 l 的状态
+type PenaltyLimiter struct {
+	l        limiter.Limiter
+	store    Store
+	policy   Policy
+	allow    map[string]struct{}
+	deny     map[string]struct{}
+	timeFunc func() time.Time
+	onBan    func(ctx context.Context, key string, until time.Time)
+	observer limiter.Observer
+	// err 配置不合法时 Limit 返回的错误
+	err error
+}
+
+// NewPenaltyLimiter 默认 1 分钟内被限流 10 次时封禁 1 分钟,
+// 之后每次封禁的时长加倍, 最长 24 小时, 24 小时没有再被封禁时重新计算.
+// 配置不合法时 Limit 返回 limiter.ErrInvalidConfig
+func NewPenaltyLimiter(l limiter.Limiter, store Store, opts ...Option) *PenaltyLimiter {
+	p := &PenaltyLimiter{
+		l:     l,
+		store: store,
+		policy: Policy{
+			Threshold:      10,
+			Window:         time.Minute,
+			BanDuration:    time.Minute,
+			MaxBanDuration: 24 * time.Hour,
+			Multiplier:     2,
+			ForgetAfter:    24 * time.Hour,
+		},
+		allow:    make(map[string]struct{}),
+		deny:     make(map[string]struct{}),
+		timeFunc: func() time.Time { return time.Now() },
+		onBan:    func(ctx context.Context, key string, until time.Time) {},
+	}
+	for _, opt := range opts {
+		opt.apply(p)
+	}
+	p.err = p.validate()
+	return p
+}
+
+type Option interface {
+	apply(*PenaltyLimiter)
+}
+
+type optionFunc func(*PenaltyLimiter)
+
+func (f optionFunc) apply(p *PenaltyLimiter) {
+	f(p)
+}
+
+// WithThreshold 在 window 内被限流 threshold 次时封禁
+func WithThreshold(threshold int64, window time.Duration) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.policy.Threshold = threshold
+		p.policy.Window = window
+	})
+}
+
+// WithBanDuration 第 1 次封禁的时长为 d, 最长为 maxDuration
+func WithBanDuration(d, maxDuration time.Duration) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.policy.BanDuration = d
+		p.policy.MaxBanDuration = maxDuration
+	})
+}
+
+// WithMultiplier 每次封禁的时长是上一次的 m 倍. 为 1 时不递增
+func WithMultiplier(m float64) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.policy.Multiplier = m
+	})
+}
+
+// WithForgetAfter 距离上一次封禁超过 d 时, 重新从第 1 次封禁开始计算
+func WithForgetAfter(d time.Duration) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.policy.ForgetAfter = d
+	})
+}
+
+// WithAllowList 总是放行的限流对象
+func WithAllowList(keys ...string) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		for _, key := range keys {
+			p.allow[key] = struct{}{}
+		}
+	})
+}
+
+// WithDenyList 总是限流的限流对象
+func WithDenyList(keys ...string) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		for _, key := range keys {
+			p.deny[key] = struct{}{}
+		}
+	})
+}
+
+// WithOnBan 限流对象被封禁时调用
+func WithOnBan(fn func(ctx context.Context, key string, until time.Time)) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.onBan = fn
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.timeFunc = fn
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) Option {
+	return optionFunc(func(p *PenaltyLimiter) {
+		p.observer = o
+	})
+}
+
+func (p *PenaltyLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := p.limit(ctx, key)
+	observer.Notify(ctx, p.observer, key, limited, err)
+	return limited, err
+}
+
+func (p *PenaltyLimiter) limit(ctx context.Context, key string) (bool, error) {
+	if _, ok := p.deny[key]; ok {
+		return true, nil
+	}
+	if _, ok := p.allow[key]; ok {
+		return false, nil
+	}
+	if p.err != nil {
+		return false, p.err
+	}
+	until, err := p.store.BannedUntil(ctx, key, p.timeFunc())
+	if err != nil {
+		return false, err
+	}
+	if !until.IsZero() {
+		return true, nil
+	}
+	limited, err := p.l.Limit(ctx, key)
+	if err != nil || !limited {
+		return limited, err
+	}
+	until, banned, err := p.store.Violate(ctx, key, p.timeFunc(), p.policy)
+	if err != nil {
+		// 依然限流, 同时报告封禁失败
+		return true, err
+	}
+	// 并发的违规可能同时越过 BannedUntil, 只通知导致封禁的那一次
+	if banned {
+		p.onBan(ctx, key, until)
+	}
+	return true, nil
+}
+
+// validate 阈值小于 1 或窗口小于等于 0 时无法计数, 封禁的时长小于等于 0 时不会封禁,
+// 最长的封禁时长小于第 1 次的时长或 multiplier 小于 1 时封禁的时长会递减
+func (p *PenaltyLimiter) validate() error {
+	if p.policy.Threshold < 1 {
+		return errs.InvalidConfig("threshold 必须大于0, 实际为 %d", p.policy.Threshold)
+	}
+	if p.policy.Window <= 0 {
+		return errs.InvalidConfig("window 必须大于0, 实际为 %s", p.policy.Window)
+	}
+	if p.policy.BanDuration <= 0 {
+		return errs.InvalidConfig("ban duration 必须大于0, 实际为 %s", p.policy.BanDuration)
+	}
+	if p.policy.MaxBanDuration < p.policy.BanDuration {
+		return errs.InvalidConfig("max ban duration 不能小于 ban duration %s, 实际为 %s",
+			p.policy.BanDuration, p.policy.MaxBanDuration)
+	}
+	if p.policy.Multiplier < 1 {
+		return errs.InvalidConfig("multiplier 不能小于1, 实际为 %g", p.policy.Multiplier)
+	}
+	return nil
+}
+
+// BannedUntil 返回 key 被封禁到的时间, 没有被封禁时返回零值
+func (p *PenaltyLimiter) BannedUntil(ctx context.Context, key string) (time.Time, error) {
+	return p.store.BannedUntil(ctx, key, p.timeFunc())
+}
+
+// Unban 解除 key 的封禁并清空违规记录, 封禁的次数也重新计算
+func (p *PenaltyLimiter) Unban(ctx context.Context, key string) error {
+	return p.store.Unban(ctx, key)
+}
+
+// Inspect 查询 key 当前窗口内的违规次数, Limit 为封禁的阈值. 被封禁时已使用的额度等于阈值
+func (p *PenaltyLimiter) Inspect(ctx context.Context, key string) (limiter.State, error) {
+	if p.err != nil {
+		return limiter.State{}, p.err
+	}
+	violations, until, err := p.store.Inspect(ctx, key, p.timeFunc(), p.policy)
+	if err != nil {
+		return limiter.State{}, err
+	}
+	if !until.IsZero() {
+		violations = p.policy.Threshold
+	}
+	return limiter.NewState(p.policy.Threshold, violations), nil
+}
+
+// Reset 与 Unban 相同
+func (p *PenaltyLimiter) Reset(ctx context.Context, key string) error {
+	return p.Unban(ctx, key)
+}
+
+// Adjust 调整 key 当前窗口内的违规次数. delta 为正时减少违规次数并解除封禁, 封禁的次数不变;
+// 为负时增加违规次数, 达到阈值时按策略封禁. 封禁期间扣除额度不会延长封禁
+func (p *PenaltyLimiter) Adjust(ctx context.Context, key string, delta int64) error {
+	state, err := p.Inspect(ctx, key)
+	if err != nil {
+		return err
+	}
+	threshold := p.policy.Threshold
+	var used int64
+	switch {
+	case delta >= state.Used:
+		used = 0
+	case delta <= state.Used-threshold:
+		used = threshold
+	default:
+		used = state.Used - delta
+	}
+	if used == state.Used {
+		return nil
+	}
+	now := p.timeFunc()
+	if used < threshold {
+		return p.store.SetViolations(ctx, key, now, p.policy, used)
+	}
+	if err = p.store.SetViolations(ctx, key, now, p.policy, threshold-1); err != nil {
+		return err
+	}
+	until, banned, err := p.store.Violate(ctx, key, now, p.policy)
+	if err != nil {
+		return err
+	}
+	if banned {
+		p.onBan(ctx, key, until)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+-- 违规次数与封禁
+local key = KEYS[1]
+-- 当前时间(毫秒), 小于 0 时使用 redis 服务器的时间
+local now = tonumber(ARGV[1])
+-- 窗口内违规多少次时封禁
+local threshold = tonumber(ARGV[2])
+-- 计数窗口(毫秒)
+local window = tonumber(ARGV[3])
+-- 距离上一次封禁超过多久时重新计算封禁的次数(毫秒)
+local forget = tonumber(ARGV[4])
+-- 第 1 次封禁的时长(毫秒)
+local base = tonumber(ARGV[5])
+-- 最长的封禁时长(毫秒)
+local maxBan = tonumber(ARGV[6])
+-- 每次封禁的时长是上一次的多少倍
+local multiplier = tonumber(ARGV[7])
+
+-- 返回 {封禁到的时间, 这一次违规是否导致封禁}, 没有被封禁时封禁到的时间为 0
+
+if now < 0 then
+    redis.replicate_commands()
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+
+local r = redis.call('HMGET', key, 'ws', 'c', 'o', 'lb', 'u')
+local ws = tonumber(r[1]) or 0
+local c = tonumber(r[2]) or 0
+local o = tonumber(r[3]) or 0
+local lb = tonumber(r[4]) or 0
+local u = tonumber(r[5]) or 0
+if now < u then
+    return {u, 0}
+end
+if c == 0 or now - ws >= window then
+    ws = now
+    c = 0
+end
+c = c + 1
+if c < threshold then
+    -- 保留封禁的次数直到可以被遗忘
+    local expireAt = now + window
+    if o > 0 then
+        expireAt = math.max(expireAt, lb + forget)
+    end
+    redis.call('HSET', key, 'ws', ws, 'c', c)
+    redis.call('PEXPIRE', key, expireAt - now)
+    return {0, 0}
+end
+
+if o > 0 and now - lb >= forget then
+    o = 0
+end
+o = o + 1
+local d = base
+for i = 2, o do
+    if d >= maxBan then
+        break
+    end
+    d = d * multiplier
+end
+if d > maxBan then
+    d = maxBan
+end
+u = now + math.floor(d)
+redis.call('HSET', key, 'ws', now, 'c', 0, 'o', o, 'lb', now, 'u', u)
+redis.call('PEXPIRE', key, math.max(u, now + forget) - now)
+return {u, 1}
@@ -0,0 +1,45 @@
+-- 违规次数与封禁
+local key = KEYS[1]
+-- 当前时间(毫秒), 小于 0 时使用 redis 服务器的时间
+local now = tonumber(ARGV[1])
+-- 当前窗口内的违规次数
+local c = tonumber(ARGV[2])
+-- 计数窗口(毫秒)
+local window = tonumber(ARGV[3])
+-- 距离上一次封禁超过多久时重新计算封禁的次数(毫秒)
+local forget = tonumber(ARGV[4])
+
+-- 解除封禁并设置违规次数, 封禁的次数不变
+
+if now < 0 then
+    redis.replicate_commands()
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+
+local r = redis.call('HMGET', key, 'ws', 'c', 'o', 'lb')
+local ws = tonumber(r[1]) or 0
+local oldC = tonumber(r[2]) or 0
+local o = tonumber(r[3]) or 0
+local lb = tonumber(r[4]) or 0
+if oldC == 0 or now - ws >= window then
+    ws = now
+end
+if o > 0 and now - lb >= forget then
+    o = 0
+end
+if c == 0 and o == 0 then
+    redis.call('DEL', key)
+    return 0
+end
+
+local expireAt = now
+if c > 0 then
+    expireAt = now + window
+end
+if o > 0 then
+    expireAt = math.max(expireAt, lb + forget)
+end
+redis.call('HSET', key, 'ws', ws, 'c', c, 'u', 0)
+redis.call('PEXPIRE', key, expireAt - now)
+return 0
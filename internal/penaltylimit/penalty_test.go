@@ -0,0 +1,331 @@
+package penaltylimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+func TestPenaltyLimiter_Limit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	now := time.UnixMilli(1695571200000)
+	l := limitermocks.NewMockLimiter(ctrl)
+	var bans []time.Time
+	p := NewPenaltyLimiter(l, NewLocalStore(),
+		WithThreshold(2, time.Minute),
+		WithBanDuration(time.Minute, time.Hour),
+		WithTimeFunc(func() time.Time { return now }),
+		WithOnBan(func(ctx context.Context, key string, until time.Time) {
+			bans = append(bans, until)
+		}),
+	)
+
+	tests := []struct {
+		name    string
+		mock    func()
+		elapsed time.Duration
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "allowed",
+			mock: func() {
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+			},
+		},
+		{
+			name: "first_violation",
+			mock: func() {
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+			},
+			want: true,
+		},
+		{
+			name: "banned",
+			mock: func() {
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+			},
+			want: true,
+		},
+		{
+			// 封禁期间不调用 l
+			name:    "during_ban",
+			mock:    func() {},
+			elapsed: 59 * time.Second,
+			want:    true,
+		},
+		{
+			name: "ban_expired",
+			mock: func() {
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+			},
+			elapsed: time.Second,
+		},
+		{
+			name: "limiter_error",
+			mock: func() {
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, limiter.ErrBackendUnavailable)
+			},
+			wantErr: limiter.ErrBackendUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			now = now.Add(tt.elapsed)
+			got, err := p.Limit(ctx, "foo")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	assert.Equal(t, []time.Time{time.UnixMilli(1695571200000).Add(time.Minute)}, bans)
+}
+
+func TestPenaltyLimiter_Lists(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// 名单中的限流对象不会访问限流器与 Store
+	p := NewPenaltyLimiter(limitermocks.NewMockLimiter(ctrl), errStore{},
+		WithAllowList("10.0.0.1", "probe"),
+		WithDenyList("bad"),
+	)
+	for key, want := range map[string]bool{"10.0.0.1": false, "probe": false, "bad": true} {
+		got, err := p.Limit(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, key)
+	}
+}
+
+func TestPenaltyLimiter_StoreError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockLimiter(ctrl)
+	p := NewPenaltyLimiter(l, errStore{})
+	got, err := p.Limit(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.False(t, got)
+}
+
+func TestPenaltyLimiter_Unban(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+	p := NewPenaltyLimiter(l, NewLocalStore(), WithThreshold(1, time.Minute))
+	_, err := p.Limit(ctx, "foo")
+	require.NoError(t, err)
+	until, err := p.BannedUntil(ctx, "foo")
+	require.NoError(t, err)
+	assert.False(t, until.IsZero())
+
+	require.NoError(t, p.Unban(ctx, "foo"))
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	got, err := p.Limit(ctx, "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestPenaltyLimiter_Admin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	now := time.UnixMilli(1695571200000)
+	var bans []time.Time
+	p := NewPenaltyLimiter(limitermocks.NewMockLimiter(ctrl), NewLocalStore(),
+		WithThreshold(3, time.Minute),
+		WithBanDuration(time.Minute, time.Hour),
+		WithTimeFunc(func() time.Time { return now }),
+		WithOnBan(func(ctx context.Context, key string, until time.Time) {
+			bans = append(bans, until)
+		}),
+	)
+	var _ limiter.Admin = p
+
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+		// wantBans 之后一共封禁的次数
+		wantBans int
+	}{
+		{
+			name: "inspect",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return p.Adjust(ctx, "foo", -2) },
+			want: limiter.State{Limit: 3, Used: 2, Remaining: 1},
+		},
+		{
+			name: "grant",
+			op:   func() error { return p.Adjust(ctx, "foo", 1) },
+			want: limiter.State{Limit: 3, Used: 1, Remaining: 2},
+		},
+		{
+			// 达到阈值时按策略封禁
+			name:     "deduct_ban",
+			op:       func() error { return p.Adjust(ctx, "foo", -5) },
+			want:     limiter.State{Limit: 3, Used: 3, Remaining: 0},
+			wantBans: 1,
+		},
+		{
+			// 封禁期间扣除额度不会延长封禁
+			name:     "deduct_banned",
+			op:       func() error { return p.Adjust(ctx, "foo", -1) },
+			want:     limiter.State{Limit: 3, Used: 3, Remaining: 0},
+			wantBans: 1,
+		},
+		{
+			// 解除封禁
+			name:     "grant_banned",
+			op:       func() error { return p.Adjust(ctx, "foo", 1) },
+			want:     limiter.State{Limit: 3, Used: 2, Remaining: 1},
+			wantBans: 1,
+		},
+		{
+			name:     "grant_max",
+			op:       func() error { return p.Adjust(ctx, "foo", math.MaxInt64) },
+			want:     limiter.State{Limit: 3, Used: 0, Remaining: 3},
+			wantBans: 1,
+		},
+		{
+			// 封禁的次数不变, 第 2 次封禁的时长加倍
+			name:     "deduct_min",
+			op:       func() error { return p.Adjust(ctx, "foo", math.MinInt64) },
+			want:     limiter.State{Limit: 3, Used: 3, Remaining: 0},
+			wantBans: 2,
+		},
+		{
+			name:     "reset",
+			op:       func() error { return p.Reset(ctx, "foo") },
+			want:     limiter.State{Limit: 3, Used: 0, Remaining: 3},
+			wantBans: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.op())
+			got, err := p.Inspect(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Len(t, bans, tt.wantBans)
+		})
+	}
+	assert.Equal(t, []time.Time{now.Add(time.Minute), now.Add(2 * time.Minute)}, bans)
+}
+
+func TestPenaltyLimiter_AdminError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p := NewPenaltyLimiter(limitermocks.NewMockLimiter(ctrl), errStore{})
+	_, err := p.Inspect(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.ErrorIs(t, p.Adjust(context.Background(), "foo", 1), limiter.ErrBackendUnavailable)
+	assert.ErrorIs(t, p.Reset(context.Background(), "foo"), limiter.ErrBackendUnavailable)
+
+	p = NewPenaltyLimiter(limitermocks.NewMockLimiter(ctrl), NewLocalStore(), WithThreshold(0, time.Minute))
+	_, err = p.Inspect(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	assert.ErrorIs(t, p.Adjust(context.Background(), "foo", 1), limiter.ErrInvalidConfig)
+}
+
+// raceStore 模拟并发的违规同时越过 BannedUntil
+type raceStore struct {
+	*LocalStore
+}
+
+func (raceStore) BannedUntil(context.Context, string, time.Time) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+// 只通知导致封禁的那一次违规
+func TestPenaltyLimiter_OnBanOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil).Times(2)
+	var bans int
+	p := NewPenaltyLimiter(l, raceStore{NewLocalStore()},
+		WithThreshold(1, time.Minute),
+		WithOnBan(func(context.Context, string, time.Time) { bans++ }),
+	)
+	for i := 0; i < 2; i++ {
+		got, err := p.Limit(context.Background(), "foo")
+		require.NoError(t, err)
+		assert.True(t, got)
+	}
+	assert.Equal(t, 1, bans)
+}
+
+func TestPenaltyLimiter_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{name: "threshold", opt: WithThreshold(0, time.Minute)},
+		{name: "window", opt: WithThreshold(1, 0)},
+		{name: "ban_duration", opt: WithBanDuration(0, time.Hour)},
+		{name: "negative_ban_duration", opt: WithBanDuration(-time.Minute, time.Hour)},
+		{name: "max_ban_duration", opt: WithBanDuration(time.Hour, time.Minute)},
+		{name: "multiplier", opt: WithMultiplier(0.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			p := NewPenaltyLimiter(limitermocks.NewMockLimiter(ctrl), errStore{}, tt.opt)
+			got, err := p.Limit(context.Background(), "foo")
+			assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+			assert.False(t, got)
+		})
+	}
+}
+
+// 最长的封禁时长等于第 1 次的时长时每次封禁的时长相同
+func TestPenaltyLimiter_FixedBanDuration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	p := NewPenaltyLimiter(l, NewLocalStore(), WithBanDuration(time.Minute, time.Minute))
+	got, err := p.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+// errStore 总是返回错误
+type errStore struct{}
+
+func (errStore) BannedUntil(context.Context, string, time.Time) (time.Time, error) {
+	return time.Time{}, errors.Join(limiter.ErrBackendUnavailable, errors.New("mock redis error"))
+}
+
+func (errStore) Violate(context.Context, string, time.Time, Policy) (time.Time, bool, error) {
+	return time.Time{}, false, errors.Join(limiter.ErrBackendUnavailable, errors.New("mock redis error"))
+}
+
+func (errStore) Unban(context.Context, string) error {
+	return errors.Join(limiter.ErrBackendUnavailable, errors.New("mock redis error"))
+}
+
+func (errStore) Inspect(context.Context, string, time.Time, Policy) (int64, time.Time, error) {
+	return 0, time.Time{}, errors.Join(limiter.ErrBackendUnavailable, errors.New("mock redis error"))
+}
+
+func (errStore) SetViolations(context.Context, string, time.Time, Policy, int64) error {
+	return errors.Join(limiter.ErrBackendUnavailable, errors.New("mock redis error"))
+}
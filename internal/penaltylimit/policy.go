@@ -0,0 +1,45 @@
+package penaltylimit
+
+import (
+	"context"
+	"time"
+)
+
+// Policy 封禁的策略. 在 Window 内被限流 Threshold 次时封禁,
+// 第 n 次封禁的时长为 BanDuration * Multiplier^(n-1), 最长为 MaxBanDuration.
+// 距离上一次封禁超过 ForgetAfter 时重新从第 1 次开始计算
+type Policy struct {
+	Threshold      int64
+	Window         time.Duration
+	BanDuration    time.Duration
+	MaxBanDuration time.Duration
+	Multiplier     float64
+	ForgetAfter    time.Duration
+}
+
+// banDuration 第 offences 次封禁的时长
+func (p Policy) banDuration(offences int64) time.Duration {
+	d := float64(p.BanDuration)
+	for i := int64(1); i < offences && d < float64(p.MaxBanDuration); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBanDuration) {
+		return p.MaxBanDuration
+	}
+	return time.Duration(d)
+}
+
+// Store 保存违规次数与封禁
+type Store interface {
+	// BannedUntil 返回 key 被封禁到的时间, 没有被封禁时返回零值
+	BannedUntil(ctx context.Context, key string, now time.Time) (time.Time, error)
+	// Violate 记录 key 的一次违规, 按 p 判断是否封禁. 返回封禁到的时间, 没有被封禁时为零值.
+	// banned 只有在这一次违规导致封禁时为 true, 已经被封禁时不再计数, 返回 false
+	Violate(ctx context.Context, key string, now time.Time, p Policy) (until time.Time, banned bool, err error)
+	// Unban 解除 key 的封禁并清空违规记录
+	Unban(ctx context.Context, key string) error
+	// Inspect 返回 key 在当前窗口内的违规次数与封禁到的时间, 没有被封禁时封禁到的时间为零值
+	Inspect(ctx context.Context, key string, now time.Time, p Policy) (violations int64, until time.Time, err error)
+	// SetViolations 解除 key 的封禁, 并将当前窗口内的违规次数设置为 n, 封禁的次数不变
+	SetViolations(ctx context.Context, key string, now time.Time, p Policy, n int64) error
+}
@@ -0,0 +1,173 @@
+package penaltylimit
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/rediskey"
+)
+
+//go:embed penalty.lua
+var luaPenalty string
+
+//go:embed penalty_set.lua
+var luaPenaltySet string
+
+// penaltyScript 优先使用 EVALSHA 执行, 脚本不存在时退回 EVAL
+var penaltyScript = redis.NewScript(luaPenalty)
+
+var penaltySetScript = redis.NewScript(luaPenaltySet)
+
+// RedisStore 在 redis 上保存违规次数与封禁, 所有实例共享.
+// 每个 key 使用一个 HASH, 在封禁结束且可以被遗忘之后过期
+type RedisStore struct {
+	cmd  redis.Cmdable
+	keys rediskey.Builder
+	// serverTime 使用 redis 服务器的时间, 忽略调用方传入的 now
+	serverTime bool
+}
+
+func NewRedisStore(cmd redis.Cmdable, opts ...RedisOption) *RedisStore {
+	s := &RedisStore{cmd: cmd}
+	for _, opt := range opts {
+		opt.applyRedis(s)
+	}
+	return s
+}
+
+type RedisOption interface {
+	applyRedis(*RedisStore)
+}
+
+type redisOptionFunc func(*RedisStore)
+
+func (f redisOptionFunc) applyRedis(s *RedisStore) {
+	f(s)
+}
+
+// WithServerTime 使用 redis 服务器的时间判断封禁, 避免各实例之间的时钟偏差
+func WithServerTime() RedisOption {
+	return redisOptionFunc(func(s *RedisStore) {
+		s.serverTime = true
+	})
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀
+func WithKeyPrefix(prefix string) RedisOption {
+	return redisOptionFunc(func(s *RedisStore) {
+		s.keys.Prefix = prefix
+	})
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster
+func WithHashTag() RedisOption {
+	return redisOptionFunc(func(s *RedisStore) {
+		s.keys.HashTag = true
+	})
+}
+
+func (s *RedisStore) key(key string) string {
+	return s.keys.Key(key, rediskey.SuffixPenalty)
+}
+
+func (s *RedisStore) BannedUntil(ctx context.Context, key string, now time.Time) (time.Time, error) {
+	now, res, err := s.hmget(ctx, key, now, "u")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return bannedUntil(now, parseInt(res[0])), nil
+}
+
+func (s *RedisStore) Inspect(ctx context.Context, key string, now time.Time, p Policy) (int64, time.Time, error) {
+	now, res, err := s.hmget(ctx, key, now, "ws", "c", "u")
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	until := bannedUntil(now, parseInt(res[2]))
+	if now.UnixMilli()-parseInt(res[0]) >= p.Window.Milliseconds() {
+		return 0, until, nil
+	}
+	return parseInt(res[1]), until, nil
+}
+
+// hmget 查询 key 的字段. 使用 redis 服务器的时间时在同一次往返中查询服务器的时间, 代替 now 返回
+func (s *RedisStore) hmget(ctx context.Context, key string, now time.Time,
+	fields ...string) (time.Time, []any, error) {
+	if !s.serverTime {
+		res, err := s.cmd.HMGet(ctx, s.key(key), fields...).Result()
+		return now, res, errs.Backend(err)
+	}
+	var (
+		serverTime *redis.TimeCmd
+		res        *redis.SliceCmd
+	)
+	_, err := s.cmd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		serverTime = pipe.Time(ctx)
+		res = pipe.HMGet(ctx, s.key(key), fields...)
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, nil, errs.Backend(err)
+	}
+	return serverTime.Val(), res.Val(), nil
+}
+
+// bannedUntil until 为 HASH 中封禁到的时间(毫秒), 已经过期时返回零值
+func bannedUntil(now time.Time, until int64) time.Time {
+	if now.UnixMilli() >= until {
+		return time.Time{}
+	}
+	return time.UnixMilli(until)
+}
+
+// parseInt HMGET 的结果, 字段不存在时为 0
+func parseInt(v any) int64 {
+	s, _ := v.(string)
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func (s *RedisStore) Violate(ctx context.Context, key string, now time.Time, p Policy) (time.Time, bool, error) {
+	nowMilli := now.UnixMilli()
+	if s.serverTime {
+		nowMilli = -1
+	}
+	res, err := penaltyScript.Run(ctx, s.cmd, []string{s.key(key)},
+		nowMilli, p.Threshold, p.Window.Milliseconds(), p.ForgetAfter.Milliseconds(),
+		p.BanDuration.Milliseconds(), p.MaxBanDuration.Milliseconds(), p.Multiplier).Int64Slice()
+	if err != nil {
+		return time.Time{}, false, errs.Backend(err)
+	}
+	if len(res) != 2 {
+		return time.Time{}, false, errs.Backend(fmt.Errorf("penaltylimit: 非预期的脚本返回值 %v", res))
+	}
+	if res[0] == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.UnixMilli(res[0]), res[1] == 1, nil
+}
+
+func (s *RedisStore) SetViolations(ctx context.Context, key string, now time.Time, p Policy, n int64) error {
+	nowMilli := now.UnixMilli()
+	if s.serverTime {
+		nowMilli = -1
+	}
+	err := penaltySetScript.Run(ctx, s.cmd, []string{s.key(key)},
+		nowMilli, n, p.Window.Milliseconds(), p.ForgetAfter.Milliseconds()).Err()
+	return errs.Backend(err)
+}
+
+func (s *RedisStore) Unban(ctx context.Context, key string) error {
+	return errs.Backend(s.cmd.Del(ctx, s.key(key)).Err())
+}
+
+// Preload 预先加载脚本到 redis, 可用于启动时的健康检查
+func (s *RedisStore) Preload(ctx context.Context) error {
+	return errs.Backend(penaltyScript.Load(ctx, s.cmd).Err())
+}
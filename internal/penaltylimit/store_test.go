@@ -0,0 +1,272 @@
+package penaltylimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPolicy 1 分钟内违规 3 次时封禁, 封禁 1 分钟、2 分钟、4 分钟, 最长 5 分钟, 1 小时后遗忘
+var testPolicy = Policy{
+	Threshold:      3,
+	Window:         time.Minute,
+	BanDuration:    time.Minute,
+	MaxBanDuration: 5 * time.Minute,
+	Multiplier:     2,
+	ForgetAfter:    time.Hour,
+}
+
+// step 在上一步之后经过 elapsed 的时间, 记录 violations 次违规
+type step struct {
+	name       string
+	elapsed    time.Duration
+	violations int
+	// wantBan 最后一次违规封禁的时长, 为 0 时没有封禁
+	wantBan time.Duration
+}
+
+var storeSteps = []step{
+	{
+		name:       "below_threshold",
+		violations: 2,
+	},
+	{
+		// 窗口过期后重新计数
+		name:       "window_expired",
+		elapsed:    time.Minute,
+		violations: 2,
+	},
+	{
+		name:       "first_ban",
+		violations: 1,
+		wantBan:    time.Minute,
+	},
+	{
+		name:       "second_ban",
+		elapsed:    time.Minute,
+		violations: 3,
+		wantBan:    2 * time.Minute,
+	},
+	{
+		name:       "third_ban",
+		elapsed:    2 * time.Minute,
+		violations: 3,
+		wantBan:    4 * time.Minute,
+	},
+	{
+		// 最长 5 分钟
+		name:       "max_ban",
+		elapsed:    4 * time.Minute,
+		violations: 3,
+		wantBan:    5 * time.Minute,
+	},
+	{
+		// 超过 1 小时没有封禁, 重新计算封禁的次数
+		name:       "forget",
+		elapsed:    time.Hour,
+		violations: 3,
+		wantBan:    time.Minute,
+	},
+}
+
+func testStore(t *testing.T, s Store, key string) {
+	ctx := context.Background()
+	now := time.UnixMilli(1695571200000)
+	for _, st := range storeSteps {
+		t.Run(st.name, func(t *testing.T) {
+			now = now.Add(st.elapsed)
+			var (
+				until  time.Time
+				banned bool
+			)
+			for i := 0; i < st.violations; i++ {
+				var err error
+				until, banned, err = s.Violate(ctx, key, now, testPolicy)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, st.wantBan > 0, banned)
+			got, err := s.BannedUntil(ctx, key, now)
+			require.NoError(t, err)
+			if st.wantBan == 0 {
+				assert.True(t, until.IsZero())
+				assert.True(t, got.IsZero())
+				return
+			}
+			assert.Equal(t, now.Add(st.wantBan), until)
+			assert.Equal(t, until, got)
+			// 封禁期间的违规不再计数, 也不会再次封禁
+			until, banned, err = s.Violate(ctx, key, now, testPolicy)
+			require.NoError(t, err)
+			assert.Equal(t, got, until)
+			assert.False(t, banned)
+			got, err = s.BannedUntil(ctx, key, now.Add(st.wantBan))
+			require.NoError(t, err)
+			assert.True(t, got.IsZero())
+		})
+	}
+	t.Run("unban", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, _, err := s.Violate(ctx, key, now, testPolicy)
+			require.NoError(t, err)
+		}
+		require.NoError(t, s.Unban(ctx, key))
+		got, err := s.BannedUntil(ctx, key, now)
+		require.NoError(t, err)
+		assert.True(t, got.IsZero())
+	})
+}
+
+// testStoreAdmin 查询与设置违规次数
+func testStoreAdmin(t *testing.T, s Store, key string) {
+	ctx := context.Background()
+	now := time.UnixMilli(1695571200000)
+	assertInspect := func(wantViolations int64, wantUntil time.Time) {
+		t.Helper()
+		violations, until, err := s.Inspect(ctx, key, now, testPolicy)
+		require.NoError(t, err)
+		assert.Equal(t, wantViolations, violations)
+		assert.Equal(t, wantUntil, until)
+	}
+	violate := func(n int) (until time.Time, banned bool) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			var err error
+			until, banned, err = s.Violate(ctx, key, now, testPolicy)
+			require.NoError(t, err)
+		}
+		return until, banned
+	}
+
+	assertInspect(0, time.Time{})
+	violate(2)
+	assertInspect(2, time.Time{})
+	require.NoError(t, s.SetViolations(ctx, key, now, testPolicy, 1))
+	assertInspect(1, time.Time{})
+	until, banned := violate(2)
+	assert.True(t, banned)
+	assert.Equal(t, now.Add(time.Minute), until)
+	assertInspect(0, until)
+
+	// 解除封禁, 封禁的次数不变
+	require.NoError(t, s.SetViolations(ctx, key, now, testPolicy, 2))
+	assertInspect(2, time.Time{})
+	got, err := s.BannedUntil(ctx, key, now)
+	require.NoError(t, err)
+	assert.True(t, got.IsZero())
+	until, banned = violate(1)
+	assert.True(t, banned)
+	assert.Equal(t, now.Add(2*time.Minute), until)
+
+	require.NoError(t, s.SetViolations(ctx, key, now, testPolicy, 0))
+	assertInspect(0, time.Time{})
+	// 窗口过期后违规次数为 0
+	violate(1)
+	assertInspect(1, time.Time{})
+	now = now.Add(time.Minute)
+	assertInspect(0, time.Time{})
+	require.NoError(t, s.Unban(ctx, key))
+}
+
+func TestLocalStore(t *testing.T) {
+	testStore(t, NewLocalStore(), "foo")
+}
+
+func TestLocalStore_Admin(t *testing.T) {
+	testStoreAdmin(t, NewLocalStore(), "foo")
+}
+
+func TestRedisStore(t *testing.T) {
+	cli := initRedis()
+	s := NewRedisStore(cli, WithKeyPrefix("penalty_test"))
+	require.NoError(t, cli.Del(context.Background(), "penalty_test:foo:penalty").Err())
+	defer cli.Del(context.Background(), "penalty_test:foo:penalty")
+	testStore(t, s, "foo")
+}
+
+func TestRedisStore_Admin(t *testing.T) {
+	cli := initRedis()
+	s := NewRedisStore(cli, WithKeyPrefix("penalty_admin_test"))
+	require.NoError(t, cli.Del(context.Background(), "penalty_admin_test:foo:penalty").Err())
+	defer cli.Del(context.Background(), "penalty_admin_test:foo:penalty")
+	testStoreAdmin(t, s, "foo")
+}
+
+func TestRedisStore_TTL(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	s := NewRedisStore(cli)
+	require.NoError(t, cli.Del(ctx, "ttl:penalty").Err())
+	defer cli.Del(ctx, "ttl:penalty")
+	now := time.Now()
+
+	_, _, err := s.Violate(ctx, "ttl", now, testPolicy)
+	require.NoError(t, err)
+	ttl, err := cli.PTTL(ctx, "ttl:penalty").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	// 封禁之后保留到可以被遗忘
+	for i := 0; i < 2; i++ {
+		_, _, err = s.Violate(ctx, "ttl", now, testPolicy)
+		require.NoError(t, err)
+	}
+	ttl, err = cli.PTTL(ctx, "ttl:penalty").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+}
+
+// 使用 redis 服务器的时间, 忽略调用方传入的时间
+func TestRedisStore_ServerTime(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	s := NewRedisStore(cli, WithServerTime())
+	require.NoError(t, cli.Del(ctx, "server_time:penalty").Err())
+	defer cli.Del(ctx, "server_time:penalty")
+	// 调用方的时钟落后 1 天
+	skewed := time.Now().Add(-24 * time.Hour)
+
+	var (
+		until  time.Time
+		banned bool
+		err    error
+	)
+	for i := 0; i < 3; i++ {
+		until, banned, err = s.Violate(ctx, "server_time", skewed, testPolicy)
+		require.NoError(t, err)
+	}
+	assert.True(t, banned)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), until, 5*time.Second)
+
+	got, err := s.BannedUntil(ctx, "server_time", skewed)
+	require.NoError(t, err)
+	assert.Equal(t, until, got)
+	// 调用方的时钟超前时依然被封禁
+	got, err = s.BannedUntil(ctx, "server_time", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, until, got)
+
+	got, err = s.BannedUntil(ctx, "not_banned", skewed)
+	require.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	violations, got, err := s.Inspect(ctx, "server_time", skewed, testPolicy)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), violations)
+	assert.Equal(t, until, got)
+	require.NoError(t, s.SetViolations(ctx, "server_time", skewed, testPolicy, 1))
+	violations, got, err = s.Inspect(ctx, "server_time", skewed, testPolicy)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), violations)
+	assert.True(t, got.IsZero())
+}
+
+func initRedis() redis.Cmdable {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:16379",
+	})
+	return redisClient
+}
@@ -0,0 +1,127 @@
+package promcollector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/udugong/limiter/internal/metriclimit"
+)
+
+// labels 每次返回新的切片, 避免不同指标共享同一个底层数组
+func labels(extra ...string) []string {
+	return append([]string{"name", "group"}, extra...)
+}
+
+// Collector 将限流器的指标记录到 prometheus
+type Collector struct {
+	decisions     *prometheus.CounterVec
+	releaseErrors *prometheus.CounterVec
+	active        *prometheus.GaugeVec
+	wait          *prometheus.HistogramVec
+	latency       *prometheus.HistogramVec
+}
+
+type config struct {
+	namespace      string
+	waitBuckets    []float64
+	latencyBuckets []float64
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (f optionFunc) apply(c *config) {
+	f(c)
+}
+
+// WithNamespace 指标名称的命名空间. 默认为 "limiter"
+func WithNamespace(namespace string) Option {
+	return optionFunc(func(c *config) {
+		c.namespace = namespace
+	})
+}
+
+// WithWaitBuckets BlockLimit 等待时间直方图的桶, 单位为秒
+func WithWaitBuckets(buckets []float64) Option {
+	return optionFunc(func(c *config) {
+		c.waitBuckets = buckets
+	})
+}
+
+// WithLatencyBuckets 限流器耗时直方图的桶, 单位为秒
+func WithLatencyBuckets(buckets []float64) Option {
+	return optionFunc(func(c *config) {
+		c.latencyBuckets = buckets
+	})
+}
+
+// NewCollector 创建 prometheus 指标收集器并注册到 reg
+func NewCollector(reg prometheus.Registerer, opts ...Option) (*Collector, error) {
+	c := config{
+		namespace:      "limiter",
+		waitBuckets:    prometheus.DefBuckets,
+		latencyBuckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}
+	for _, opt := range opts {
+		opt.apply(&c)
+	}
+	col := &Collector{
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.namespace,
+			Name:      "decisions_total",
+			Help:      "限流判断的次数, decision 为 allowed / limited / error",
+		}, labels("decision")),
+		releaseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.namespace,
+			Name:      "release_errors_total",
+			Help:      "活跃请求数限流器 Decr 出错的次数",
+		}, labels()),
+		active: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: c.namespace,
+			Name:      "active_requests",
+			Help:      "活跃请求数",
+		}, labels()),
+		wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: c.namespace,
+			Name:      "wait_seconds",
+			Help:      "BlockLimit 的等待时间",
+			Buckets:   c.waitBuckets,
+		}, labels()),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: c.namespace,
+			Name:      "latency_seconds",
+			Help:      "限流器本身(如访问 redis)的耗时",
+			Buckets:   c.latencyBuckets,
+		}, labels()),
+	}
+	for _, m := range []prometheus.Collector{col.decisions, col.releaseErrors, col.active, col.wait, col.latency} {
+		if err := reg.Register(m); err != nil {
+			return nil, err
+		}
+	}
+	return col, nil
+}
+
+func (c *Collector) IncDecision(name, group string, decision metriclimit.Decision) {
+	c.decisions.WithLabelValues(name, group, string(decision)).Inc()
+}
+
+func (c *Collector) IncReleaseError(name, group string) {
+	c.releaseErrors.WithLabelValues(name, group).Inc()
+}
+
+func (c *Collector) AddActive(name, group string, delta float64) {
+	c.active.WithLabelValues(name, group).Add(delta)
+}
+
+func (c *Collector) ObserveWait(name, group string, d time.Duration) {
+	c.wait.WithLabelValues(name, group).Observe(d.Seconds())
+}
+
+func (c *Collector) ObserveLatency(name, group string, d time.Duration) {
+	c.latency.WithLabelValues(name, group).Observe(d.Seconds())
+}
@@ -0,0 +1,54 @@
+package promcollector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter/internal/metriclimit"
+)
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, err := NewCollector(reg)
+	require.NoError(t, err)
+
+	c.IncDecision("api", "user", metriclimit.Allowed)
+	c.IncDecision("api", "user", metriclimit.Limited)
+	c.IncDecision("api", "user", metriclimit.Limited)
+	c.AddActive("api", "user", 1)
+	c.IncReleaseError("api", "user")
+	c.ObserveWait("api", "user", 10*time.Millisecond)
+	c.ObserveLatency("api", "user", time.Millisecond)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.decisions.WithLabelValues("api", "user", "allowed")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(c.decisions.WithLabelValues("api", "user", "limited")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.active.WithLabelValues("api", "user")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.releaseErrors.WithLabelValues("api", "user")))
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP limiter_latency_seconds 限流器本身(如访问 redis)的耗时
+# TYPE limiter_latency_seconds histogram
+limiter_latency_seconds_bucket{group="user",name="api",le="0.0005"} 0
+limiter_latency_seconds_bucket{group="user",name="api",le="0.001"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.0025"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.005"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.01"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.025"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.05"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.1"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="0.25"} 1
+limiter_latency_seconds_bucket{group="user",name="api",le="+Inf"} 1
+limiter_latency_seconds_sum{group="user",name="api"} 0.001
+limiter_latency_seconds_count{group="user",name="api"} 1
+`), "limiter_latency_seconds")
+	assert.NoError(t, err)
+
+	// 重复注册
+	_, err = NewCollector(reg)
+	assert.Error(t, err)
+}
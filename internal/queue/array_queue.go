@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	errQueueFull  = errors.New("队列已满")
+	errQueueEmpty = errors.New("队列为空")
+)
+
+// ArrayBoundedQueue 基于环形数组的有界队列, 非并发安全
+type ArrayBoundedQueue struct {
+	data []time.Time
+	head int
+	size int
+}
+
+// NewArrayBoundedQueue 创建一个容量为 capacity 的有界队列
+func NewArrayBoundedQueue(capacity int) *ArrayBoundedQueue {
+	return &ArrayBoundedQueue{
+		data: make([]time.Time, capacity),
+	}
+}
+
+func (q *ArrayBoundedQueue) Enqueue(val time.Time) error {
+	if q.IsFull() {
+		return errQueueFull
+	}
+	q.data[(q.head+q.size)%len(q.data)] = val
+	q.size++
+	return nil
+}
+
+func (q *ArrayBoundedQueue) Dequeue() (time.Time, error) {
+	if q.size == 0 {
+		return time.Time{}, errQueueEmpty
+	}
+	val := q.data[q.head]
+	q.head = (q.head + 1) % len(q.data)
+	q.size--
+	return val, nil
+}
+
+func (q *ArrayBoundedQueue) RemoveTail() (time.Time, error) {
+	if q.size == 0 {
+		return time.Time{}, errQueueEmpty
+	}
+	q.size--
+	return q.data[(q.head+q.size)%len(q.data)], nil
+}
+
+func (q *ArrayBoundedQueue) Remove(val time.Time) bool {
+	for i := q.size - 1; i >= 0; i-- {
+		if !q.data[(q.head+i)%len(q.data)].Equal(val) {
+			continue
+		}
+		// 之后的元素依次前移
+		for j := i; j < q.size-1; j++ {
+			q.data[(q.head+j)%len(q.data)] = q.data[(q.head+j+1)%len(q.data)]
+		}
+		q.size--
+		return true
+	}
+	return false
+}
+
+func (q *ArrayBoundedQueue) Peek() (time.Time, error) {
+	if q.size == 0 {
+		return time.Time{}, errQueueEmpty
+	}
+	return q.data[q.head], nil
+}
+
+func (q *ArrayBoundedQueue) Len() int {
+	return q.size
+}
+
+func (q *ArrayBoundedQueue) Cap() int {
+	return len(q.data)
+}
+
+func (q *ArrayBoundedQueue) IsFull() bool {
+	return q.size >= len(q.data)
+}
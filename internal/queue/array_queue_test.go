@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrayBoundedQueue(t *testing.T) {
+	q := NewArrayBoundedQueue(2)
+	t1, t2, t3 := time.UnixMilli(1), time.UnixMilli(2), time.UnixMilli(3)
+
+	_, err := q.Peek()
+	assert.Equal(t, errQueueEmpty, err)
+	_, err = q.Dequeue()
+	assert.Equal(t, errQueueEmpty, err)
+
+	assert.NoError(t, q.Enqueue(t1))
+	assert.NoError(t, q.Enqueue(t2))
+	assert.True(t, q.IsFull())
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, 2, q.Cap())
+	assert.Equal(t, errQueueFull, q.Enqueue(t3))
+
+	got, err := q.Dequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, t1, got)
+	assert.False(t, q.IsFull())
+
+	// 环形写入
+	assert.NoError(t, q.Enqueue(t3))
+	got, err = q.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, t2, got)
+	got, err = q.Dequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, t2, got)
+	got, err = q.Dequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, t3, got)
+}
+
+func TestArrayBoundedQueue_RemoveTail(t *testing.T) {
+	q := NewArrayBoundedQueue(2)
+	t1, t2, t3 := time.UnixMilli(1), time.UnixMilli(2), time.UnixMilli(3)
+
+	_, err := q.RemoveTail()
+	assert.Equal(t, errQueueEmpty, err)
+
+	assert.NoError(t, q.Enqueue(t1))
+	assert.NoError(t, q.Enqueue(t2))
+	_, _ = q.Dequeue()
+	// 队尾跨过数组末尾
+	assert.NoError(t, q.Enqueue(t3))
+	got, err := q.RemoveTail()
+	assert.NoError(t, err)
+	assert.Equal(t, t3, got)
+	got, err = q.RemoveTail()
+	assert.NoError(t, err)
+	assert.Equal(t, t2, got)
+	_, err = q.RemoveTail()
+	assert.Equal(t, errQueueEmpty, err)
+}
+
+func TestArrayBoundedQueue_Remove(t *testing.T) {
+	q := NewArrayBoundedQueue(3)
+	t1, t2, t3, t4 := time.UnixMilli(1), time.UnixMilli(2), time.UnixMilli(3), time.UnixMilli(4)
+	assert.False(t, q.Remove(t1))
+
+	assert.NoError(t, q.Enqueue(t1))
+	assert.NoError(t, q.Enqueue(t1))
+	_, _ = q.Dequeue()
+	assert.NoError(t, q.Enqueue(t2))
+	// 跨过数组末尾
+	assert.NoError(t, q.Enqueue(t3))
+	assert.True(t, q.Remove(t2))
+	assert.False(t, q.Remove(t4))
+	assert.NoError(t, q.Enqueue(t4))
+	for _, want := range []time.Time{t1, t3, t4} {
+		got, err := q.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
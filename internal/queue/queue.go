@@ -9,3 +9,19 @@ type BoundedQueue interface {
 	Peek() (time.Time, error)    // 查看对头元素
 	IsFull() bool                // 是否队满
 }
+
+// Sizer 可以查询长度与容量的队列
+type Sizer interface {
+	Len() int // 元素个数
+	Cap() int // 容量
+}
+
+// TailRemover 可以移除队尾元素的队列, 用于撤销最近一次入队
+type TailRemover interface {
+	RemoveTail() (time.Time, error) // 移除队尾元素
+}
+
+// Remover 可以移除指定元素的队列, 用于撤销指定的一次入队
+type Remover interface {
+	Remove(val time.Time) bool // 移除最后一个等于 val 的元素, 不存在时返回 false
+}
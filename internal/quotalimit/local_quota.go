@@ -0,0 +1,137 @@
+package quotalimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// LocalQuotaLimiter 本地的日历周期配额限流器.
+// 周期结束的限流对象在之后第一次计入或调整配额时一起删除
+type LocalQuotaLimiter struct {
+	calendar
+	lock   sync.Mutex
+	usages map[string]*localUsage
+	// pruneAt 最早结束的周期的结束时间, 之后需要删除周期已经结束的限流对象
+	pruneAt time.Time
+}
+
+type localUsage struct {
+	// start 所属周期的开始时间
+	start time.Time
+	// end 所属周期的结束时间
+	end  time.Time
+	used int64
+}
+
+// NewLocalQuotaLimiter 每个 period 周期内每个 key 允许 quota 个请求
+func NewLocalQuotaLimiter(quota int64, period Period, opts ...Option) *LocalQuotaLimiter {
+	l := &LocalQuotaLimiter{
+		calendar: newCalendar(quota, period),
+		usages:   make(map[string]*localUsage),
+	}
+	for _, opt := range opts {
+		opt.apply(&l.calendar)
+	}
+	return l
+}
+
+func (l *LocalQuotaLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited := l.limit(key)
+	observer.Notify(ctx, l.observer, key, limited, nil)
+	return limited, nil
+}
+
+func (l *LocalQuotaLimiter) limit(key string) bool {
+	now := l.timeFunc()
+	start, end := l.boundsAt(key, now)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	u := l.current(key, now, start, end)
+	if u.used >= l.quota {
+		return true
+	}
+	u.used++
+	return false
+}
+
+func (l *LocalQuotaLimiter) Usage(_ context.Context, key string) (Usage, error) {
+	start, end := l.bounds(key)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var used int64
+	if u, ok := l.usages[key]; ok && u.start.Equal(start) {
+		used = u.used
+	}
+	return newUsage(l.quota, used, end), nil
+}
+
+// current 返回 key 在 start 开始、end 结束的周期的使用情况, 进入新的周期时重置. 调用方需要持有锁
+func (l *LocalQuotaLimiter) current(key string, now, start, end time.Time) *localUsage {
+	l.prune(now)
+	u, ok := l.usages[key]
+	if !ok {
+		u = &localUsage{start: start, end: end}
+		l.usages[key] = u
+	}
+	if !u.start.Equal(start) {
+		u.start = start
+		u.end = end
+		u.used = 0
+	}
+	if l.pruneAt.IsZero() || end.Before(l.pruneAt) {
+		l.pruneAt = end
+	}
+	return u
+}
+
+// prune 到达 pruneAt 时删除周期已经结束的限流对象, 并更新 pruneAt. 调用方需要持有锁
+func (l *LocalQuotaLimiter) prune(now time.Time) {
+	if l.pruneAt.IsZero() || now.Before(l.pruneAt) {
+		return
+	}
+	l.pruneAt = time.Time{}
+	for k, u := range l.usages {
+		if !now.Before(u.end) {
+			delete(l.usages, k)
+			continue
+		}
+		if l.pruneAt.IsZero() || u.end.Before(l.pruneAt) {
+			l.pruneAt = u.end
+		}
+	}
+}
+
+// Inspect 查询 key 当前周期的使用情况
+func (l *LocalQuotaLimiter) Inspect(ctx context.Context, key string) (limiter.State, error) {
+	u, err := l.Usage(ctx, key)
+	if err != nil {
+		return limiter.State{}, err
+	}
+	return limiter.NewState(u.Quota, u.Used), nil
+}
+
+// Reset 清空 key 当前周期已使用的配额
+func (l *LocalQuotaLimiter) Reset(_ context.Context, key string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.usages, key)
+	return nil
+}
+
+// Adjust key 当前周期已使用的配额减少 delta, 最少为 0
+func (l *LocalQuotaLimiter) Adjust(_ context.Context, key string, delta int64) error {
+	now := l.timeFunc()
+	start, end := l.boundsAt(key, now)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	u := l.current(key, now, start, end)
+	u.used -= delta
+	if u.used < 0 {
+		u.used = 0
+	}
+	return nil
+}
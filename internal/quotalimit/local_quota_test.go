@@ -0,0 +1,182 @@
+package quotalimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/udugong/limiter"
+)
+
+func TestLocalQuotaLimiter_Limit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 1, 23, 0, 0, 0, time.UTC)
+	l := NewLocalQuotaLimiter(2, Daily, WithLocation(time.UTC), WithTimeFunc(func() time.Time {
+		return now
+	}))
+	for _, want := range []bool{false, false, true} {
+		got, err := l.Limit(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	// 其他 key 单独计数
+	got, err := l.Limit(ctx, "bar")
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	usage, err := l.Usage(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{
+		Quota:     2,
+		Used:      2,
+		Remaining: 0,
+		ResetAt:   time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC),
+	}, usage)
+
+	// 0 点重置
+	now = time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)
+	usage, err = l.Usage(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.Used)
+	assert.Equal(t, int64(2), usage.Remaining)
+	got, err = l.Limit(ctx, "foo")
+	require.NoError(t, err)
+	assert.False(t, got)
+}
+
+// 每个客户在各自时区的 0 点重置
+func TestLocalQuotaLimiter_LocationFunc(t *testing.T) {
+	ctx := context.Background()
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	now := time.Date(2023, 10, 1, 15, 30, 0, 0, time.UTC)
+	l := NewLocalQuotaLimiter(1, Daily,
+		WithLocationFunc(func(key string) *time.Location {
+			if key == "cn" {
+				return shanghai
+			}
+			return time.UTC
+		}),
+		WithTimeFunc(func() time.Time { return now }),
+	)
+	for _, key := range []string{"cn", "us"} {
+		got, err := l.Limit(ctx, key)
+		require.NoError(t, err)
+		require.False(t, got)
+	}
+
+	// UTC 16:00 是上海的 0 点, 只有 cn 重置
+	now = time.Date(2023, 10, 1, 16, 0, 0, 0, time.UTC)
+	got, err := l.Limit(ctx, "cn")
+	require.NoError(t, err)
+	assert.False(t, got)
+	got, err = l.Limit(ctx, "us")
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	usage, err := l.Usage(ctx, "cn")
+	require.NoError(t, err)
+	assert.True(t, time.Date(2023, 10, 3, 0, 0, 0, 0, shanghai).Equal(usage.ResetAt))
+}
+
+// 周期结束的限流对象在之后第一次计入时删除
+func TestLocalQuotaLimiter_Prune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 1, 23, 0, 0, 0, time.UTC)
+	l := NewLocalQuotaLimiter(1, Daily, WithLocation(time.UTC), WithTimeFunc(func() time.Time {
+		return now
+	}))
+	for _, key := range []string{"foo", "bar"} {
+		_, err := l.Limit(ctx, key)
+		require.NoError(t, err)
+	}
+	assert.Len(t, l.usages, 2)
+
+	now = time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)
+	_, err := l.Limit(ctx, "baz")
+	require.NoError(t, err)
+	assert.Len(t, l.usages, 1)
+	assert.Contains(t, l.usages, "baz")
+	assert.Equal(t, time.Date(2023, 10, 3, 0, 0, 0, 0, time.UTC), l.pruneAt)
+}
+
+func TestLocalQuotaLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 1, 23, 0, 0, 0, time.UTC)
+	l := NewLocalQuotaLimiter(3, Daily, WithLocation(time.UTC), WithTimeFunc(func() time.Time {
+		return now
+	}))
+	for i := 0; i < 3; i++ {
+		_, err := l.Limit(ctx, "foo")
+		require.NoError(t, err)
+	}
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+	}{
+		{
+			name: "inspect",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 3, Used: 3, Remaining: 0},
+		},
+		{
+			name: "grant",
+			op:   func() error { return l.Adjust(ctx, "foo", 2) },
+			want: limiter.State{Limit: 3, Used: 1, Remaining: 2},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return l.Adjust(ctx, "foo", -5) },
+			want: limiter.State{Limit: 3, Used: 6, Remaining: 0},
+		},
+		{
+			name: "reset",
+			op:   func() error { return l.Reset(ctx, "foo") },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+		{
+			// 进入新的周期, 之前的调整不再生效
+			name: "next_period",
+			op: func() error {
+				err := l.Adjust(ctx, "foo", -1)
+				now = now.Add(time.Hour)
+				return err
+			},
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.op())
+			got, err := l.Inspect(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// countObserver 统计各类事件的次数
+type countObserver struct {
+	limiter.NopObserver
+	allow, limit, errs int
+}
+
+func (c *countObserver) OnAllow(context.Context, string) { c.allow++ }
+
+func (c *countObserver) OnLimit(context.Context, string) { c.limit++ }
+
+func (c *countObserver) OnError(context.Context, string, error) { c.errs++ }
+
+func TestLocalQuotaLimiter_Observer(t *testing.T) {
+	o := &countObserver{}
+	l := NewLocalQuotaLimiter(1, Daily, WithObserver(o))
+	for i := 0; i < 3; i++ {
+		_, err := l.Limit(context.Background(), "foo")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, &countObserver{allow: 1, limit: 2}, o)
+}
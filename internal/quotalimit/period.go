@@ -0,0 +1,163 @@
+package quotalimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/udugong/limiter"
+)
+
+// Period 日历周期
+type Period int
+
+const (
+	// Daily 每天 0 点重置
+	Daily Period = iota
+	// Weekly 每周的第一天 0 点重置, 默认周一为第一天
+	Weekly
+	// Monthly 每月 1 日 0 点重置
+	Monthly
+)
+
+func (p Period) String() string {
+	switch p {
+	case Daily:
+		return "daily"
+	case Weekly:
+		return "weekly"
+	case Monthly:
+		return "monthly"
+	default:
+		return "period(" + strconv.Itoa(int(p)) + ")"
+	}
+}
+
+// Usage 配额的使用情况
+type Usage struct {
+	// Quota 每个周期的配额
+	Quota int64
+	// Used 当前周期已使用的配额
+	Used int64
+	// Remaining 当前周期剩余的配额
+	Remaining int64
+	// ResetAt 当前周期结束, 配额重置的时间
+	ResetAt time.Time
+}
+
+func newUsage(quota, used int64, resetAt time.Time) Usage {
+	remaining := quota - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Usage{Quota: quota, Used: used, Remaining: remaining, ResetAt: resetAt}
+}
+
+// QuotaLimiter 按日历周期限制配额的限流器
+type QuotaLimiter interface {
+	Limit(ctx context.Context, key string) (bool, error)
+	// Usage 查询 key 当前周期的使用情况, 不消耗配额
+	Usage(ctx context.Context, key string) (Usage, error)
+}
+
+// calendar 计算日历周期, LocalQuotaLimiter 与 RedisQuotaLimiter 共用
+type calendar struct {
+	quota     int64
+	period    Period
+	location  func(key string) *time.Location
+	weekStart time.Weekday
+	timeFunc  func() time.Time
+	observer  limiter.Observer
+}
+
+func newCalendar(quota int64, period Period) calendar {
+	return calendar{
+		quota:     quota,
+		period:    period,
+		location:  func(string) *time.Location { return time.Local },
+		weekStart: time.Monday,
+		timeFunc:  func() time.Time { return time.Now() },
+	}
+}
+
+// bounds 返回 key 当前周期的开始与结束时间
+func (c calendar) bounds(key string) (time.Time, time.Time) {
+	return c.boundsAt(key, c.timeFunc())
+}
+
+// boundsAt 返回 key 在 now 所属周期的开始与结束时间
+func (c calendar) boundsAt(key string, now time.Time) (time.Time, time.Time) {
+	loc := c.location(key)
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	y, m, d := now.Date()
+	switch c.period {
+	case Weekly:
+		offset := (int(now.Weekday()) - int(c.weekStart) + 7) % 7
+		start := time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 7)
+	case Monthly:
+		start := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+type Option interface {
+	RedisOption
+	apply(*calendar)
+}
+
+type optionFunc func(*calendar)
+
+func (f optionFunc) apply(c *calendar) {
+	f(c)
+}
+
+func (f optionFunc) applyRedis(r *RedisQuotaLimiter) {
+	f(&r.calendar)
+}
+
+// WithLocation 按 loc 的时区计算周期. 默认 time.Local
+func WithLocation(loc *time.Location) Option {
+	return optionFunc(func(c *calendar) {
+		c.location = func(string) *time.Location { return loc }
+	})
+}
+
+// WithLocationFunc 按 key 所属的时区计算周期, 例如每个客户的配额在各自时区的 0 点重置
+func WithLocationFunc(fn func(key string) *time.Location) Option {
+	return optionFunc(func(c *calendar) {
+		c.location = fn
+	})
+}
+
+// WithWeekStart 每周的第一天, 只对 Weekly 有效. 默认周一
+func WithWeekStart(day time.Weekday) Option {
+	return optionFunc(func(c *calendar) {
+		c.weekStart = day
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(c *calendar) {
+		c.timeFunc = fn
+	})
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) Option {
+	return optionFunc(func(c *calendar) {
+		c.observer = o
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
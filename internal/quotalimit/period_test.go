@@ -0,0 +1,90 @@
+package quotalimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendar_Bounds(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	tests := []struct {
+		name      string
+		period    Period
+		loc       *time.Location
+		weekStart time.Weekday
+		now       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			// UTC 的 2023-09-30 20:00 在上海已经是 10 月 1 日
+			name:      "daily_in_shanghai",
+			period:    Daily,
+			loc:       shanghai,
+			now:       time.Date(2023, 9, 30, 20, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2023, 10, 1, 0, 0, 0, 0, shanghai),
+			wantEnd:   time.Date(2023, 10, 2, 0, 0, 0, 0, shanghai),
+		},
+		{
+			// 夏令时结束的这一天有 25 小时
+			name:      "daily_dst",
+			period:    Daily,
+			loc:       newYork,
+			now:       time.Date(2023, 11, 5, 12, 0, 0, 0, newYork),
+			wantStart: time.Date(2023, 11, 5, 0, 0, 0, 0, newYork),
+			wantEnd:   time.Date(2023, 11, 6, 0, 0, 0, 0, newYork),
+		},
+		{
+			// 2023-10-01 是周日
+			name:      "weekly_start_monday",
+			period:    Weekly,
+			loc:       time.UTC,
+			weekStart: time.Monday,
+			now:       time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2023, 9, 25, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "weekly_start_sunday",
+			period:    Weekly,
+			loc:       time.UTC,
+			weekStart: time.Sunday,
+			now:       time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2023, 10, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "monthly",
+			period:    Monthly,
+			loc:       shanghai,
+			now:       time.Date(2024, 2, 29, 23, 59, 59, 0, shanghai),
+			wantStart: time.Date(2024, 2, 1, 0, 0, 0, 0, shanghai),
+			wantEnd:   time.Date(2024, 3, 1, 0, 0, 0, 0, shanghai),
+		},
+		{
+			name:      "monthly_end_of_year",
+			period:    Monthly,
+			loc:       time.UTC,
+			now:       time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCalendar(10, tt.period)
+			WithLocation(tt.loc).apply(&c)
+			WithWeekStart(tt.weekStart).apply(&c)
+			WithTimeFunc(func() time.Time { return tt.now }).apply(&c)
+			start, end := c.bounds("")
+			assert.True(t, tt.wantStart.Equal(start), "start: %s", start)
+			assert.True(t, tt.wantEnd.Equal(end), "end: %s", end)
+		})
+	}
+}
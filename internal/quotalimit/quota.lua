@@ -0,0 +1,14 @@
+-- 当前周期的配额
+local key = KEYS[1]
+-- 每个周期的配额
+local quota = tonumber(ARGV[1])
+-- 距离周期结束的时间(毫秒), key 在之后过期
+local ttl = tonumber(ARGV[2])
+
+local used = tonumber(redis.call('GET', key) or '0')
+if used >= quota then
+    return {1, used}
+end
+used = redis.call('INCR', key)
+redis.call('PEXPIRE', key, ttl)
+return {0, used}
@@ -0,0 +1,13 @@
+-- 当前周期的配额
+local key = KEYS[1]
+-- 为正时归还配额, 为负时扣除配额
+local delta = tonumber(ARGV[1])
+-- 距离周期结束的时间(毫秒), key 在之后过期
+local ttl = tonumber(ARGV[2])
+
+local used = tonumber(redis.call('GET', key) or '0') - delta
+if used < 0 then
+    used = 0
+end
+redis.call('SET', key, used, 'PX', ttl)
+return used
@@ -0,0 +1,175 @@
+package quotalimit
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+	"github.com/udugong/limiter/internal/rediskey"
+)
+
+//go:embed quota.lua
+var luaQuota string
+
+// quotaScript 优先使用 EVALSHA 执行, 脚本不存在时退回 EVAL
+var quotaScript = redis.NewScript(luaQuota)
+
+//go:embed quota_adjust.lua
+var luaQuotaAdjust string
+
+var quotaAdjustScript = redis.NewScript(luaQuotaAdjust)
+
+// RedisQuotaLimiter 基于 redis 的日历周期配额限流器.
+// 每个周期使用单独的 key, 周期结束后 key 过期. 周期默认由本地时间计算, 各实例之间的时钟偏差会影响重置的时间,
+// 使用 WithServerTime 时由 redis 服务器的时间计算, 每次操作多一次往返
+type RedisQuotaLimiter struct {
+	calendar
+	cmd        redis.Cmdable
+	keys       rediskey.Builder
+	serverTime bool
+	// expireDelay 周期结束后 key 延迟过期的时间, 避免时钟偏差导致提前过期
+	expireDelay time.Duration
+}
+
+// NewRedisQuotaLimiter 每个 period 周期内每个 key 允许 quota 个请求
+func NewRedisQuotaLimiter(cmd redis.Cmdable, quota int64, period Period, opts ...RedisOption) *RedisQuotaLimiter {
+	r := &RedisQuotaLimiter{
+		calendar:    newCalendar(quota, period),
+		cmd:         cmd,
+		expireDelay: time.Minute,
+	}
+	for _, opt := range opts {
+		opt.applyRedis(r)
+	}
+	return r
+}
+
+type RedisOption interface {
+	applyRedis(*RedisQuotaLimiter)
+}
+
+type redisOptionFunc func(*RedisQuotaLimiter)
+
+func (f redisOptionFunc) applyRedis(r *RedisQuotaLimiter) {
+	f(r)
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀
+func WithKeyPrefix(prefix string) RedisOption {
+	return redisOptionFunc(func(r *RedisQuotaLimiter) {
+		r.keys.Prefix = prefix
+	})
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster
+func WithHashTag() RedisOption {
+	return redisOptionFunc(func(r *RedisQuotaLimiter) {
+		r.keys.HashTag = true
+	})
+}
+
+// WithServerTime 使用 redis 服务器的时间计算周期, 各实例在同一时刻重置
+func WithServerTime() RedisOption {
+	return redisOptionFunc(func(r *RedisQuotaLimiter) {
+		r.serverTime = true
+	})
+}
+
+// key 返回 key 在 start 开始的周期在 redis 上的 key, 例如 key:quota:daily:20231001.
+// 包含周期的类型, 同一个限流对象的日、周、月配额使用不同的 key
+func (r *RedisQuotaLimiter) key(key string, start time.Time) string {
+	return r.keys.Key(key, rediskey.SuffixQuota, r.period.String(), start.Format("20060102"))
+}
+
+// now 当前时间, 使用 redis 服务器的时间时需要查询
+func (r *RedisQuotaLimiter) now(ctx context.Context) (time.Time, error) {
+	if !r.serverTime {
+		return r.timeFunc(), nil
+	}
+	now, err := r.cmd.Time(ctx).Result()
+	return now, errs.Backend(err)
+}
+
+func (r *RedisQuotaLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := r.limit(ctx, key)
+	observer.Notify(ctx, r.observer, key, limited, err)
+	return limited, err
+}
+
+func (r *RedisQuotaLimiter) limit(ctx context.Context, key string) (bool, error) {
+	now, err := r.now(ctx)
+	if err != nil {
+		return false, err
+	}
+	start, end := r.boundsAt(key, now)
+	ttl := end.Sub(now) + r.expireDelay
+	res, err := quotaScript.Run(ctx, r.cmd, []string{r.key(key, start)},
+		r.quota, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, errs.Backend(err)
+	}
+	if len(res) != 2 {
+		return false, errs.Backend(fmt.Errorf("quotalimit: 非预期的脚本返回值 %v", res))
+	}
+	return res[0] == 1, nil
+}
+
+func (r *RedisQuotaLimiter) Usage(ctx context.Context, key string) (Usage, error) {
+	now, err := r.now(ctx)
+	if err != nil {
+		return Usage{}, err
+	}
+	start, end := r.boundsAt(key, now)
+	used, err := r.cmd.Get(ctx, r.key(key, start)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return newUsage(r.quota, 0, end), nil
+	}
+	if err != nil {
+		return Usage{}, errs.Backend(err)
+	}
+	return newUsage(r.quota, used, end), nil
+}
+
+// Preload 预先加载脚本到 redis, 可用于启动时的健康检查
+func (r *RedisQuotaLimiter) Preload(ctx context.Context) error {
+	return errs.Backend(quotaScript.Load(ctx, r.cmd).Err())
+}
+
+// Inspect 查询 key 当前周期的使用情况
+func (r *RedisQuotaLimiter) Inspect(ctx context.Context, key string) (limiter.State, error) {
+	u, err := r.Usage(ctx, key)
+	if err != nil {
+		return limiter.State{}, err
+	}
+	return limiter.NewState(u.Quota, u.Used), nil
+}
+
+// Reset 清空 key 当前周期已使用的配额
+func (r *RedisQuotaLimiter) Reset(ctx context.Context, key string) error {
+	now, err := r.now(ctx)
+	if err != nil {
+		return err
+	}
+	start, _ := r.boundsAt(key, now)
+	return errs.Backend(r.cmd.Del(ctx, r.key(key, start)).Err())
+}
+
+// Adjust key 当前周期已使用的配额减少 delta, 最少为 0
+func (r *RedisQuotaLimiter) Adjust(ctx context.Context, key string, delta int64) error {
+	now, err := r.now(ctx)
+	if err != nil {
+		return err
+	}
+	start, end := r.boundsAt(key, now)
+	ttl := end.Sub(now) + r.expireDelay
+	err = quotaAdjustScript.Run(ctx, r.cmd, []string{r.key(key, start)},
+		delta, ttl.Milliseconds()).Err()
+	return errs.Backend(err)
+}
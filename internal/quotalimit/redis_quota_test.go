@@ -0,0 +1,206 @@
+package quotalimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/redismocks"
+)
+
+func TestRedisQuotaLimiter_Limit(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	now := time.Date(2023, 10, 31, 15, 0, 0, 0, time.UTC)
+	r := NewRedisQuotaLimiter(cli, 2, Monthly,
+		WithLocation(shanghai),
+		WithTimeFunc(func() time.Time { return now }),
+		WithKeyPrefix("quota_test"),
+	)
+	keys := []string{"quota_test:foo:quota:monthly:20231001", "quota_test:foo:quota:monthly:20231101"}
+	require.NoError(t, cli.Del(ctx, keys...).Err())
+	defer cli.Del(ctx, keys...)
+
+	for _, want := range []bool{false, false, true} {
+		got, err := r.Limit(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	usage, err := r.Usage(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), usage.Used)
+	assert.Equal(t, int64(0), usage.Remaining)
+	assert.True(t, time.Date(2023, 11, 1, 0, 0, 0, 0, shanghai).Equal(usage.ResetAt))
+
+	// 周期结束 1 分钟后 key 过期
+	ttl, err := cli.PTTL(ctx, keys[0]).Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour+time.Minute, ttl, float64(time.Second))
+
+	// UTC 16:00 是上海的 11 月 1 日, 进入新的周期
+	now = time.Date(2023, 10, 31, 16, 0, 0, 0, time.UTC)
+	usage, err = r.Usage(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{
+		Quota:     2,
+		Used:      0,
+		Remaining: 2,
+		ResetAt:   time.Date(2023, 12, 1, 0, 0, 0, 0, shanghai),
+	}, usage)
+	got, err := r.Limit(ctx, "foo")
+	require.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestRedisQuotaLimiter_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	o := &countObserver{}
+	r := NewRedisQuotaLimiter(cmd, 2, Daily, WithLocation(time.UTC),
+		WithTimeFunc(func() time.Time { return now }), WithObserver(o))
+
+	res := redis.NewCmd(context.Background())
+	res.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().EvalSha(gomock.Any(), quotaScript.Hash(), []string{"foo:quota:daily:20231001"},
+		int64(2), (24*time.Hour + time.Minute).Milliseconds()).Return(res)
+	got, err := r.Limit(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.False(t, got)
+	assert.Equal(t, &countObserver{errs: 1}, o)
+
+	getRes := redis.NewStringCmd(context.Background())
+	getRes.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().Get(gomock.Any(), "foo:quota:daily:20231001").Return(getRes)
+	_, err = r.Usage(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+}
+
+// 同一个限流对象的日、周、月配额在同一天开始时不会共用一个 key
+func TestRedisQuotaLimiter_Periods(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	// 2023-05-01 是周一, 同时是日、周、月的开始
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	keys := []string{
+		"period:quota:daily:20230501", "period:quota:weekly:20230501", "period:quota:monthly:20230501",
+	}
+	require.NoError(t, cli.Del(ctx, keys...).Err())
+	defer cli.Del(ctx, keys...)
+
+	for i, period := range []Period{Daily, Weekly, Monthly} {
+		r := NewRedisQuotaLimiter(cli, 1, period, WithLocation(time.UTC),
+			WithTimeFunc(func() time.Time { return now }))
+		got, err := r.Limit(ctx, "period")
+		require.NoError(t, err)
+		assert.False(t, got, period.String())
+		used, err := cli.Get(ctx, keys[i]).Int64()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), used, period.String())
+	}
+}
+
+func TestRedisQuotaLimiter_ServerTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	// 本地时间已经是第二天, 以 redis 服务器的时间为准
+	r := NewRedisQuotaLimiter(cmd, 2, Daily, WithLocation(time.UTC), WithServerTime(),
+		WithTimeFunc(func() time.Time { return time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC) }))
+
+	timeRes := redis.NewTimeCmd(context.Background())
+	timeRes.SetVal(time.Date(2023, 10, 1, 23, 0, 0, 0, time.UTC))
+	cmd.EXPECT().Time(gomock.Any()).Return(timeRes)
+	res := redis.NewCmd(context.Background())
+	res.SetVal([]any{int64(0), int64(1)})
+	cmd.EXPECT().EvalSha(gomock.Any(), quotaScript.Hash(), []string{"foo:quota:daily:20231001"},
+		int64(2), (time.Hour + time.Minute).Milliseconds()).Return(res)
+	got, err := r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	timeRes = redis.NewTimeCmd(context.Background())
+	timeRes.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().Time(gomock.Any()).Return(timeRes)
+	got, err = r.Limit(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.False(t, got)
+}
+
+func initRedis() redis.Cmdable {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:16379",
+	})
+	return redisClient
+}
+
+func TestRedisQuotaLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	now := time.Date(2023, 10, 1, 23, 0, 0, 0, time.UTC)
+	r := NewRedisQuotaLimiter(cli, 3, Daily,
+		WithLocation(time.UTC),
+		WithTimeFunc(func() time.Time { return now }),
+	)
+	key := "admin:quota:daily:20231001"
+	require.NoError(t, cli.Del(ctx, key).Err())
+	defer cli.Del(ctx, key)
+	for i := 0; i < 3; i++ {
+		_, err := r.Limit(ctx, "admin")
+		require.NoError(t, err)
+	}
+	tests := []struct {
+		name string
+		op   func() error
+		want limiter.State
+	}{
+		{
+			name: "inspect",
+			op:   func() error { return nil },
+			want: limiter.State{Limit: 3, Used: 3, Remaining: 0},
+		},
+		{
+			name: "grant",
+			op:   func() error { return r.Adjust(ctx, "admin", 2) },
+			want: limiter.State{Limit: 3, Used: 1, Remaining: 2},
+		},
+		{
+			name: "grant_beyond_used",
+			op:   func() error { return r.Adjust(ctx, "admin", 5) },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+		{
+			name: "deduct",
+			op:   func() error { return r.Adjust(ctx, "admin", -4) },
+			want: limiter.State{Limit: 3, Used: 4, Remaining: 0},
+		},
+		{
+			name: "reset",
+			op:   func() error { return r.Reset(ctx, "admin") },
+			want: limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.op())
+			got, err := r.Inspect(ctx, "admin")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	// 调整之后 key 依然在周期结束后过期
+	require.NoError(t, r.Adjust(ctx, "admin", -1))
+	ttl, err := cli.PTTL(ctx, key).Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour+time.Minute, ttl, float64(time.Second))
+}
@@ -0,0 +1,107 @@
+package rediskey
+
+import "strings"
+
+// 各限流算法在 redis 上 key 的后缀.
+// 同一个限流对象在不同算法中使用不同的 key, 避免数据类型冲突.
+// 滑动窗口、活跃请求数与租用额度只有设置 Builder.Suffix 时才加上后缀, 与之前的版本使用同一个 key
+const (
+	// SuffixSlideWindow 滑动窗口, ZSET
+	SuffixSlideWindow = "sw"
+	// SuffixActive 活跃请求数, STRING
+	SuffixActive = "active"
+	// SuffixLease 租用额度, HASH
+	SuffixLease = "lease"
+	// SuffixQuota 日历周期的配额, STRING. 之后还会加上周期的类型与开始日期
+	SuffixQuota = "quota"
+	// SuffixPenalty 违规次数与封禁, HASH
+	SuffixPenalty = "penalty"
+)
+
+// Builder 生成 redis 上的 key.
+// Prefix 可以作为命名空间, 使多个业务或多条限流规则共用同一个 redis.
+// 例如 Prefix 为 "limiter", HashTag 为 true 时,
+// 限流对象 "user:1" 的 key 为 "limiter:{user:1}", 加上后缀 "sw" 则为 "limiter:{user:1}:sw"
+type Builder struct {
+	// Prefix key 的前缀
+	Prefix string
+	// HashTag 是否用 {} 包裹限流对象.
+	// 在 redis cluster 中同一个限流对象的所有 key 都会落在同一个 slot, 可以在同一个脚本中操作
+	HashTag bool
+	// Suffix 是否在 key 后加上算法的后缀, 只影响 AlgoKey.
+	// 为 false 时与之前的版本相同, 多个算法使用同一个限流对象时 key 会冲突
+	Suffix bool
+}
+
+// Key 生成限流对象 key 在 redis 上的 key
+func (b Builder) Key(key string, suffixes ...string) string {
+	var sb strings.Builder
+	if b.Prefix != "" {
+		sb.WriteString(b.Prefix)
+		sb.WriteByte(':')
+	}
+	if b.HashTag {
+		sb.WriteByte('{')
+		sb.WriteString(key)
+		sb.WriteByte('}')
+	} else {
+		sb.WriteString(key)
+	}
+	for _, suffix := range suffixes {
+		sb.WriteByte(':')
+		sb.WriteString(suffix)
+	}
+	return sb.String()
+}
+
+// AlgoKey 生成限流算法使用的 key, Suffix 为 true 时加上算法的后缀 suffix, 否则与 Key(key) 相同
+func (b Builder) AlgoKey(key, suffix string) string {
+	if !b.Suffix {
+		return b.Key(key)
+	}
+	return b.Key(key, suffix)
+}
+
+// Tag 返回 redis cluster 计算 slot 时实际使用的部分.
+// 与 redis 的规则一致: 取第一个 '{' 与其后第一个 '}' 之间的非空内容, 否则为整个 key
+func Tag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// SameSlot 多个 key 在 redis cluster 中是否一定落在同一个 slot.
+// 多 key 的脚本只有在所有 key 落在同一个 slot 时才能在 redis cluster 中执行
+func SameSlot(keys ...string) bool {
+	for i := 1; i < len(keys); i++ {
+		if Tag(keys[i]) != Tag(keys[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SlotCount redis cluster 的 slot 数
+const SlotCount = 16384
+
+// Slot 返回 key 在 redis cluster 中的 slot, 即 CRC16(Tag(key)) mod 16384
+func Slot(key string) int {
+	var crc uint16
+	for _, c := range []byte(Tag(key)) {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc) % SlotCount
+}
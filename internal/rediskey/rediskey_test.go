@@ -0,0 +1,89 @@
+package rediskey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder_Key(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  Builder
+		key      string
+		suffixes []string
+		want     string
+	}{
+		{
+			name: "raw",
+			key:  "user:1",
+			want: "user:1",
+		},
+		{
+			name:    "prefix",
+			builder: Builder{Prefix: "limiter"},
+			key:     "user:1",
+			want:    "limiter:user:1",
+		},
+		{
+			name:    "hash_tag",
+			builder: Builder{Prefix: "limiter", HashTag: true},
+			key:     "user:1",
+			want:    "limiter:{user:1}",
+		},
+		{
+			name:     "suffixes",
+			builder:  Builder{Prefix: "limiter", HashTag: true},
+			key:      "user:1",
+			suffixes: []string{"sw", "1s"},
+			want:     "limiter:{user:1}:sw:1s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.builder.Key(tt.key, tt.suffixes...))
+		})
+	}
+}
+
+func TestBuilder_AlgoKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder Builder
+		want    string
+	}{
+		{
+			// 与之前的版本使用同一个 key
+			name:    "legacy",
+			builder: Builder{Prefix: "limiter"},
+			want:    "limiter:user:1",
+		},
+		{
+			name:    "suffix",
+			builder: Builder{Prefix: "limiter", Suffix: true},
+			want:    "limiter:user:1:sw",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.builder.AlgoKey("user:1", SuffixSlideWindow))
+		})
+	}
+}
+
+func TestSameSlot(t *testing.T) {
+	b := Builder{Prefix: "limiter", HashTag: true}
+	assert.True(t, SameSlot(b.Key("user:1", "sw"), b.Key("user:1", "active")))
+	assert.False(t, SameSlot(b.Key("user:1"), b.Key("user:2")))
+	assert.False(t, SameSlot("limiter:user:1:sw", "limiter:user:1:active"))
+	assert.Equal(t, "a{}b", Tag("a{}b"))
+	assert.Equal(t, "user", Tag("{user}:{1}"))
+}
+
+func TestSlot(t *testing.T) {
+	// 与 redis 的 CLUSTER KEYSLOT 一致
+	assert.Equal(t, 12182, Slot("foo"))
+	assert.Equal(t, 11058, Slot("somekey"))
+	assert.Equal(t, 5061, Slot("bar"))
+	assert.Equal(t, Slot("user:1"), Slot("limiter:{user:1}:sw"))
+}
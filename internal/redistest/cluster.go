@@ -0,0 +1,116 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter/internal/rediskey"
+)
+
+// ErrCrossSlot 命令的 key 不在同一个 slot, 与 redis cluster 返回的错误相同
+var ErrCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+
+// NewClusterClient 创建一个将所有 slot 路由到 addr 的 redis.ClusterClient, 用于可选的集成测试.
+// 与真实的 redis cluster 一样, 一个命令的 key 不在同一个 slot 时返回 ErrCrossSlot.
+// pipeline 中的命令分别检查, 与 redis.ClusterClient 按 slot 拆分 pipeline 的行为一致
+func NewClusterClient(addr string) *redis.ClusterClient {
+	c := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{{
+				Start: 0,
+				End:   rediskey.SlotCount - 1,
+				Nodes: []redis.ClusterNode{{Addr: addr}},
+			}}, nil
+		},
+	})
+	c.AddHook(crossSlotHook{})
+	return c
+}
+
+// LiveClusterClient 与 NewClusterClient 相同, addr 上的 redis 不可用时跳过测试, 测试结束时关闭
+func LiveClusterClient(t *testing.T, addr string) *redis.ClusterClient {
+	t.Helper()
+	c := NewClusterClient(addr)
+	if err := c.Ping(context.Background()).Err(); err != nil {
+		_ = c.Close()
+		t.Skipf("redis %s 不可用, 跳过集成测试: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+type crossSlotHook struct{}
+
+func (crossSlotHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (crossSlotHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := CheckSlot(cmd); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (crossSlotHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if err := CheckSlot(cmd); err != nil {
+				cmd.SetErr(err)
+				return err
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// CheckSlot cmd 的 key 不在同一个 slot 时返回 ErrCrossSlot
+func CheckSlot(cmd redis.Cmder) error {
+	if !rediskey.SameSlot(Keys(cmd)...) {
+		return ErrCrossSlot
+	}
+	return nil
+}
+
+// Keys 返回命令的 key, 只支持限流器会用到的多 key 命令, 其他命令只返回第一个参数
+func Keys(cmd redis.Cmder) []string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return nil
+	}
+	switch strings.ToLower(cmd.Name()) {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro":
+		if len(args) < 3 {
+			return nil
+		}
+		n, err := strconv.Atoi(fmt.Sprint(args[2]))
+		if err != nil || len(args) < 3+n {
+			return nil
+		}
+		return toStrings(args[3 : 3+n])
+	case "del", "unlink", "exists", "mget", "touch", "watch":
+		return toStrings(args[1:])
+	default:
+		return toStrings(args[1:2])
+	}
+}
+
+func toStrings(args []any) []string {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		res[i] = fmt.Sprint(arg)
+	}
+	return res
+}
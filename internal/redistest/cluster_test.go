@@ -0,0 +1,95 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSlot(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		cmd      redis.Cmder
+		wantKeys []string
+		wantErr  error
+	}{
+		{
+			name:     "single_key",
+			cmd:      redis.NewIntCmd(ctx, "incr", "a"),
+			wantKeys: []string{"a"},
+		},
+		{
+			name:     "del_cross_slot",
+			cmd:      redis.NewIntCmd(ctx, "del", "a", "b"),
+			wantKeys: []string{"a", "b"},
+			wantErr:  ErrCrossSlot,
+		},
+		{
+			name:     "del_hash_tag",
+			cmd:      redis.NewIntCmd(ctx, "del", "{t}:a", "{t}:b"),
+			wantKeys: []string{"{t}:a", "{t}:b"},
+		},
+		{
+			name:     "evalsha_cross_slot",
+			cmd:      redis.NewCmd(ctx, "evalsha", "sha", 2, "a", "b", 1, "c"),
+			wantKeys: []string{"a", "b"},
+			wantErr:  ErrCrossSlot,
+		},
+		{
+			name:     "eval_hash_tag",
+			cmd:      redis.NewCmd(ctx, "eval", "return 1", 2, "{t}:a", "{t}:b", "c"),
+			wantKeys: []string{"{t}:a", "{t}:b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantKeys, Keys(tt.cmd))
+			assert.ErrorIs(t, CheckSlot(tt.cmd), tt.wantErr)
+		})
+	}
+}
+
+func TestPipeliner(t *testing.T) {
+	ctx := context.Background()
+	mockErr := errors.New("mock redis error")
+	p := &Pipeliner{Reply: func(cmd redis.Cmder) {
+		if Keys(cmd)[0] == "b" {
+			cmd.SetErr(mockErr)
+		}
+	}}
+	cmds, err := p.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "a")
+		pipe.EvalSha(ctx, "sha", []string{"{t}:a", "{t}:b"}, 1)
+		pipe.ZRem(ctx, "b", "m")
+		return nil
+	})
+	assert.ErrorIs(t, err, mockErr)
+	require.Len(t, cmds, 3)
+	assert.Equal(t, []string{"{t}:a", "{t}:b"}, Keys(cmds[1]))
+	assert.Equal(t, []any{"zrem", "b", "m"}, cmds[2].Args())
+}
+
+// 可选的集成测试, localhost:16379 不可用时跳过
+func TestClusterClient(t *testing.T) {
+	ctx := context.Background()
+	c := LiveClusterClient(t, "localhost:16379")
+	defer c.Del(ctx, "{t}:a", "{t}:b", "a", "b")
+
+	assert.ErrorIs(t, c.Del(ctx, "a", "b").Err(), ErrCrossSlot)
+	require.NoError(t, c.Del(ctx, "{t}:a", "{t}:b").Err())
+	assert.ErrorIs(t, c.Eval(ctx, "return 1", []string{"a", "b"}).Err(), ErrCrossSlot)
+	require.NoError(t, c.Eval(ctx, "return 1", []string{"{t}:a", "{t}:b"}).Err())
+
+	// pipeline 中每个命令分别检查
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "a")
+		pipe.Incr(ctx, "b")
+		return nil
+	})
+	require.NoError(t, err)
+}
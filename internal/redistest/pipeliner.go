@@ -0,0 +1,69 @@
+package redistest
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Pipeliner 记录命令的 redis.Pipeliner, 配合 redismocks.MockCmdable 的 Pipelined 使用.
+// 只实现限流器在 pipeline 中用到的命令, 命令的参数与 go-redis 相同, 可以用 Keys 取出 key
+type Pipeliner struct {
+	redis.Pipeliner
+	// Reply 设置命令的结果, 为 nil 时命令没有结果
+	Reply func(cmd redis.Cmder)
+	// Cmds 按顺序记录的命令
+	Cmds []redis.Cmder
+}
+
+func (p *Pipeliner) EvalSha(ctx context.Context, sha1 string, keys []string, args ...any) *redis.Cmd {
+	cmdArgs := make([]any, 0, 3+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, "evalsha", sha1, len(keys))
+	for _, key := range keys {
+		cmdArgs = append(cmdArgs, key)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmd := redis.NewCmd(ctx, cmdArgs...)
+	p.process(cmd)
+	return cmd
+}
+
+func (p *Pipeliner) Incr(ctx context.Context, key string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "incr", key)
+	p.process(cmd)
+	return cmd
+}
+
+func (p *Pipeliner) Decr(ctx context.Context, key string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "decr", key)
+	p.process(cmd)
+	return cmd
+}
+
+func (p *Pipeliner) ZRem(ctx context.Context, key string, members ...any) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, append([]any{"zrem", key}, members...)...)
+	p.process(cmd)
+	return cmd
+}
+
+func (p *Pipeliner) process(cmd redis.Cmder) {
+	p.Cmds = append(p.Cmds, cmd)
+	if p.Reply != nil {
+		p.Reply(cmd)
+	}
+}
+
+// Pipelined 返回 redis.Cmdable 的 Pipelined 的实现, 在 p 上执行 fn, 用于 MockCmdable 的 DoAndReturn
+func (p *Pipeliner) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	start := len(p.Cmds)
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	cmds := p.Cmds[start:]
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return cmds, err
+		}
+	}
+	return cmds, nil
+}
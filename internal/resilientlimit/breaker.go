@@ -0,0 +1,81 @@
+package resilientlimit
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker 熔断器.
+// 连续失败 threshold 次后打开, 在 cooldown 内不再访问后端;
+// cooldown 过后放行一个探测请求, 成功则关闭, 失败则重新打开
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	timeFunc  func() time.Time
+
+	lock     sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+// allow 是否可以访问后端
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || b.timeFunc().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) success() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	b.failures = 0
+	b.open = false
+	b.probing = false
+	b.lock.Unlock()
+}
+
+func (b *breaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = b.timeFunc()
+	}
+	b.probing = false
+	b.lock.Unlock()
+}
+
+// abort 探测请求没有得到结果(例如调用方的 Context 结束), 不改变熔断器的状态,
+// 允许下一个请求重新探测
+func (b *breaker) abort() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	b.probing = false
+	b.lock.Unlock()
+}
+
+// isOpen 熔断器是否处于打开状态
+func (b *breaker) isOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.open
+}
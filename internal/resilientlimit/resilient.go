@@ -0,0 +1,297 @@
+package resilientlimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/udugong/limiter"
+)
+
+// Policy 后端不可用时的处理策略
+type Policy int
+
+const (
+	// FailOpen 放行
+	FailOpen Policy = iota
+	// FailClosed 限流
+	FailClosed
+	// FailLocal 降级到本地限流器
+	FailLocal
+)
+
+// config ResilientLimiter 与 ResilientActiveLimiter 共用的配置
+type config struct {
+	policy          Policy
+	fallback        limiter.Limiter
+	fallbackActive  limiter.ActiveLimiter
+	onError         func(ctx context.Context, key string, err error)
+	breakerFailures int
+	breakerCooldown time.Duration
+	timeFunc        func() time.Time
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		policy:          FailOpen,
+		onError:         func(ctx context.Context, key string, err error) {},
+		breakerFailures: 5,
+		breakerCooldown: time.Second,
+		timeFunc:        func() time.Time { return time.Now() },
+	}
+	for _, opt := range opts {
+		opt.apply(&c)
+	}
+	return c
+}
+
+func (c config) newBreaker() *breaker {
+	return &breaker{
+		threshold: c.breakerFailures,
+		cooldown:  c.breakerCooldown,
+		timeFunc:  c.timeFunc,
+	}
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (f optionFunc) apply(c *config) {
+	f(c)
+}
+
+// WithFailOpen 后端不可用时放行. 默认策略
+func WithFailOpen() Option {
+	return optionFunc(func(c *config) {
+		c.policy = FailOpen
+	})
+}
+
+// WithFailClosed 后端不可用时限流
+func WithFailClosed() Option {
+	return optionFunc(func(c *config) {
+		c.policy = FailClosed
+	})
+}
+
+// WithFallback 后端不可用时降级到 l.
+// 仅对 ResilientLimiter 生效
+func WithFallback(l limiter.Limiter) Option {
+	return optionFunc(func(c *config) {
+		c.policy = FailLocal
+		c.fallback = l
+	})
+}
+
+// WithActiveFallback 后端不可用时降级到 l.
+// 仅对 ResilientActiveLimiter 生效
+func WithActiveFallback(l limiter.ActiveLimiter) Option {
+	return optionFunc(func(c *config) {
+		c.policy = FailLocal
+		c.fallbackActive = l
+	})
+}
+
+// WithOnError 后端出错时的回调
+func WithOnError(fn func(ctx context.Context, key string, err error)) Option {
+	return optionFunc(func(c *config) {
+		c.onError = fn
+	})
+}
+
+// WithBreaker 设置熔断器.
+// 连续失败 failures 次后在 cooldown 内不再访问后端, 直接按策略处理.
+// failures <= 0 表示不熔断. 默认连续失败 5 次熔断 1s
+func WithBreaker(failures int, cooldown time.Duration) Option {
+	return optionFunc(func(c *config) {
+		c.breakerFailures = failures
+		c.breakerCooldown = cooldown
+	})
+}
+
+// WithTimeFunc 控制生成当前时间
+func WithTimeFunc(fn func() time.Time) Option {
+	return optionFunc(func(c *config) {
+		c.timeFunc = fn
+	})
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 相同
+func WithClock(c limiter.Clock) Option {
+	return WithTimeFunc(c.Now)
+}
+
+// isCallerErr 调用方自身的 context 出错不视为后端故障
+func isCallerErr(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && errors.Is(err, ctx.Err())
+}
+
+// ResilientLimiter 在后端(如 redis)不可用时按策略处理的限流器.
+// 没有实现 limiter.Admin, 管理时直接使用被包装的限流器, 此时后端出错不会按策略处理
+type ResilientLimiter struct {
+	l limiter.Limiter
+	config
+	breaker *breaker
+}
+
+// NewResilientLimiter 包装 l, 在 l 出错时按策略处理
+func NewResilientLimiter(l limiter.Limiter, opts ...Option) *ResilientLimiter {
+	c := newConfig(opts)
+	if c.policy == FailLocal && c.fallback == nil {
+		c.policy = FailOpen
+	}
+	return &ResilientLimiter{
+		l:       l,
+		config:  c,
+		breaker: c.newBreaker(),
+	}
+}
+
+// Limit 后端正常时返回后端的结果, 否则按策略处理且不返回后端的错误
+func (r *ResilientLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	if r.breaker.allow() {
+		limited, err := r.l.Limit(ctx, key)
+		if err == nil {
+			r.breaker.success()
+			return limited, nil
+		}
+		if isCallerErr(ctx, err) {
+			r.breaker.abort()
+			return limited, err
+		}
+		r.breaker.failure()
+		r.onError(ctx, key, err)
+	}
+	switch r.policy {
+	case FailClosed:
+		return true, nil
+	case FailLocal:
+		return r.fallback.Limit(ctx, key)
+	default:
+		return false, nil
+	}
+}
+
+// BreakerOpen 熔断器是否处于打开状态
+func (r *ResilientLimiter) BreakerOpen() bool {
+	return r.breaker.isOpen()
+}
+
+// ResilientActiveLimiter 在后端(如 redis)不可用时按策略处理的活跃请求数限流器.
+// 未经过后端的 Limit 会被记录下来, 对应的 Decr 不会访问后端.
+// 没有实现 limiter.Admin, 通过被包装的限流器 Reset 时不会清除这些记录
+type ResilientActiveLimiter struct {
+	l limiter.ActiveLimiter
+	config
+	breaker *breaker
+
+	lock sync.Mutex
+	// 未经过后端的活跃请求数
+	skipped map[string]int64
+	// 经过本地降级限流器的活跃请求数
+	local map[string]int64
+}
+
+// NewResilientActiveLimiter 包装 l, 在 l 出错时按策略处理
+func NewResilientActiveLimiter(l limiter.ActiveLimiter, opts ...Option) *ResilientActiveLimiter {
+	c := newConfig(opts)
+	if c.policy == FailLocal && c.fallbackActive == nil {
+		c.policy = FailOpen
+	}
+	return &ResilientActiveLimiter{
+		l:       l,
+		config:  c,
+		breaker: c.newBreaker(),
+		skipped: make(map[string]int64),
+		local:   make(map[string]int64),
+	}
+}
+
+// Limit 后端正常时返回后端的结果, 否则按策略处理且不返回后端的错误
+func (r *ResilientActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	if r.breaker.allow() {
+		limited, err := r.l.Limit(ctx, key)
+		if err == nil {
+			r.breaker.success()
+			return limited, nil
+		}
+		if isCallerErr(ctx, err) {
+			r.breaker.abort()
+			return limited, err
+		}
+		r.breaker.failure()
+		r.onError(ctx, key, err)
+	}
+	switch r.policy {
+	case FailClosed:
+		r.incr(r.skipped, key)
+		return true, nil
+	case FailLocal:
+		limited, err := r.fallbackActive.Limit(ctx, key)
+		if err != nil {
+			return limited, err
+		}
+		r.incr(r.local, key)
+		return limited, nil
+	default:
+		r.incr(r.skipped, key)
+		return false, nil
+	}
+}
+
+// Decr 活跃请求数减少1.
+// 优先抵扣未经过后端的活跃请求数
+func (r *ResilientActiveLimiter) Decr(ctx context.Context, key string) error {
+	if r.decr(r.skipped, key) {
+		return nil
+	}
+	if r.decr(r.local, key) {
+		return r.fallbackActive.Decr(ctx, key)
+	}
+	err := r.l.Decr(ctx, key)
+	if err != nil && !isCallerErr(ctx, err) {
+		r.onError(ctx, key, err)
+	}
+	return err
+}
+
+// BreakerOpen 熔断器是否处于打开状态
+func (r *ResilientActiveLimiter) BreakerOpen() bool {
+	return r.breaker.isOpen()
+}
+
+func (r *ResilientActiveLimiter) incr(m map[string]int64, key string) {
+	r.lock.Lock()
+	m[key]++
+	r.lock.Unlock()
+}
+
+func (r *ResilientActiveLimiter) decr(m map[string]int64, key string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if m[key] <= 0 {
+		return false
+	}
+	m[key]--
+	if m[key] == 0 {
+		delete(m, key)
+	}
+	return true
+}
+
+// ScaleLimit 按实例数等比例缩小阈值, 结果至少为 1.
+// 例如 redis 上的阈值为 3000, 共有 3 个实例, 则每个实例本地的阈值为 1000
+func ScaleLimit(limit int64, instances int) int64 {
+	if instances <= 1 {
+		return limit
+	}
+	scaled := (limit + int64(instances) - 1) / int64(instances)
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
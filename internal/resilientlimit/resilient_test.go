@@ -0,0 +1,237 @@
+package resilientlimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/activelimit"
+	"github.com/udugong/limiter/internal/keyedlimit"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+var errBackend = errors.New("mock redis error")
+
+func TestResilientLimiter_Limit(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) (limiter.Limiter, []Option)
+		ctx     context.Context
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "backend_ok",
+			mock: func(ctrl *gomock.Controller) (limiter.Limiter, []Option) {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+				return l, nil
+			},
+			ctx:  context.Background(),
+			want: true,
+		},
+		{
+			name: "fail_open",
+			mock: func(ctrl *gomock.Controller) (limiter.Limiter, []Option) {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend)
+				return l, []Option{WithFailOpen()}
+			},
+			ctx:  context.Background(),
+			want: false,
+		},
+		{
+			name: "fail_closed",
+			mock: func(ctrl *gomock.Controller) (limiter.Limiter, []Option) {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend)
+				return l, []Option{WithFailClosed()}
+			},
+			ctx:  context.Background(),
+			want: true,
+		},
+		{
+			name: "fallback",
+			mock: func(ctrl *gomock.Controller) (limiter.Limiter, []Option) {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend)
+				fallback := limitermocks.NewMockLimiter(ctrl)
+				fallback.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+				return l, []Option{WithFallback(fallback)}
+			},
+			ctx:  context.Background(),
+			want: true,
+		},
+		{
+			// 调用方的 context 出错时原样返回
+			name: "caller_context_error",
+			mock: func(ctrl *gomock.Controller) (limiter.Limiter, []Option) {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, context.Canceled)
+				return l, []Option{WithFailClosed()}
+			},
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			}(),
+			want:    false,
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			l, opts := tt.mock(ctrl)
+			r := NewResilientLimiter(l, opts...)
+			got, err := r.Limit(tt.ctx, "foo")
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResilientLimiter_Breaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	l := limitermocks.NewMockLimiter(ctrl)
+	var errCnt int
+	r := NewResilientLimiter(l,
+		WithFailClosed(),
+		WithBreaker(2, time.Second),
+		WithTimeFunc(func() time.Time { return now }),
+		WithOnError(func(ctx context.Context, key string, err error) {
+			errCnt++
+		}),
+	)
+
+	// 连续失败 2 次后熔断
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend).Times(2)
+	for i := 0; i < 2; i++ {
+		got, err := r.Limit(context.Background(), "foo")
+		assert.NoError(t, err)
+		assert.True(t, got)
+	}
+	assert.True(t, r.BreakerOpen())
+	assert.Equal(t, 2, errCnt)
+
+	// 熔断期间不访问后端
+	got, err := r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	// 探测失败, 重新熔断
+	now = now.Add(time.Second)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend)
+	got, err = r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.True(t, got)
+	assert.True(t, r.BreakerOpen())
+
+	// 探测成功, 自动恢复
+	now = now.Add(time.Second)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil).Times(2)
+	for i := 0; i < 2; i++ {
+		got, err = r.Limit(context.Background(), "foo")
+		assert.NoError(t, err)
+		assert.False(t, got)
+	}
+	assert.False(t, r.BreakerOpen())
+}
+
+func TestResilientLimiter_ProbeCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	l := limitermocks.NewMockLimiter(ctrl)
+	r := NewResilientLimiter(l,
+		WithFailClosed(),
+		WithBreaker(1, time.Second),
+		WithTimeFunc(func() time.Time { return now }),
+	)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend)
+	_, _ = r.Limit(context.Background(), "foo")
+	assert.True(t, r.BreakerOpen())
+
+	// 探测期间调用方的 Context 结束, 没有得到探测的结果
+	now = now.Add(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	l.EXPECT().Limit(gomock.Any(), "foo").DoAndReturn(func(ctx context.Context, key string) (bool, error) {
+		cancel()
+		return false, ctx.Err()
+	})
+	got, err := r.Limit(ctx, "foo")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, got)
+	assert.True(t, r.BreakerOpen())
+
+	// 下一个请求可以重新探测
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	got, err = r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+	assert.False(t, r.BreakerOpen())
+}
+
+func TestResilientActiveLimiter_Lifecycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockActiveLimiter(ctrl)
+	fallback := keyedlimit.NewKeyedActiveLimiter(func() limiter.ActiveLimiter {
+		return activelimit.NewLocalActiveLimiter(1)
+	})
+	r := NewResilientActiveLimiter(l, WithActiveFallback(fallback), WithBreaker(0, 0))
+
+	// 后端正常
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+	got, err := r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	// 后端不可用, 降级到本地
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend).Times(2)
+	got, err = r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+	got, err = r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	// 先抵扣本地的活跃请求数, 再访问后端
+	assert.NoError(t, r.Decr(context.Background(), "foo"))
+	assert.NoError(t, r.Decr(context.Background(), "foo"))
+	l.EXPECT().Decr(gomock.Any(), "foo").Return(nil)
+	assert.NoError(t, r.Decr(context.Background(), "foo"))
+}
+
+func TestResilientActiveLimiter_FailOpen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockActiveLimiter(ctrl)
+	r := NewResilientActiveLimiter(l)
+
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errBackend)
+	got, err := r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	// 未经过后端的请求不会访问后端
+	assert.NoError(t, r.Decr(context.Background(), "foo"))
+
+	l.EXPECT().Decr(gomock.Any(), "foo").Return(errBackend)
+	assert.Equal(t, errBackend, r.Decr(context.Background(), "foo"))
+}
+
+func TestScaleLimit(t *testing.T) {
+	assert.Equal(t, int64(1000), ScaleLimit(3000, 3))
+	assert.Equal(t, int64(4), ScaleLimit(10, 3))
+	assert.Equal(t, int64(1), ScaleLimit(1, 3))
+	assert.Equal(t, int64(10), ScaleLimit(10, 0))
+}
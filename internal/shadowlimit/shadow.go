@@ -0,0 +1,169 @@
+package shadowlimit
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"github.com/udugong/limiter"
+)
+
+// Stats 影子模式下的统计数据
+type Stats struct {
+	// Total 经过限流器判断的请求总数
+	Total int64
+	// Limited 本应被限流的请求数
+	Limited int64
+	// Errors 限流器本身出错的次数
+	Errors int64
+}
+
+// recorder 记录本应被限流的请求.
+// ShadowLimiter 与 ShadowActiveLimiter 共用
+type recorder struct {
+	onLimit func(ctx context.Context, key string)
+	onError func(ctx context.Context, key string, err error)
+	logFunc func(format string, args ...any)
+	// 每 sampleEvery 次本应限流的请求记录一次日志
+	sampleEvery int64
+
+	total   atomic.Int64
+	limited atomic.Int64
+	errors  atomic.Int64
+}
+
+func newRecorder(opts []Option) *recorder {
+	r := &recorder{
+		onLimit:     func(ctx context.Context, key string) {},
+		onError:     func(ctx context.Context, key string, err error) {},
+		logFunc:     log.Printf,
+		sampleEvery: 0,
+	}
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	return r
+}
+
+func (r *recorder) record(ctx context.Context, key string, limited bool, err error) {
+	r.total.Add(1)
+	if err != nil {
+		r.errors.Add(1)
+		r.onError(ctx, key, err)
+		return
+	}
+	if !limited {
+		return
+	}
+	cnt := r.limited.Add(1)
+	r.onLimit(ctx, key)
+	if r.sampleEvery > 0 && cnt%r.sampleEvery == 1%r.sampleEvery {
+		r.logFunc("shadowlimit: key %q 本应被限流, 累计 %d 次", key, cnt)
+	}
+}
+
+// Stats 返回当前的统计数据
+func (r *recorder) Stats() Stats {
+	return Stats{
+		Total:   r.total.Load(),
+		Limited: r.limited.Load(),
+		Errors:  r.errors.Load(),
+	}
+}
+
+type Option interface {
+	apply(*recorder)
+}
+
+type optionFunc func(*recorder)
+
+func (f optionFunc) apply(r *recorder) {
+	f(r)
+}
+
+// WithOnLimit 设置本应被限流时的回调
+func WithOnLimit(fn func(ctx context.Context, key string)) Option {
+	return optionFunc(func(r *recorder) {
+		r.onLimit = fn
+	})
+}
+
+// WithOnError 设置限流器本身出错时的回调
+func WithOnError(fn func(ctx context.Context, key string, err error)) Option {
+	return optionFunc(func(r *recorder) {
+		r.onError = fn
+	})
+}
+
+// WithSampledLog 每 every 次本应被限流的请求打印一次日志, every <= 0 表示不打印.
+// 默认使用 log.Printf
+func WithSampledLog(every int64) Option {
+	return optionFunc(func(r *recorder) {
+		r.sampleEvery = every
+	})
+}
+
+// WithLogFunc 设置打印日志的方法
+func WithLogFunc(fn func(format string, args ...any)) Option {
+	return optionFunc(func(r *recorder) {
+		r.logFunc = fn
+	})
+}
+
+// ShadowLimiter 影子模式限流器.
+// 永远放行, 但会记录被包装的限流器本应限流的请求.
+// 没有实现 limiter.Admin, 需要管理时直接使用被包装的限流器
+type ShadowLimiter struct {
+	l limiter.Limiter
+	*recorder
+}
+
+// NewShadowLimiter 包装一个 limiter.Limiter 为影子模式
+func NewShadowLimiter(l limiter.Limiter, opts ...Option) *ShadowLimiter {
+	return &ShadowLimiter{
+		l:        l,
+		recorder: newRecorder(opts),
+	}
+}
+
+// Limit 永远返回 false, nil.
+// 被包装的限流器出错时不会影响请求, 只会记录并回调
+func (s *ShadowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := s.l.Limit(ctx, key)
+	s.record(ctx, key, limited, err)
+	return false, nil
+}
+
+// ShadowActiveLimiter 影子模式活跃请求数限流器.
+// 永远放行, 但会记录被包装的限流器本应限流的请求.
+// 注意: 被包装的限流器依然会计数, 每次 Limit 之后仍需调用 Decr.
+// 没有实现 limiter.Admin, 需要管理时直接使用被包装的限流器
+type ShadowActiveLimiter struct {
+	l limiter.ActiveLimiter
+	*recorder
+}
+
+// NewShadowActiveLimiter 包装一个 limiter.ActiveLimiter 为影子模式
+func NewShadowActiveLimiter(l limiter.ActiveLimiter, opts ...Option) *ShadowActiveLimiter {
+	return &ShadowActiveLimiter{
+		l:        l,
+		recorder: newRecorder(opts),
+	}
+}
+
+// Limit 永远返回 false, nil
+func (s *ShadowActiveLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := s.l.Limit(ctx, key)
+	s.record(ctx, key, limited, err)
+	return false, nil
+}
+
+// Decr 活跃请求数减少1.
+// 出错时只会记录并回调, 永远返回 nil
+func (s *ShadowActiveLimiter) Decr(ctx context.Context, key string) error {
+	if err := s.l.Decr(ctx, key); err != nil {
+		s.errors.Add(1)
+		s.onError(ctx, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package shadowlimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/limitermocks"
+)
+
+func TestShadowLimiter_Limit(t *testing.T) {
+	tests := []struct {
+		name      string
+		mock      func(ctrl *gomock.Controller) limiter.Limiter
+		wantStats Stats
+		wantLimit []string
+		wantErr   []error
+	}{
+		{
+			name: "normal",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, nil)
+				return l
+			},
+			wantStats: Stats{Total: 1},
+		},
+		{
+			name: "would_be_limited",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+				return l
+			},
+			wantStats: Stats{Total: 1, Limited: 1},
+			wantLimit: []string{"foo"},
+		},
+		{
+			name: "limiter_error",
+			mock: func(ctrl *gomock.Controller) limiter.Limiter {
+				l := limitermocks.NewMockLimiter(ctrl)
+				l.EXPECT().Limit(gomock.Any(), "foo").Return(false, errors.New("mock error"))
+				return l
+			},
+			wantStats: Stats{Total: 1, Errors: 1},
+			wantErr:   []error{errors.New("mock error")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			var gotLimit []string
+			var gotErr []error
+			s := NewShadowLimiter(tt.mock(ctrl),
+				WithOnLimit(func(ctx context.Context, key string) {
+					gotLimit = append(gotLimit, key)
+				}),
+				WithOnError(func(ctx context.Context, key string, err error) {
+					gotErr = append(gotErr, err)
+				}),
+			)
+			got, err := s.Limit(context.Background(), "foo")
+			assert.NoError(t, err)
+			assert.False(t, got)
+			assert.Equal(t, tt.wantStats, s.Stats())
+			assert.Equal(t, tt.wantLimit, gotLimit)
+			assert.Equal(t, tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestShadowLimiter_SampledLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil).Times(5)
+	var logs []string
+	s := NewShadowLimiter(l,
+		WithSampledLog(2),
+		WithLogFunc(func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		}),
+	)
+	for i := 0; i < 5; i++ {
+		got, err := s.Limit(context.Background(), "foo")
+		assert.NoError(t, err)
+		assert.False(t, got)
+	}
+	assert.Len(t, logs, 3)
+	assert.Equal(t, Stats{Total: 5, Limited: 5}, s.Stats())
+}
+
+func TestShadowActiveLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := limitermocks.NewMockActiveLimiter(ctrl)
+	l.EXPECT().Limit(gomock.Any(), "foo").Return(true, nil)
+	l.EXPECT().Decr(gomock.Any(), "foo").Return(errors.New("mock error"))
+	var gotErr error
+	s := NewShadowActiveLimiter(l, WithOnError(func(ctx context.Context, key string, err error) {
+		gotErr = err
+	}))
+	got, err := s.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.False(t, got)
+	assert.NoError(t, s.Decr(context.Background(), "foo"))
+	assert.Equal(t, errors.New("mock error"), gotErr)
+	assert.Equal(t, Stats{Total: 1, Limited: 1, Errors: 1}, s.Stats())
+}
@@ -5,6 +5,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
 	"github.com/udugong/limiter/internal/queue"
 )
 
@@ -16,6 +19,7 @@ type LocalSlideWindowLimiter struct {
 	Queue    queue.BoundedQueue
 	lock     sync.Mutex
 	timeFunc func() time.Time
+	observer limiter.Observer
 }
 
 // NewLocalSlideWindowLimiter 本地的滑动窗口算法限流器实现
@@ -48,14 +52,94 @@ func WithTimeFunc(fn func() time.Time) Option {
 	})
 }
 
-func (l *LocalSlideWindowLimiter) Limit(_ context.Context, _ string) (bool, error) {
+// CommonOption 同时适用于 LocalSlideWindowLimiter 与 RedisSlidingWindowLimiter
+type CommonOption interface {
+	Option
+	RedisOption
+}
+
+type observerOption struct {
+	observer limiter.Observer
+}
+
+func (o observerOption) apply(l *LocalSlideWindowLimiter) {
+	l.observer = o.observer
+}
+
+func (o observerOption) applyRedis(r *RedisSlidingWindowLimiter) {
+	r.Observer = o.observer
+}
+
+// WithObserver 设置观察限流判断结果的 Observer
+func WithObserver(o limiter.Observer) CommonOption {
+	return observerOption{observer: o}
+}
+
+type clockOption struct {
+	clock limiter.Clock
+}
+
+func (o clockOption) apply(l *LocalSlideWindowLimiter) {
+	l.timeFunc = o.clock.Now
+}
+
+func (o clockOption) applyRedis(r *RedisSlidingWindowLimiter) {
+	r.TimeFunc = o.clock.Now
+}
+
+// WithClock 使用 c 生成当前时间, 与 WithTimeFunc(c.Now) 或 WithRedisTimeFunc(c.Now) 相同.
+// RedisSlidingWindowLimiter 使用 redis 服务器的时间时不生效
+func WithClock(c limiter.Clock) CommonOption {
+	return clockOption{clock: c}
+}
+
+func (l *LocalSlideWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, _ := l.limit()
+	observer.Notify(ctx, l.observer, key, limited, nil)
+	return limited, nil
+}
+
+// limit 没有被限流时返回计入的请求的时间
+func (l *LocalSlideWindowLimiter) limit() (bool, time.Time) {
 	l.lock.Lock()
+	defer l.lock.Unlock()
 	now := l.timeFunc()
 	if !l.Queue.IsFull() {
 		_ = l.Queue.Enqueue(now)
-		l.lock.Unlock()
-		return false, nil
+		return false, now
+	}
+	l.evict(now)
+	if !l.Queue.IsFull() {
+		_ = l.Queue.Enqueue(now)
+		return false, now
+	}
+	return true, time.Time{}
+}
+
+// Reserve 与 Limit 相同, 没有被限流时返回撤销这一次 Limit 的 cancel. Queue 需要实现 queue.Remover.
+// cancel 移除这一次计入的请求, 请求已经在窗口之外时什么也不做
+func (l *LocalSlideWindowLimiter) Reserve(ctx context.Context, key string) (bool, func(ctx context.Context) error, error) {
+	q, ok := l.Queue.(queue.Remover)
+	if !ok {
+		err := errs.InvalidConfig("队列不支持撤销指定的请求")
+		observer.Notify(ctx, l.observer, key, false, err)
+		return false, nil, err
 	}
+	limited, at := l.limit()
+	observer.Notify(ctx, l.observer, key, limited, nil)
+	if limited {
+		return true, nil, nil
+	}
+	return false, func(context.Context) error {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		q.Remove(at)
+		return nil
+	}, nil
+}
+
+// evict 移除窗口之外的请求. 调用方需要持有锁
+func (l *LocalSlideWindowLimiter) evict(now time.Time) {
 	windowStart := now.Add(-l.Window)
 	for {
 		first, err := l.Queue.Peek()
@@ -68,11 +152,75 @@ func (l *LocalSlideWindowLimiter) Limit(_ context.Context, _ string) (bool, erro
 			break
 		}
 	}
-	if !l.Queue.IsFull() {
-		_ = l.Queue.Enqueue(now)
-		l.lock.Unlock()
-		return false, nil
+}
+
+// Inspect 查询窗口内的请求数. 本地限流器不区分限流对象, Queue 需要实现 queue.Sizer
+func (l *LocalSlideWindowLimiter) Inspect(_ context.Context, _ string) (limiter.State, error) {
+	s, ok := l.Queue.(queue.Sizer)
+	if !ok {
+		return limiter.State{}, errs.InvalidConfig("队列不支持查询长度")
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.evict(l.timeFunc())
+	return limiter.NewState(int64(s.Cap()), int64(s.Len())), nil
+}
+
+// Reset 清空窗口内的请求
+func (l *LocalSlideWindowLimiter) Reset(_ context.Context, _ string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for {
+		if _, err := l.Queue.Dequeue(); err != nil {
+			return nil
+		}
+	}
+}
+
+// Adjust delta 为正时移除窗口内最近的 delta 个请求, Queue 需要实现 queue.TailRemover;
+// 为负时在当前时间加入 -delta 个请求, 最多加满队列
+func (l *LocalSlideWindowLimiter) Adjust(_ context.Context, _ string, delta int64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if delta > 0 {
+		q, ok := l.Queue.(queue.TailRemover)
+		if !ok {
+			return errs.InvalidConfig("队列不支持撤销")
+		}
+		for i := int64(0); i < delta; i++ {
+			if _, err := q.RemoveTail(); err != nil {
+				break
+			}
+		}
+		return nil
+	}
+	now := l.timeFunc()
+	for i := int64(0); i < -delta; i++ {
+		if err := l.Queue.Enqueue(now); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Revert 撤销最近一次没有被限流的 Limit. Queue 需要实现 queue.TailRemover.
+// 并发时队尾可能是其他请求计入的, 需要撤销指定的一次 Limit 时使用 Reserve
+func (l *LocalSlideWindowLimiter) Revert(_ context.Context, _ string) error {
+	q, ok := l.Queue.(queue.TailRemover)
+	if !ok {
+		return errs.InvalidConfig("队列不支持撤销")
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err := q.RemoveTail()
+	return err
+}
+
+// LimitMany 依次判断多个限流对象. 本地限流器不区分限流对象
+func (l *LocalSlideWindowLimiter) LimitMany(ctx context.Context, keys []string) ([]bool, error) {
+	res := make([]bool, len(keys))
+	for i, key := range keys {
+		res[i], _ = l.Limit(ctx, key)
 	}
-	l.lock.Unlock()
-	return true, nil
+	return res, nil
 }
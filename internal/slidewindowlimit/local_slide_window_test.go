@@ -7,8 +7,11 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/fakeclock"
 	"github.com/udugong/limiter/internal/mocks/queuemocks"
 	"github.com/udugong/limiter/internal/queue"
 )
@@ -96,3 +99,112 @@ func TestLocalSlideWindowLimiter_Limit(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalSlideWindowLimiter_LimitMany(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	l := NewLocalSlideWindowLimiter(10*time.Second, queue.NewArrayBoundedQueue(2),
+		WithTimeFunc(func() time.Time {
+			return now
+		}),
+	)
+	got, err := l.LimitMany(context.Background(), []string{"ip", "user", "tenant"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+}
+
+// cancel 只撤销这一次计入的请求, 不影响之后其他请求计入的请求
+func TestLocalSlideWindowLimiter_Reserve(t *testing.T) {
+	ctx := context.Background()
+	start := time.UnixMilli(1695571200000)
+	clk := fakeclock.New(start)
+	l := NewLocalSlideWindowLimiter(10*time.Second, queue.NewArrayBoundedQueue(2), WithClock(clk))
+	limited, cancel, err := l.Reserve(ctx, "")
+	require.NoError(t, err)
+	require.False(t, limited)
+	clk.Advance(time.Second)
+	limited, err = l.Limit(ctx, "")
+	require.NoError(t, err)
+	require.False(t, limited)
+	limited, rejected, err := l.Reserve(ctx, "")
+	require.NoError(t, err)
+	assert.True(t, limited)
+	assert.Nil(t, rejected)
+
+	require.NoError(t, cancel(ctx))
+	got, err := l.Queue.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Second), got)
+	// 撤销之后空出一个额度
+	limited, err = l.Limit(ctx, "")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+}
+
+func TestLocalSlideWindowLimiter_ReserveUnsupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	l := NewLocalSlideWindowLimiter(time.Second, queuemocks.NewMockBoundedQueue(ctrl))
+	limited, cancel, err := l.Reserve(context.Background(), "")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	assert.False(t, limited)
+	assert.Nil(t, cancel)
+}
+
+func TestLocalSlideWindowLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	clk := fakeclock.New(time.UnixMilli(1695571200000))
+	l := NewLocalSlideWindowLimiter(10*time.Second, queue.NewArrayBoundedQueue(3), WithClock(clk))
+	for i := 0; i < 3; i++ {
+		_, err := l.Limit(ctx, "")
+		require.NoError(t, err)
+	}
+	tests := []struct {
+		name  string
+		delta int64
+		want  limiter.State
+	}{
+		{
+			name:  "grant",
+			delta: 2,
+			want:  limiter.State{Limit: 3, Used: 1, Remaining: 2},
+		},
+		{
+			name:  "deduct",
+			delta: -1,
+			want:  limiter.State{Limit: 3, Used: 2, Remaining: 1},
+		},
+		{
+			// 最多扣除到窗口已满
+			name:  "deduct_beyond_capacity",
+			delta: -5,
+			want:  limiter.State{Limit: 3, Used: 3, Remaining: 0},
+		},
+		{
+			name:  "grant_beyond_used",
+			delta: 5,
+			want:  limiter.State{Limit: 3, Used: 0, Remaining: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, l.Adjust(ctx, "", tt.delta))
+			got, err := l.Inspect(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	t.Run("reset", func(t *testing.T) {
+		require.NoError(t, l.Adjust(ctx, "", -3))
+		require.NoError(t, l.Reset(ctx, ""))
+		got, err := l.Inspect(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, limiter.State{Limit: 3, Used: 0, Remaining: 3}, got)
+	})
+	t.Run("expired", func(t *testing.T) {
+		require.NoError(t, l.Adjust(ctx, "", -2))
+		clk.Advance(10*time.Second + time.Millisecond)
+		got, err := l.Inspect(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, limiter.State{Limit: 3, Used: 0, Remaining: 3}, got)
+	})
+}
@@ -2,15 +2,48 @@ package slidewindowlimit
 
 import (
 	"context"
+	"crypto/rand"
 	_ "embed"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/ctxutil"
+	"github.com/udugong/limiter/internal/errs"
+	"github.com/udugong/limiter/internal/observer"
+	"github.com/udugong/limiter/internal/rediskey"
 )
 
 //go:embed slide_window.lua
 var luaSlideWindow string
 
+// slideWindowScript 优先使用 EVALSHA 执行, 脚本不存在时退回 EVAL
+var slideWindowScript = redis.NewScript(luaSlideWindow)
+
+var (
+	// instanceID 区分不同实例的随机前缀
+	instanceID = newInstanceID()
+	// memberSeq 实例内递增的序号
+	memberSeq atomic.Uint64
+)
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NextMemberID 生成全局唯一的 ZSET 成员后缀
+func NextMemberID() string {
+	return instanceID + "-" + strconv.FormatUint(memberSeq.Add(1), 10)
+}
+
 // RedisSlidingWindowLimiter Redis 上的滑动窗口算法限流器实现
 type RedisSlidingWindowLimiter struct {
 	Cmd redis.Cmdable
@@ -20,9 +53,299 @@ type RedisSlidingWindowLimiter struct {
 	// 阈值
 	Rate int
 	// Interval 内允许 Rate 个请求
+
+	// ServerTime 使用 redis 服务器的时间, 避免各实例之间的时钟偏差
+	ServerTime bool
+	// TimeFunc 不使用 redis 服务器的时间时, 控制生成当前时间. 为 nil 时使用 time.Now
+	TimeFunc func() time.Time
+
+	// Keys 生成 redis 上的 key
+	Keys rediskey.Builder
+
+	// Observer 观察限流判断的结果, 为 nil 时不观察
+	Observer limiter.Observer
+
+	// rateLock 保护运行时通过 SetLimit 修改 Rate
+	rateLock sync.RWMutex
+}
+
+type RedisOption interface {
+	applyRedis(*RedisSlidingWindowLimiter)
+}
+
+type redisOptionFunc func(*RedisSlidingWindowLimiter)
+
+func (f redisOptionFunc) applyRedis(limiter *RedisSlidingWindowLimiter) {
+	f(limiter)
+}
+
+// NewRedisSlidingWindowLimiter Redis 上的滑动窗口算法限流器实现
+func NewRedisSlidingWindowLimiter(cmd redis.Cmdable, interval time.Duration, rate int,
+	opts ...RedisOption) *RedisSlidingWindowLimiter {
+	r := &RedisSlidingWindowLimiter{
+		Cmd:      cmd,
+		Interval: interval,
+		Rate:     rate,
+	}
+	for _, opt := range opts {
+		opt.applyRedis(r)
+	}
+	return r
+}
+
+// WithServerTime 使用 redis 服务器的时间
+func WithServerTime() RedisOption {
+	return redisOptionFunc(func(limiter *RedisSlidingWindowLimiter) {
+		limiter.ServerTime = true
+	})
+}
+
+// WithRedisTimeFunc 控制生成当前时间
+func WithRedisTimeFunc(fn func() time.Time) RedisOption {
+	return redisOptionFunc(func(limiter *RedisSlidingWindowLimiter) {
+		limiter.TimeFunc = fn
+	})
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀
+func WithKeyPrefix(prefix string) RedisOption {
+	return redisOptionFunc(func(limiter *RedisSlidingWindowLimiter) {
+		limiter.Keys.Prefix = prefix
+	})
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster
+func WithHashTag() RedisOption {
+	return redisOptionFunc(func(limiter *RedisSlidingWindowLimiter) {
+		limiter.Keys.HashTag = true
+	})
+}
+
+// WithKeySuffix 在 redis 上的 key 后加上算法的后缀 "sw", 多个算法共用 redis 时避免 key 冲突.
+// 不设置时与之前的版本使用同一个 key, 开启后之前的计数不再生效
+func WithKeySuffix() RedisOption {
+	return redisOptionFunc(func(limiter *RedisSlidingWindowLimiter) {
+		limiter.Keys.Suffix = true
+	})
 }
 
 func (r *RedisSlidingWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
-	return r.Cmd.Eval(ctx, luaSlideWindow, []string{key},
-		r.Interval.Milliseconds(), r.Rate, time.Now().UnixMilli()).Bool()
+	limited, err := r.limit(ctx, key)
+	observer.Notify(ctx, r.Observer, key, limited, err)
+	return limited, err
+}
+
+func (r *RedisSlidingWindowLimiter) limit(ctx context.Context, key string) (bool, error) {
+	if err := r.validate(); err != nil {
+		return false, err
+	}
+	limited, err := slideWindowScript.Run(ctx, r.Cmd, []string{r.Keys.AlgoKey(key, rediskey.SuffixSlideWindow)},
+		r.Interval.Milliseconds(), r.Threshold(), r.now(), NextMemberID()).Bool()
+	return limited, errs.Backend(err)
+}
+
+// validate 窗口小于 1ms 时脚本无法正确计数
+func (r *RedisSlidingWindowLimiter) validate() error {
+	if r.Interval.Milliseconds() <= 0 {
+		return errs.InvalidConfig("Interval 至少为 1ms, 实际为 %s", r.Interval)
+	}
+	return nil
+}
+
+// LimitMany 在一次往返中判断多个限流对象. 使用 redis 服务器的时间时先查询一次时间,
+// 部分限流对象失败时才能撤销其他限流对象已经计入的请求
+func (r *RedisSlidingWindowLimiter) LimitMany(ctx context.Context, keys []string) ([]bool, error) {
+	res := make([]bool, len(keys))
+	if len(keys) == 0 {
+		return res, nil
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	now, err := r.nowMilli(ctx)
+	if err != nil {
+		for _, key := range keys {
+			observer.Notify(ctx, r.Observer, key, false, err)
+		}
+		return nil, err
+	}
+	ids := make([]string, len(keys))
+	for i := range ids {
+		ids[i] = NextMemberID()
+	}
+	cmds := r.limitMany(ctx, keys, ids, now)
+	// 脚本不存在时加载脚本, 只重试这部分限流对象
+	var retryKeys, retryIDs []string
+	var retryIdx []int
+	for i, cmd := range cmds {
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			retryKeys = append(retryKeys, keys[i])
+			retryIDs = append(retryIDs, ids[i])
+			retryIdx = append(retryIdx, i)
+		}
+	}
+	if len(retryKeys) > 0 {
+		if err = r.Preload(ctx); err == nil {
+			for i, cmd := range r.limitMany(ctx, retryKeys, retryIDs, now) {
+				cmds[retryIdx[i]] = cmd
+			}
+		}
+	}
+	if err == nil {
+		for i, cmd := range cmds {
+			res[i], err = cmd.Bool()
+			if err = errs.Backend(err); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if rerr := r.rollback(ctx, keys, ids, now, cmds); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+		for _, key := range keys {
+			observer.Notify(ctx, r.Observer, key, false, err)
+		}
+		return nil, err
+	}
+	for i, key := range keys {
+		observer.Notify(ctx, r.Observer, key, res[i], nil)
+	}
+	return res, nil
+}
+
+func (r *RedisSlidingWindowLimiter) limitMany(ctx context.Context, keys, ids []string, now int64) []*redis.Cmd {
+	cmds := make([]*redis.Cmd, len(keys))
+	rate := r.Threshold()
+	_, _ = r.Cmd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = slideWindowScript.EvalSha(ctx, pipe, []string{r.Keys.AlgoKey(key, rediskey.SuffixSlideWindow)},
+				r.Interval.Milliseconds(), rate, now, ids[i])
+		}
+		return nil
+	})
+	return cmds
+}
+
+// rollback 删除脚本已经计入的请求, keys、ids 与 cmds 一一对应.
+// 调用方的 ctx 可能已经结束, 使用不会结束的 ctx
+func (r *RedisSlidingWindowLimiter) rollback(ctx context.Context, keys, ids []string, now int64,
+	cmds []*redis.Cmd) error {
+	type added struct {
+		key, member string
+	}
+	var members []added
+	for i, cmd := range cmds {
+		if limited, err := cmd.Bool(); err == nil && !limited {
+			members = append(members, added{
+				key:    r.Keys.AlgoKey(keys[i], rediskey.SuffixSlideWindow),
+				member: strconv.FormatInt(now, 10) + ":" + ids[i],
+			})
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	ctx = ctxutil.WithoutCancel(ctx)
+	_, err := r.Cmd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, m := range members {
+			pipe.ZRem(ctx, m.key, m.member)
+		}
+		return nil
+	})
+	return errs.Backend(err)
+}
+
+// Inspect 查询窗口内的请求数
+func (r *RedisSlidingWindowLimiter) Inspect(ctx context.Context, key string) (limiter.State, error) {
+	now, err := r.nowMilli(ctx)
+	if err != nil {
+		return limiter.State{}, err
+	}
+	// 与脚本一致, 分数等于窗口起始时间的请求已经在窗口之外
+	start := "(" + strconv.FormatInt(now-r.Interval.Milliseconds(), 10)
+	cnt, err := r.Cmd.ZCount(ctx, r.Keys.AlgoKey(key, rediskey.SuffixSlideWindow), start, "+inf").Result()
+	if err != nil {
+		return limiter.State{}, errs.Backend(err)
+	}
+	return limiter.NewState(int64(r.Threshold()), cnt), nil
+}
+
+// Reset 清空窗口内的请求
+func (r *RedisSlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	return errs.Backend(r.Cmd.Del(ctx, r.Keys.AlgoKey(key, rediskey.SuffixSlideWindow)).Err())
+}
+
+// Adjust delta 为正时移除窗口内最近的 delta 个请求, 为负时在当前时间加入 -delta 个请求
+func (r *RedisSlidingWindowLimiter) Adjust(ctx context.Context, key string, delta int64) error {
+	k := r.Keys.AlgoKey(key, rediskey.SuffixSlideWindow)
+	if delta > 0 {
+		return errs.Backend(r.Cmd.ZPopMax(ctx, k, delta).Err())
+	}
+	if delta == 0 {
+		return nil
+	}
+	now, err := r.nowMilli(ctx)
+	if err != nil {
+		return err
+	}
+	members := make([]redis.Z, 0, -delta)
+	for i := int64(0); i < -delta; i++ {
+		members = append(members, redis.Z{
+			Score:  float64(now),
+			Member: strconv.FormatInt(now, 10) + ":" + NextMemberID(),
+		})
+	}
+	_, err = r.Cmd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, k, members...)
+		pipe.PExpire(ctx, k, r.Interval)
+		return nil
+	})
+	return errs.Backend(err)
+}
+
+// nowMilli 返回当前时间的毫秒数, 使用 redis 服务器的时间时查询 redis
+func (r *RedisSlidingWindowLimiter) nowMilli(ctx context.Context) (int64, error) {
+	if !r.ServerTime {
+		return r.now(), nil
+	}
+	t, err := r.Cmd.Time(ctx).Result()
+	if err != nil {
+		return 0, errs.Backend(err)
+	}
+	return t.UnixMilli(), nil
+}
+
+// Threshold 返回当前的阈值 Rate
+func (r *RedisSlidingWindowLimiter) Threshold() int {
+	r.rateLock.RLock()
+	defer r.rateLock.RUnlock()
+	return r.Rate
+}
+
+// SetLimit 修改阈值 Rate, 只对当前实例生效. 运行时不要直接修改 Rate
+func (r *RedisSlidingWindowLimiter) SetLimit(rate int64) error {
+	if rate < 0 {
+		return errs.InvalidConfig("rate 不能小于0, 实际为 %d", rate)
+	}
+	r.rateLock.Lock()
+	defer r.rateLock.Unlock()
+	r.Rate = int(rate)
+	return nil
+}
+
+// Preload 预先加载脚本到 redis, 可用于启动时的健康检查
+func (r *RedisSlidingWindowLimiter) Preload(ctx context.Context) error {
+	return errs.Backend(slideWindowScript.Load(ctx, r.Cmd).Err())
+}
+
+// now 返回传给脚本的当前时间, -1 表示由脚本使用 redis 服务器的时间
+func (r *RedisSlidingWindowLimiter) now() int64 {
+	if r.ServerTime {
+		return -1
+	}
+	if r.TimeFunc != nil {
+		return r.TimeFunc().UnixMilli()
+	}
+	return time.Now().UnixMilli()
 }
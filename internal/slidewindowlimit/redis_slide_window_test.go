@@ -2,11 +2,22 @@ package slidewindowlimit
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/mocks/redismocks"
+	"github.com/udugong/limiter/internal/rediskey"
+	"github.com/udugong/limiter/internal/redistest"
 )
 
 func TestRedisSlidingWindowLimiter_Limit(t *testing.T) {
@@ -15,6 +26,8 @@ func TestRedisSlidingWindowLimiter_Limit(t *testing.T) {
 		Interval: 500 * time.Millisecond,
 		Rate:     1,
 	}
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
 	tests := []struct {
 		name     string
 		ctx      context.Context
@@ -53,20 +66,424 @@ func TestRedisSlidingWindowLimiter_Limit(t *testing.T) {
 			interval: 510 * time.Millisecond,
 			want:     false,
 		},
+		{
+			// 调用方的 context 出错不视为 redis 出错
+			name:    "context_canceled",
+			ctx:     canceledCtx,
+			key:     "foo",
+			want:    false,
+			wantErr: context.Canceled,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			<-time.After(tt.interval)
 			got, err := r.Limit(tt.ctx, tt.key)
-			assert.Equal(t, tt.wantErr, err)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				assert.NotErrorIs(t, err, limiter.ErrBackendUnavailable)
+			}
 			assert.Equal(t, tt.want, got)
 		})
 	}
 }
 
+func TestRedisSlidingWindowLimiter_InvalidConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// 配置不合法时不会访问 redis
+	r := NewRedisSlidingWindowLimiter(redismocks.NewMockCmdable(ctrl), time.Microsecond, 1)
+	got, err := r.Limit(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	assert.False(t, got)
+	res, err := r.LimitMany(context.Background(), []string{"foo"})
+	assert.ErrorIs(t, err, limiter.ErrInvalidConfig)
+	assert.Nil(t, res)
+}
+
+func TestRedisSlidingWindowLimiter_Now(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	tests := []struct {
+		name    string
+		opts    []RedisOption
+		wantNow int64
+	}{
+		{
+			name:    "client_time",
+			opts:    []RedisOption{WithRedisTimeFunc(func() time.Time { return now })},
+			wantNow: 1695571200000,
+		},
+		{
+			name:    "server_time",
+			opts:    []RedisOption{WithServerTime()},
+			wantNow: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal("false")
+			cmd.EXPECT().EvalSha(gomock.Any(), slideWindowScript.Hash(), []string{"foo"},
+				int64(500), 1, tt.wantNow, gomock.Any()).Return(res)
+			r := NewRedisSlidingWindowLimiter(cmd, 500*time.Millisecond, 1, tt.opts...)
+			got, err := r.Limit(context.Background(), "foo")
+			assert.NoError(t, err)
+			assert.False(t, got)
+		})
+	}
+}
+
+func TestRedisSlidingWindowLimiter_Key(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []RedisOption
+		wantKey string
+	}{
+		{
+			name:    "raw",
+			wantKey: "foo",
+		},
+		{
+			name:    "prefix",
+			opts:    []RedisOption{WithKeyPrefix("limiter")},
+			wantKey: "limiter:foo",
+		},
+		{
+			// redis cluster
+			name:    "hash_tag",
+			opts:    []RedisOption{WithKeyPrefix("limiter"), WithHashTag()},
+			wantKey: "limiter:{foo}",
+		},
+		{
+			name:    "suffix",
+			opts:    []RedisOption{WithKeySuffix()},
+			wantKey: "foo:sw",
+		},
+		{
+			name:    "prefix_hash_tag_suffix",
+			opts:    []RedisOption{WithKeyPrefix("limiter"), WithHashTag(), WithKeySuffix()},
+			wantKey: "limiter:{foo}:sw",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal("false")
+			cmd.EXPECT().EvalSha(gomock.Any(), slideWindowScript.Hash(), []string{tt.wantKey},
+				int64(500), 1, gomock.Any(), gomock.Any()).Return(res)
+			r := NewRedisSlidingWindowLimiter(cmd, 500*time.Millisecond, 1, tt.opts...)
+			got, err := r.Limit(context.Background(), "foo")
+			assert.NoError(t, err)
+			assert.False(t, got)
+		})
+	}
+}
+
+func TestRedisSlidingWindowLimiter_ServerTime(t *testing.T) {
+	cli := initRedis()
+	r := NewRedisSlidingWindowLimiter(cli, 500*time.Millisecond, 1, WithServerTime())
+	err := cli.Del(context.Background(), "server_time").Err()
+	require.NoError(t, err)
+	defer cli.Del(context.Background(), "server_time")
+
+	got, err := r.Limit(context.Background(), "server_time")
+	assert.NoError(t, err)
+	assert.False(t, got)
+	got, err = r.Limit(context.Background(), "server_time")
+	assert.NoError(t, err)
+	assert.True(t, got)
+}
+
+func TestRedisSlidingWindowLimiter_Burst(t *testing.T) {
+	cli := initRedis()
+	now := time.Now()
+	// 所有请求都在同一毫秒内
+	r := NewRedisSlidingWindowLimiter(cli, time.Second, 10,
+		WithRedisTimeFunc(func() time.Time { return now }))
+	err := cli.Del(context.Background(), "burst").Err()
+	require.NoError(t, err)
+	defer cli.Del(context.Background(), "burst")
+
+	var passed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limited, err := r.Limit(context.Background(), "burst")
+			assert.NoError(t, err)
+			if !limited {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), passed.Load())
+	cnt, err := cli.ZCard(context.Background(), "burst").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), cnt)
+}
+
+func TestRedisSlidingWindowLimiter_LimitMany(t *testing.T) {
+	cli := initRedis()
+	r := NewRedisSlidingWindowLimiter(cli, time.Second, 1)
+	keys := []string{"many_ip", "many_user", "many_ip"}
+	err := cli.Del(context.Background(), "many_ip", "many_user").Err()
+	require.NoError(t, err)
+	defer cli.Del(context.Background(), "many_ip", "many_user")
+
+	// 脚本不存在时自动加载
+	require.NoError(t, cli.ScriptFlush(context.Background()).Err())
+	got, err := r.LimitMany(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+
+	got, err = r.LimitMany(context.Background(), keys[:2])
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, got)
+
+	got, err = r.LimitMany(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{}, got)
+}
+
+// fakePipeliner 按 key 返回预设结果的 pipeline, 记录 ZREM 的 key 与成员
+type fakePipeliner struct {
+	redis.Pipeliner
+	// results 脚本的结果, 为 error 时返回错误
+	results map[string]any
+	zrems   []string
+}
+
+func (p *fakePipeliner) EvalSha(ctx context.Context, _ string, keys []string, _ ...any) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, "evalsha", keys[0])
+	if err, ok := p.results[keys[0]].(error); ok {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(p.results[keys[0]])
+	}
+	return cmd
+}
+
+func (p *fakePipeliner) ZRem(ctx context.Context, key string, members ...any) *redis.IntCmd {
+	for _, m := range members {
+		p.zrems = append(p.zrems, key+" "+m.(string))
+	}
+	return redis.NewIntCmd(ctx, "zrem", key)
+}
+
+// pipeline 部分失败时删除已经计入的请求, 被限流的请求没有计入
+func TestRedisSlidingWindowLimiter_LimitManyPartialFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	mockErr := errors.New("mock redis error")
+	pipe := &fakePipeliner{results: map[string]any{"a": "false", "b": mockErr, "c": "true"}}
+	cmd.EXPECT().Pipelined(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+			require.NoError(t, fn(pipe))
+			return nil, nil
+		}).Times(2)
+	now := time.UnixMilli(1695571200000)
+	r := NewRedisSlidingWindowLimiter(cmd, time.Second, 1, WithRedisTimeFunc(func() time.Time { return now }))
+	got, err := r.LimitMany(context.Background(), []string{"a", "b", "c"})
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.Nil(t, got)
+	require.Len(t, pipe.zrems, 1)
+	assert.Regexp(t, `^a 1695571200000:[0-9a-f]{16}-\d+$`, pipe.zrems[0])
+}
+
+// redis cluster 上不同的限流对象不在同一个 slot, pipeline 中每个脚本只能有一个 key
+func TestRedisSlidingWindowLimiter_LimitManyCluster(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	counted := map[string]bool{}
+	pipe := &redistest.Pipeliner{Reply: func(c redis.Cmder) {
+		key := redistest.Keys(c)[0]
+		c.(*redis.Cmd).SetVal(strconv.FormatBool(counted[key]))
+		counted[key] = true
+	}}
+	cmd.EXPECT().Pipelined(gomock.Any(), gomock.Any()).DoAndReturn(pipe.Pipelined)
+	r := NewRedisSlidingWindowLimiter(cmd, time.Second, 1)
+	keys := []string{"many_ip", "many_user", "many_ip"}
+	require.False(t, rediskey.SameSlot("many_ip", "many_user"))
+
+	got, err := r.LimitMany(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+	require.Len(t, pipe.Cmds, 3)
+	for _, c := range pipe.Cmds {
+		assert.Len(t, redistest.Keys(c), 1)
+		assert.NoError(t, redistest.CheckSlot(c))
+	}
+}
+
+// 可选的集成测试, localhost:16379 不可用时跳过
+func TestRedisSlidingWindowLimiter_LimitManyLiveCluster(t *testing.T) {
+	ctx := context.Background()
+	cli := redistest.LiveClusterClient(t, "localhost:16379")
+	r := NewRedisSlidingWindowLimiter(cli, time.Second, 1)
+	keys := []string{"many_ip", "many_user", "many_ip"}
+	for _, k := range []string{"many_ip", "many_user"} {
+		require.NoError(t, cli.Del(ctx, k).Err())
+		defer cli.Del(ctx, k)
+	}
+
+	got, err := r.LimitMany(ctx, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, got)
+}
+
+func TestRedisSlidingWindowLimiter_Script(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	r := NewRedisSlidingWindowLimiter(cmd, 500*time.Millisecond, 1,
+		WithRedisTimeFunc(func() time.Time { return now }))
+
+	// 脚本不存在时退回 EVAL
+	noScript := redis.NewCmd(context.Background())
+	noScript.SetErr(redisError("NOSCRIPT No matching script. Please use EVAL."))
+	cmd.EXPECT().EvalSha(gomock.Any(), slideWindowScript.Hash(), []string{"foo"},
+		int64(500), 1, now.UnixMilli(), gomock.Any()).Return(noScript)
+	res := redis.NewCmd(context.Background())
+	res.SetVal("true")
+	cmd.EXPECT().Eval(gomock.Any(), luaSlideWindow, []string{"foo"},
+		int64(500), 1, now.UnixMilli(), gomock.Any()).Return(res)
+	got, err := r.Limit(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	// 预先加载脚本
+	loaded := redis.NewStringCmd(context.Background())
+	loaded.SetVal(slideWindowScript.Hash())
+	cmd.EXPECT().ScriptLoad(gomock.Any(), luaSlideWindow).Return(loaded)
+	assert.NoError(t, r.Preload(context.Background()))
+
+	loadErr := redis.NewStringCmd(context.Background())
+	loadErr.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().ScriptLoad(gomock.Any(), luaSlideWindow).Return(loadErr)
+	assert.ErrorIs(t, r.Preload(context.Background()), limiter.ErrBackendUnavailable)
+}
+
+// redisError 模拟 redis 服务器返回的错误
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (redisError) RedisError() {}
+
 func initRedis() redis.Cmdable {
 	redisClient := redis.NewClient(&redis.Options{
 		Addr: "localhost:16379",
 	})
 	return redisClient
 }
+
+func TestRedisSlidingWindowLimiter_Admin(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	now := time.Now()
+	r := NewRedisSlidingWindowLimiter(cli, time.Second, 3,
+		WithRedisTimeFunc(func() time.Time { return now }))
+	require.NoError(t, cli.Del(ctx, "admin").Err())
+	defer cli.Del(ctx, "admin")
+	for i := 0; i < 3; i++ {
+		_, err := r.Limit(ctx, "admin")
+		require.NoError(t, err)
+	}
+	tests := []struct {
+		name  string
+		delta int64
+		want  limiter.State
+	}{
+		{
+			name:  "grant",
+			delta: 2,
+			want:  limiter.State{Limit: 3, Used: 1, Remaining: 2},
+		},
+		{
+			name:  "deduct",
+			delta: -4,
+			want:  limiter.State{Limit: 3, Used: 5, Remaining: 0},
+		},
+		{
+			name:  "zero",
+			delta: 0,
+			want:  limiter.State{Limit: 3, Used: 5, Remaining: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, r.Adjust(ctx, "admin", tt.delta))
+			got, err := r.Inspect(ctx, "admin")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	t.Run("limited_after_deduct", func(t *testing.T) {
+		got, err := r.Limit(ctx, "admin")
+		require.NoError(t, err)
+		assert.True(t, got)
+	})
+	t.Run("reset", func(t *testing.T) {
+		require.NoError(t, r.Reset(ctx, "admin"))
+		got, err := r.Inspect(ctx, "admin")
+		require.NoError(t, err)
+		assert.Equal(t, limiter.State{Limit: 3, Used: 0, Remaining: 3}, got)
+	})
+	t.Run("expired", func(t *testing.T) {
+		require.NoError(t, r.Adjust(ctx, "admin", -1))
+		now = now.Add(time.Second)
+		got, err := r.Inspect(ctx, "admin")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), got.Used)
+	})
+}
+
+func TestRedisSlidingWindowLimiter_AdminError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	timeErr := redis.NewTimeCmd(context.Background())
+	timeErr.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().Time(gomock.Any()).Return(timeErr)
+	delErr := redis.NewIntCmd(context.Background())
+	delErr.SetErr(errors.New("mock redis error"))
+	cmd.EXPECT().Del(gomock.Any(), "foo").Return(delErr)
+	r := NewRedisSlidingWindowLimiter(cmd, time.Second, 1, WithServerTime())
+
+	_, err := r.Inspect(context.Background(), "foo")
+	assert.ErrorIs(t, err, limiter.ErrBackendUnavailable)
+	assert.ErrorIs(t, r.Reset(context.Background(), "foo"), limiter.ErrBackendUnavailable)
+}
+
+func TestRedisSlidingWindowLimiter_SetLimit(t *testing.T) {
+	ctx := context.Background()
+	cli := initRedis()
+	r := NewRedisSlidingWindowLimiter(cli, time.Second, 1)
+	require.NoError(t, cli.Del(ctx, "set_limit").Err())
+	defer cli.Del(ctx, "set_limit")
+
+	got, err := r.Limit(ctx, "set_limit")
+	require.NoError(t, err)
+	assert.False(t, got)
+	got, err = r.Limit(ctx, "set_limit")
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	require.NoError(t, r.SetLimit(3))
+	assert.Equal(t, 3, r.Threshold())
+	got, err = r.Limit(ctx, "set_limit")
+	require.NoError(t, err)
+	assert.False(t, got)
+	assert.ErrorIs(t, r.SetLimit(-1), limiter.ErrInvalidConfig)
+}
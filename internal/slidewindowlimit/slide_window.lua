@@ -4,7 +4,15 @@ local key = KEYS[1]
 local window = tonumber(ARGV[1])
 -- 阈值
 local threshold = tonumber(ARGV[2])
+-- 当前时间, 小于 0 时使用 redis 服务器的时间
 local now = tonumber(ARGV[3])
+-- 请求的唯一标识, 避免同一毫秒内的多个请求被合并为一个成员
+local id = ARGV[4]
+if now < 0 then
+    redis.replicate_commands()
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
 -- 窗口的起始时间
 local min = now - window
 
@@ -13,7 +21,7 @@ local cnt = redis.call('ZCOUNT', key, '-inf', '+inf')
 if cnt >= threshold then
     return "true"
 else
-    redis.call('ZADD', key, now, now)
+    redis.call('ZADD', key, now, now .. ':' .. id)
     redis.call('PEXPIRE', key, window)
     return "false"
-end
\ No newline at end of file
+end
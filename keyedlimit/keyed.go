@@ -0,0 +1,40 @@
+package keyedlimit
+
+import (
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/keyedlimit"
+)
+
+// NewKeyedLimiter 创建一个按 key 区分的本地限流器, 每个 key 第一次出现时使用 newFunc 创建独立的限流器.
+// 默认空闲 10 分钟的 key 会被删除, 见 WithIdleTimeout
+// 示例: 分层限流中每个用户使用各自的滑动窗口, 每个用户 1s 内允许 50 个请求
+// NewKeyedLimiter(func() limiter.Limiter {
+// return slidewindowlimit.NewLocalSlideWindowLimiter(time.Second, slidewindowlimit.NewBoundedQueue(50))
+// })
+func NewKeyedLimiter(newFunc func() limiter.Limiter, opts ...keyedlimit.Option) *keyedlimit.KeyedLimiter {
+	return keyedlimit.NewKeyedLimiter(newFunc, opts...)
+}
+
+// NewKeyedActiveLimiter 创建一个按 key 区分的本地活跃请求数限流器, 每个 key 第一次出现时使用 newFunc 创建独立的限流器.
+// 有正在处理的请求的 key 不会被删除
+func NewKeyedActiveLimiter(newFunc func() limiter.ActiveLimiter,
+	opts ...keyedlimit.Option) *keyedlimit.KeyedActiveLimiter {
+	return keyedlimit.NewKeyedActiveLimiter(newFunc, opts...)
+}
+
+// WithIdleTimeout 删除超过 d 没有使用的 key 的限流器, d 应不小于限流器的窗口. 小于等于 0 时不删除.
+func WithIdleTimeout(d time.Duration) keyedlimit.Option {
+	return keyedlimit.WithIdleTimeout(d)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) keyedlimit.Option {
+	return keyedlimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) keyedlimit.Option {
+	return keyedlimit.WithClock(c)
+}
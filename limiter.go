@@ -2,6 +2,7 @@ package limiter
 
 import "context"
 
+//go:generate mockgen -source=./limiter.go -package=limitermocks -destination=./internal/mocks/limitermocks/limiter.mock.go
 type Limiter interface {
 	// Limit 有没有触发限流。key 就是限流对象
 	// bool 代表是否限流, true 就是要限流
@@ -9,6 +10,19 @@ type Limiter interface {
 	Limit(ctx context.Context, key string) (bool, error)
 }
 
+// Reverter 可以撤销一次没有被限流的 Limit, 例如组合多个限流器时, 其他限流器限流后撤销已经计入的请求
+type Reverter interface {
+	// Revert 撤销最近一次对 key 没有被限流的 Limit
+	Revert(ctx context.Context, key string) error
+}
+
+// Reserver 可以撤销指定的一次 Limit. 并发时 Reverter 撤销的最近一次 Limit 可能属于其他请求,
+// Reserver 只撤销这一次 Limit 计入的请求
+type Reserver interface {
+	// Reserve 与 Limit 相同, 没有被限流时返回撤销这一次 Limit 的 cancel, 被限流或出错时 cancel 为 nil
+	Reserve(ctx context.Context, key string) (limited bool, cancel func(ctx context.Context) error, err error)
+}
+
 // ActiveLimiter 活跃请求数限流
 type ActiveLimiter interface {
 	// Limit 有没有触发限流。key 就是限流对象
@@ -26,7 +40,7 @@ type BucketLimiter interface {
 	// Put 往桶里放置。该方法需要异步执行 go Put()
 	Put()
 
-	// Close 关闭 Put() 方法
+	// Close 关闭 Put() 方法, 并等待 Put() 退出
 	Close()
 
 	// Limit 有没有触发限流。
@@ -0,0 +1,57 @@
+package metriclimit
+
+import (
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/metriclimit"
+)
+
+// Collector 指标收集器. 可使用 promcollector 记录到 prometheus.
+type Collector = metriclimit.Collector
+
+// Decision 限流判断的结果.
+type Decision = metriclimit.Decision
+
+const (
+	Allowed = metriclimit.Allowed
+	Limited = metriclimit.Limited
+	Errored = metriclimit.Errored
+)
+
+// NewMetricLimiter 创建一个记录指标的限流器.
+// name 限流器的名称, 作为指标的标签
+// 记录限流判断的次数与限流器本身(如访问 redis)的耗时
+func NewMetricLimiter(l limiter.Limiter, name string, collector Collector,
+	opts ...metriclimit.Option) *metriclimit.MetricLimiter {
+	return metriclimit.NewMetricLimiter(l, name, collector, opts...)
+}
+
+// NewMetricActiveLimiter 创建一个记录指标的活跃请求数限流器.
+// 额外记录活跃请求数
+func NewMetricActiveLimiter(l limiter.ActiveLimiter, name string, collector Collector,
+	opts ...metriclimit.Option) *metriclimit.MetricActiveLimiter {
+	return metriclimit.NewMetricActiveLimiter(l, name, collector, opts...)
+}
+
+// NewMetricBucketLimiter 创建一个记录指标的桶限流器.
+// 额外记录 BlockLimit 的等待时间
+func NewMetricBucketLimiter(l limiter.BucketLimiter, name string, collector Collector,
+	opts ...metriclimit.Option) *metriclimit.MetricBucketLimiter {
+	return metriclimit.NewMetricBucketLimiter(l, name, collector, opts...)
+}
+
+// WithKeyGroup 将限流对象映射到有限的分组作为指标的标签.
+func WithKeyGroup(fn func(key string) string) metriclimit.Option {
+	return metriclimit.WithKeyGroup(fn)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) metriclimit.Option {
+	return metriclimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) metriclimit.Option {
+	return metriclimit.WithClock(c)
+}
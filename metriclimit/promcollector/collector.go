@@ -0,0 +1,30 @@
+package promcollector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/udugong/limiter/internal/promcollector"
+)
+
+// NewCollector 创建一个 prometheus 指标收集器并注册到 reg.
+// 指标: limiter_decisions_total, limiter_release_errors_total, limiter_active_requests,
+// limiter_wait_seconds, limiter_latency_seconds
+// 示例: NewCollector(prometheus.DefaultRegisterer)
+func NewCollector(reg prometheus.Registerer, opts ...promcollector.Option) (*promcollector.Collector, error) {
+	return promcollector.NewCollector(reg, opts...)
+}
+
+// WithNamespace 指标名称的命名空间.
+func WithNamespace(namespace string) promcollector.Option {
+	return promcollector.WithNamespace(namespace)
+}
+
+// WithWaitBuckets BlockLimit 等待时间直方图的桶.
+func WithWaitBuckets(buckets []float64) promcollector.Option {
+	return promcollector.WithWaitBuckets(buckets)
+}
+
+// WithLatencyBuckets 限流器耗时直方图的桶.
+func WithLatencyBuckets(buckets []float64) promcollector.Option {
+	return promcollector.WithLatencyBuckets(buckets)
+}
@@ -0,0 +1,34 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// Observer 观察限流器的判断结果, 可用于日志、审计与告警.
+// 方法会在限流器的调用路径上同步执行, 耗时的操作应使用异步的 Observer
+type Observer interface {
+	// OnAllow 放行
+	OnAllow(ctx context.Context, key string)
+	// OnLimit 限流
+	OnLimit(ctx context.Context, key string)
+	// OnError 限流器本身出错
+	OnError(ctx context.Context, key string, err error)
+	// OnRelease 活跃请求数减少1
+	OnRelease(ctx context.Context, key string)
+	// OnWait BlockLimit 等待了 d
+	OnWait(ctx context.Context, key string, d time.Duration)
+}
+
+// NopObserver 什么也不做的 Observer. 可以嵌入到结构体中只实现关心的方法
+type NopObserver struct{}
+
+func (NopObserver) OnAllow(context.Context, string) {}
+
+func (NopObserver) OnLimit(context.Context, string) {}
+
+func (NopObserver) OnError(context.Context, string, error) {}
+
+func (NopObserver) OnRelease(context.Context, string) {}
+
+func (NopObserver) OnWait(context.Context, string, time.Duration) {}
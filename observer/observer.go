@@ -0,0 +1,13 @@
+package observer
+
+import (
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/observer"
+)
+
+// NewAsyncObserver 创建一个异步的 Observer.
+// 事件放入长度为 size 的队列后由单独的 goroutine 交给 o 处理, 队列已满时丢弃事件, 不会阻塞限流器.
+// 使用完毕后需要调用 Close, Close 会等待队列中剩余的事件处理完毕
+func NewAsyncObserver(o limiter.Observer, size int) *observer.AsyncObserver {
+	return observer.NewAsyncObserver(o, size)
+}
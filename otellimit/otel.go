@@ -0,0 +1,50 @@
+package otellimit
+
+import (
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/otellimit"
+)
+
+// NewOtelLimiter 创建一个记录 OpenTelemetry span 与指标的限流器.
+// algorithm 限流算法的名称, 如 "redis_sliding_window"
+// 每次 Limit 创建子 span "limiter.Limit", 属性包括算法、限流对象的哈希值与判断结果,
+// 使用 WithRemaining 时还包括剩余的额度, 同时记录指标 limiter.decisions
+func NewOtelLimiter(l limiter.Limiter, algorithm string,
+	opts ...otellimit.Option) (*otellimit.OtelLimiter, error) {
+	return otellimit.NewOtelLimiter(l, algorithm, opts...)
+}
+
+// NewOtelActiveLimiter 创建一个记录 OpenTelemetry span 与指标的活跃请求数限流器.
+func NewOtelActiveLimiter(l limiter.ActiveLimiter, algorithm string,
+	opts ...otellimit.Option) (*otellimit.OtelActiveLimiter, error) {
+	return otellimit.NewOtelActiveLimiter(l, algorithm, opts...)
+}
+
+// NewOtelBucketLimiter 创建一个记录 OpenTelemetry span 与指标的桶限流器.
+func NewOtelBucketLimiter(l limiter.BucketLimiter, algorithm string,
+	opts ...otellimit.Option) (*otellimit.OtelBucketLimiter, error) {
+	return otellimit.NewOtelBucketLimiter(l, algorithm, opts...)
+}
+
+// WithTracerProvider 控制 TracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) otellimit.Option {
+	return otellimit.WithTracerProvider(tp)
+}
+
+// WithMeterProvider 控制 MeterProvider.
+func WithMeterProvider(mp metric.MeterProvider) otellimit.Option {
+	return otellimit.WithMeterProvider(mp)
+}
+
+// WithRemaining 在 span 上记录剩余的额度, 只对实现了 limiter.Admin 的限流器生效.
+func WithRemaining() otellimit.Option {
+	return otellimit.WithRemaining()
+}
+
+// WithSpanEvent 在当前 span 上记录事件而不是创建子 span.
+func WithSpanEvent() otellimit.Option {
+	return otellimit.WithSpanEvent()
+}
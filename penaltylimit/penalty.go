@@ -0,0 +1,107 @@
+package penaltylimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/penaltylimit"
+)
+
+// Policy 违规计数与封禁的策略.
+type Policy = penaltylimit.Policy
+
+// Store 保存违规次数与封禁.
+type Store = penaltylimit.Store
+
+// PenaltyLimiter 封禁反复被限流的限流对象, 可以查询与解除封禁, 实现了 limiter.Admin.
+// Admin 管理的是违规次数与封禁, 不会修改被包装的限流器的状态.
+type PenaltyLimiter = penaltylimit.PenaltyLimiter
+
+// NewPenaltyLimiter 创建一个封禁反复被限流的限流对象的限流器, 类似 fail2ban.
+// l 每次限流都记录一次违规, 在窗口内违规达到阈值时封禁, 封禁的时长随封禁的次数递增.
+// 封禁期间直接限流, 不再调用 l
+// 示例: 1 分钟内被限流 5 次时封禁 10 分钟, 之后每次加倍, 最长 1 天, 封禁记录在 redis 上
+// NewPenaltyLimiter(l, NewRedisStore(cmd), WithThreshold(5, time.Minute),
+// WithBanDuration(10*time.Minute, 24*time.Hour))
+func NewPenaltyLimiter(l limiter.Limiter, store Store, opts ...penaltylimit.Option) *PenaltyLimiter {
+	return penaltylimit.NewPenaltyLimiter(l, store, opts...)
+}
+
+// NewLocalStore 创建一个本地的 Store, 只对当前实例生效.
+func NewLocalStore() *penaltylimit.LocalStore {
+	return penaltylimit.NewLocalStore()
+}
+
+// NewRedisStore 创建一个基于 redis 的 Store, 所有实例共享封禁.
+// redis 上的 key 为 [prefix:]key:penalty, 在封禁结束且可以被遗忘之后过期
+func NewRedisStore(cmd redis.Cmdable, opts ...penaltylimit.RedisOption) *penaltylimit.RedisStore {
+	return penaltylimit.NewRedisStore(cmd, opts...)
+}
+
+// WithThreshold 在 window 内被限流 threshold 次时封禁.
+func WithThreshold(threshold int64, window time.Duration) penaltylimit.Option {
+	return penaltylimit.WithThreshold(threshold, window)
+}
+
+// WithBanDuration 第 1 次封禁的时长为 d, 最长为 maxDuration.
+func WithBanDuration(d, maxDuration time.Duration) penaltylimit.Option {
+	return penaltylimit.WithBanDuration(d, maxDuration)
+}
+
+// WithMultiplier 每次封禁的时长是上一次的 m 倍.
+func WithMultiplier(m float64) penaltylimit.Option {
+	return penaltylimit.WithMultiplier(m)
+}
+
+// WithForgetAfter 距离上一次封禁超过 d 时, 重新从第 1 次封禁开始计算.
+func WithForgetAfter(d time.Duration) penaltylimit.Option {
+	return penaltylimit.WithForgetAfter(d)
+}
+
+// WithAllowList 总是放行的限流对象.
+func WithAllowList(keys ...string) penaltylimit.Option {
+	return penaltylimit.WithAllowList(keys...)
+}
+
+// WithDenyList 总是限流的限流对象.
+func WithDenyList(keys ...string) penaltylimit.Option {
+	return penaltylimit.WithDenyList(keys...)
+}
+
+// WithOnBan 限流对象被封禁时调用, 可用于告警.
+func WithOnBan(fn func(ctx context.Context, key string, until time.Time)) penaltylimit.Option {
+	return penaltylimit.WithOnBan(fn)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) penaltylimit.Option {
+	return penaltylimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) penaltylimit.Option {
+	return penaltylimit.WithClock(c)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) penaltylimit.Option {
+	return penaltylimit.WithObserver(o)
+}
+
+// WithServerTime 使用 redis 服务器的时间判断封禁, 忽略 WithTimeFunc 与 WithClock.
+func WithServerTime() penaltylimit.RedisOption {
+	return penaltylimit.WithServerTime()
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀.
+func WithKeyPrefix(prefix string) penaltylimit.RedisOption {
+	return penaltylimit.WithKeyPrefix(prefix)
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster.
+func WithHashTag() penaltylimit.RedisOption {
+	return penaltylimit.WithHashTag()
+}
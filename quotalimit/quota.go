@@ -0,0 +1,87 @@
+package quotalimit
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/quotalimit"
+)
+
+// Period 日历周期.
+type Period = quotalimit.Period
+
+// Usage 配额的使用情况.
+type Usage = quotalimit.Usage
+
+// QuotaLimiter 按日历周期限制配额的限流器, 可以查询使用情况.
+type QuotaLimiter = quotalimit.QuotaLimiter
+
+// 日历周期.
+const (
+	Daily   = quotalimit.Daily
+	Weekly  = quotalimit.Weekly
+	Monthly = quotalimit.Monthly
+)
+
+// NewLocalQuotaLimiter 创建一个本地的日历周期配额限流器.
+// quota 每个周期内每个 key 允许的请求数
+// period 日历周期, 在周期的第一天 0 点重置
+// 示例: 每个客户每月 10000 次, 在客户所在时区的每月 1 日 0 点重置
+// NewLocalQuotaLimiter(10000, Monthly, WithLocationFunc(customerLocation))
+func NewLocalQuotaLimiter(quota int64, period Period, opts ...quotalimit.Option) *quotalimit.LocalQuotaLimiter {
+	return quotalimit.NewLocalQuotaLimiter(quota, period, opts...)
+}
+
+// NewRedisQuotaLimiter 创建一个基于 redis 的日历周期配额限流器.
+// redis 上的 key 为 [prefix:]key:quota:<周期的类型>:<周期的开始日期>, 周期结束后过期
+func NewRedisQuotaLimiter(cmd redis.Cmdable, quota int64, period Period,
+	opts ...quotalimit.RedisOption) *quotalimit.RedisQuotaLimiter {
+	return quotalimit.NewRedisQuotaLimiter(cmd, quota, period, opts...)
+}
+
+// WithLocation 按 loc 的时区计算周期.
+func WithLocation(loc *time.Location) quotalimit.Option {
+	return quotalimit.WithLocation(loc)
+}
+
+// WithLocationFunc 按 key 所属的时区计算周期.
+func WithLocationFunc(fn func(key string) *time.Location) quotalimit.Option {
+	return quotalimit.WithLocationFunc(fn)
+}
+
+// WithWeekStart 每周的第一天.
+func WithWeekStart(day time.Weekday) quotalimit.Option {
+	return quotalimit.WithWeekStart(day)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) quotalimit.Option {
+	return quotalimit.WithTimeFunc(fn)
+}
+
+// WithObserver 设置观察限流判断结果的 Observer.
+func WithObserver(o limiter.Observer) quotalimit.Option {
+	return quotalimit.WithObserver(o)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) quotalimit.Option {
+	return quotalimit.WithClock(c)
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀.
+func WithKeyPrefix(prefix string) quotalimit.RedisOption {
+	return quotalimit.WithKeyPrefix(prefix)
+}
+
+// WithServerTime 使用 redis 服务器的时间计算周期.
+func WithServerTime() quotalimit.RedisOption {
+	return quotalimit.WithServerTime()
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster.
+func WithHashTag() quotalimit.RedisOption {
+	return quotalimit.WithHashTag()
+}
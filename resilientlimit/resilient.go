@@ -0,0 +1,85 @@
+package resilientlimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/activelimit"
+	"github.com/udugong/limiter/internal/keyedlimit"
+	"github.com/udugong/limiter/internal/queue"
+	"github.com/udugong/limiter/internal/resilientlimit"
+	"github.com/udugong/limiter/internal/slidewindowlimit"
+)
+
+// NewResilientLimiter 创建一个在后端不可用时按策略处理的限流器.
+// 默认在后端出错时放行, 并在连续失败 5 次后熔断 1s, 熔断期间不再访问后端
+// 示例: 降级到本地限流器, 3 个实例共享 redis 上 1s 3000 个请求的阈值
+// NewResilientLimiter(redisLimiter, WithFallback(NewSlideWindowFallback(time.Second, 3000, 3)))
+func NewResilientLimiter(l limiter.Limiter, opts ...resilientlimit.Option) *resilientlimit.ResilientLimiter {
+	return resilientlimit.NewResilientLimiter(l, opts...)
+}
+
+// NewResilientActiveLimiter 创建一个在后端不可用时按策略处理的活跃请求数限流器.
+func NewResilientActiveLimiter(l limiter.ActiveLimiter,
+	opts ...resilientlimit.Option) *resilientlimit.ResilientActiveLimiter {
+	return resilientlimit.NewResilientActiveLimiter(l, opts...)
+}
+
+// NewSlideWindowFallback 创建按 key 区分的本地滑动窗口降级限流器.
+// rate 为后端的阈值, instances 为共享该阈值的实例数, 每个实例本地允许 rate/instances 个请求
+func NewSlideWindowFallback(window time.Duration, rate int, instances int) limiter.Limiter {
+	localRate := int(resilientlimit.ScaleLimit(int64(rate), instances))
+	return keyedlimit.NewKeyedLimiter(func() limiter.Limiter {
+		return slidewindowlimit.NewLocalSlideWindowLimiter(window, queue.NewArrayBoundedQueue(localRate))
+	})
+}
+
+// NewActiveFallback 创建按 key 区分的本地活跃请求数降级限流器.
+// maxActive 为后端的最大请求数, instances 为共享该阈值的实例数
+func NewActiveFallback(maxActive int64, instances int) limiter.ActiveLimiter {
+	localMax := resilientlimit.ScaleLimit(maxActive, instances)
+	return keyedlimit.NewKeyedActiveLimiter(func() limiter.ActiveLimiter {
+		return activelimit.NewLocalActiveLimiter(localMax)
+	})
+}
+
+// WithFailOpen 后端不可用时放行.
+func WithFailOpen() resilientlimit.Option {
+	return resilientlimit.WithFailOpen()
+}
+
+// WithFailClosed 后端不可用时限流.
+func WithFailClosed() resilientlimit.Option {
+	return resilientlimit.WithFailClosed()
+}
+
+// WithFallback 后端不可用时降级到 l.
+func WithFallback(l limiter.Limiter) resilientlimit.Option {
+	return resilientlimit.WithFallback(l)
+}
+
+// WithActiveFallback 后端不可用时降级到 l.
+func WithActiveFallback(l limiter.ActiveLimiter) resilientlimit.Option {
+	return resilientlimit.WithActiveFallback(l)
+}
+
+// WithOnError 后端出错时的回调.
+func WithOnError(fn func(ctx context.Context, key string, err error)) resilientlimit.Option {
+	return resilientlimit.WithOnError(fn)
+}
+
+// WithBreaker 连续失败 failures 次后熔断 cooldown.
+func WithBreaker(failures int, cooldown time.Duration) resilientlimit.Option {
+	return resilientlimit.WithBreaker(failures, cooldown)
+}
+
+// WithTimeFunc 控制时间.
+func WithTimeFunc(fn func() time.Time) resilientlimit.Option {
+	return resilientlimit.WithTimeFunc(fn)
+}
+
+// WithClock 控制时间.
+func WithClock(c limiter.Clock) resilientlimit.Option {
+	return resilientlimit.WithClock(c)
+}
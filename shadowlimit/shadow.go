@@ -0,0 +1,41 @@
+package shadowlimit
+
+import (
+	"context"
+
+	"github.com/udugong/limiter"
+	"github.com/udugong/limiter/internal/shadowlimit"
+)
+
+// NewShadowLimiter 创建一个影子模式限流器.
+// 永远放行, 但会通过回调、计数和采样日志记录 l 本应限流的请求.
+// 用于在正式启用新的限流规则之前评估影响
+func NewShadowLimiter(l limiter.Limiter, opts ...shadowlimit.Option) *shadowlimit.ShadowLimiter {
+	return shadowlimit.NewShadowLimiter(l, opts...)
+}
+
+// NewShadowActiveLimiter 创建一个影子模式活跃请求数限流器.
+// 永远放行, 但 l 依然会计数, 每次 Limit 之后仍需调用 Decr
+func NewShadowActiveLimiter(l limiter.ActiveLimiter, opts ...shadowlimit.Option) *shadowlimit.ShadowActiveLimiter {
+	return shadowlimit.NewShadowActiveLimiter(l, opts...)
+}
+
+// WithOnLimit 本应被限流时的回调.
+func WithOnLimit(fn func(ctx context.Context, key string)) shadowlimit.Option {
+	return shadowlimit.WithOnLimit(fn)
+}
+
+// WithOnError 限流器本身出错时的回调.
+func WithOnError(fn func(ctx context.Context, key string, err error)) shadowlimit.Option {
+	return shadowlimit.WithOnError(fn)
+}
+
+// WithSampledLog 每 every 次本应被限流的请求打印一次日志.
+func WithSampledLog(every int64) shadowlimit.Option {
+	return shadowlimit.WithSampledLog(every)
+}
+
+// WithLogFunc 控制打印日志的方法.
+func WithLogFunc(fn func(format string, args ...any)) shadowlimit.Option {
+	return shadowlimit.WithLogFunc(fn)
+}
@@ -3,6 +3,7 @@ package slidewindowlimit
 import (
 	"time"
 
+	"github.com/udugong/limiter"
 	"github.com/udugong/limiter/internal/queue"
 	"github.com/udugong/limiter/internal/slidewindowlimit"
 )
@@ -16,7 +17,22 @@ func NewLocalSlideWindowLimiter(window time.Duration, boundedQueue queue.Bounded
 	return slidewindowlimit.NewLocalSlideWindowLimiter(window, boundedQueue, opts...)
 }
 
+// NewBoundedQueue 创建一个容量为 capacity 的有界队列.
+func NewBoundedQueue(capacity int) queue.BoundedQueue {
+	return queue.NewArrayBoundedQueue(capacity)
+}
+
 // WithTimeFunc 控制时间.
 func WithTimeFunc(fn func() time.Time) slidewindowlimit.Option {
 	return slidewindowlimit.WithTimeFunc(fn)
 }
+
+// WithObserver 设置观察限流判断结果的 Observer, 同时适用于本地与 redis 限流器.
+func WithObserver(o limiter.Observer) slidewindowlimit.CommonOption {
+	return slidewindowlimit.WithObserver(o)
+}
+
+// WithClock 控制时间, 同时适用于本地与 redis 限流器.
+func WithClock(c limiter.Clock) slidewindowlimit.CommonOption {
+	return slidewindowlimit.WithClock(c)
+}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/redis/go-redis/v9"
 
-	"github.com/udugong/limiter"
 	"github.com/udugong/limiter/internal/slidewindowlimit"
 )
 
@@ -15,11 +14,37 @@ import (
 // rate: 阈值
 // 表示: 在 interval 内允许 rate 个请求
 // 示例: 1s 内允许 3000 个请求 NewRedisSlidingWindowLimiter(redis.Client, time.Second, 3000)
+// redis 上的 key 默认为 [prefix:]key, 与之前的版本相同. 使用 WithKeySuffix 后为 [prefix:]key:sw,
+// 多个算法的限流器共用 redis 时避免 key 冲突
+// 脚本通过 EVALSHA 执行, 可在启动时调用 Preload 预先加载脚本
 func NewRedisSlidingWindowLimiter(cmd redis.Cmdable,
-	interval time.Duration, rate int) limiter.Limiter {
-	return &slidewindowlimit.RedisSlidingWindowLimiter{
-		Cmd:      cmd,
-		Interval: interval,
-		Rate:     rate,
-	}
+	interval time.Duration, rate int, opts ...slidewindowlimit.RedisOption) *slidewindowlimit.RedisSlidingWindowLimiter {
+	return slidewindowlimit.NewRedisSlidingWindowLimiter(cmd, interval, rate, opts...)
+}
+
+// WithServerTime 使用 redis 服务器的时间.
+func WithServerTime() slidewindowlimit.RedisOption {
+	return slidewindowlimit.WithServerTime()
+}
+
+// WithRedisTimeFunc 控制时间.
+func WithRedisTimeFunc(fn func() time.Time) slidewindowlimit.RedisOption {
+	return slidewindowlimit.WithRedisTimeFunc(fn)
+}
+
+// WithKeyPrefix 设置 redis 上 key 的前缀.
+func WithKeyPrefix(prefix string) slidewindowlimit.RedisOption {
+	return slidewindowlimit.WithKeyPrefix(prefix)
+}
+
+// WithHashTag 用 {} 包裹限流对象, 适用于 redis cluster.
+func WithHashTag() slidewindowlimit.RedisOption {
+	return slidewindowlimit.WithHashTag()
+}
+
+// WithKeySuffix 在 redis 上的 key 后加上 ":sw", 多个算法的限流器共用 redis 时避免 key 冲突.
+// 开启后之前 key 上的计数不再生效, 滚动发布期间新旧实例分别计数, 限流最多放宽为两倍.
+// 迁移时可在低峰期一次性切换, 或先为新实例设置新的 WithKeyPrefix 再逐步切换流量.
+func WithKeySuffix() slidewindowlimit.RedisOption {
+	return slidewindowlimit.WithKeySuffix()
 }